@@ -3,18 +3,29 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/ngaut/log"
+	flag "github.com/spf13/pflag"
 	"github.com/tidbops/tim/pkg/models"
 	"github.com/tidbops/tim/pkg/server"
 )
 
+var dataDir string
+
+func init() {
+	flag.StringVar(&dataDir, "data-dir", ".", "the directory of the tim.db data file")
+}
+
 func main() {
+	flag.Parse()
+
 	g := gin.Default()
 
 	server.Router(g)
 
-	if err := models.NewEngine(); err != nil {
+	if err := models.NewEngineWithConfig(models.SqliteEngineConfig(dataDir)); err != nil {
 		log.Fatal(err)
 	}
+	defer models.CloseEngine()
+
 	// Listen and serve on 0.0.0.0:8080
 	g.Run(":8080")
 }
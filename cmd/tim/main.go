@@ -11,19 +11,33 @@ import (
 
 	"github.com/chzyer/readline"
 	"github.com/mattn/go-shellwords"
-	"github.com/ngaut/log"
 	flag "github.com/spf13/pflag"
+	"github.com/tidbops/tim/pkg/config"
 	"github.com/tidbops/tim/pkg/ctl"
+	"github.com/tidbops/tim/pkg/logutil"
+	"github.com/tidbops/tim/pkg/metrics"
+	"github.com/tidbops/tim/pkg/utils"
 	v "github.com/tidbops/tim/pkg/version"
 )
 
 var (
-	url      string
-	level    string
-	detach   bool
-	interact bool
-	version  bool
-	help     bool
+	url            string
+	level          string
+	logLevel       string
+	logFormat      string
+	ansibleRepoURL string
+	dataDir        string
+	metricsListen  string
+	metricsPushURL string
+	proxy          string
+	configPaths    string
+	yes            bool
+	quiet          bool
+	forceUnlock    bool
+	detach         bool
+	interact       bool
+	version        bool
+	help           bool
 )
 
 func init() {
@@ -32,24 +46,55 @@ func init() {
 	flag.BoolVarP(&interact, "interact", "i", false, "Run tim with readline.")
 	flag.BoolVarP(&version, "version", "V", false, "Print version information and exit.")
 	flag.BoolVarP(&help, "help", "h", false, "Help message.")
-	flag.StringVarP(&level, "level", "L", "info",
-		"log level, support info / warning / debug / error / fatal")
+	flag.StringVarP(&logLevel, "log-level", "L", "info",
+		"log level, support debug / info / warn / error / fatal")
+	flag.StringVar(&level, "level", "", "log level")
+	flag.CommandLine.MarkDeprecated("level", "use --log-level instead")
+	flag.StringVar(&logFormat, "log-format", "text",
+		"log format, support text / json, the logs are written to stderr")
+	flag.StringVar(&ansibleRepoURL, "ansible-repo-url", "",
+		"tidb-ansible raw file url, default https://raw.githubusercontent.com/pingcap/tidb-ansible")
+	flag.StringVar(&dataDir, "data-dir", "",
+		"the directory of the tim.db data file, default the current directory")
+	flag.StringVar(&metricsListen, "metrics-listen", "",
+		"serve the metrics on /metrics of the address while tim runs, e.g. :9090")
+	flag.StringVar(&metricsPushURL, "metrics-push-url", "",
+		"push the metrics to the prometheus pushgateway url after each command")
+	flag.StringVar(&proxy, "proxy", "",
+		"the proxy url of the downloads, e.g. http://10.0.0.1:3128, default the HTTP_PROXY / HTTPS_PROXY / NO_PROXY env")
+	flag.StringVar(&configPaths, "config-paths", "",
+		"the comma separated paths of the config files of the components in conf, e.g. tikv=tikv-main.yml,pd=pd/pd.yml")
+	flag.BoolVarP(&yes, "yes", "y", false,
+		"answer yes to the confirmations and select the safe defaults, destructive operations still require --force")
+	flag.BoolVarP(&quiet, "quiet", "q", false,
+		"print only the results and the errors, the commands do not ask and the logs below warn are dropped")
+	flag.BoolVar(&forceUnlock, "force-unlock", false,
+		"remove the lock of the tidb cluster left by a crashed tim before operating it")
 }
 
-func initLog() {
-	log.SetLevelByString(level)
+func initLog() error {
+	if level != "" {
+		logLevel = level
+	} else if quiet && !flag.CommandLine.Changed("log-level") {
+		logLevel = "warn"
+	}
+	return logutil.InitLogger(logLevel, logFormat)
 }
 
 func main() {
-	timAddr := os.Getenv("TIM_SERVER")
-	if timAddr != "" {
-		os.Args = append(os.Args, "-u", timAddr)
-	}
-
 	flag.CommandLine.ParseErrorsWhitelist.UnknownFlags = true
 	flag.Parse()
 
-	initLog()
+	// the flags not set take the TIM_* env, e.g. TIM_SERVER, or ~/.tim/config.yaml
+	if err := config.ApplyDefaults(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := initLog(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	if help {
 		flag.Usage()
@@ -60,6 +105,21 @@ func main() {
 		os.Exit(0)
 	}
 
+	if proxy != "" {
+		if _, err := utils.ParseProxyURL(proxy); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		utils.DownloadProxy = proxy
+	}
+
+	if metricsListen != "" {
+		errCh := metrics.Serve(metricsListen)
+		go func() {
+			fmt.Fprintf(os.Stderr, "serve the metrics on %s failed, %v\n", metricsListen, <-errCh)
+		}()
+	}
+
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc,
 		syscall.SIGHUP,
@@ -68,13 +128,20 @@ func main() {
 		syscall.SIGQUIT)
 
 	go func() {
-		sig := <-sc
-		fmt.Printf("\nGot signal [%v] to exit.\n", sig)
-		switch sig {
-		case syscall.SIGTERM:
-			os.Exit(0)
-		default:
-			os.Exit(1)
+		for sig := range sc {
+			// the first SIGINT aborts the running command, which releases
+			// the lock and records the history before it returns
+			if sig == syscall.SIGINT && ctl.Interrupt() {
+				fmt.Fprintf(os.Stderr, "\nGot signal [%v] to abort, press Ctrl-C again to exit.\n", sig)
+				continue
+			}
+			fmt.Printf("\nGot signal [%v] to exit.\n", sig)
+			switch sig {
+			case syscall.SIGTERM:
+				os.Exit(0)
+			default:
+				os.Exit(1)
+			}
 		}
 	}()
 	var input []string
@@ -83,8 +150,8 @@ func main() {
 		detach = true
 		b, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
-			fmt.Println(err)
-			return
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
 		input = strings.Split(strings.TrimSpace(string(b[:])), " ")
 	}
@@ -92,7 +159,23 @@ func main() {
 		loop()
 		return
 	}
-	ctl.Start(append(os.Args[1:], input...))
+	err := ctl.Start(append(os.Args[1:], input...))
+	pushMetrics()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// pushMetrics pushes the metrics to --metrics-push-url if it is set, a
+// failure is only reported.
+func pushMetrics() {
+	if metricsPushURL == "" {
+		return
+	}
+	hostname, _ := os.Hostname()
+	if err := metrics.DefaultRegistry.Push(metricsPushURL, "tim", hostname); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 }
 
 func loop() {
@@ -129,5 +212,6 @@ func loop() {
 		args = append(args, "-u", url)
 
 		ctl.Start(args)
+		pushMetrics()
 	}
 }
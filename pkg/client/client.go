@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+
+	"github.com/tidbops/tim/pkg/models"
+)
+
+// Client is the tidb cluster store used by commands, it can be backed by the
+// local database or by a remote tim-server.
+type Client interface {
+	LoadTiDBClusters(ctx context.Context) ([]*models.TiDBCluster, error)
+	// LoadTiDBClustersPaged returns at most limit tidb clusters ordered by
+	// name from offset and the number of all the tidb clusters.
+	LoadTiDBClustersPaged(ctx context.Context, offset, limit int) ([]*models.TiDBCluster, int, error)
+	GetTiDBClusterByHost(ctx context.Context, host string) ([]*models.TiDBCluster, error)
+	GetTiDBClusterByName(ctx context.Context, name string) (*models.TiDBCluster, error)
+	GetTiDBClustersByVersion(ctx context.Context, version string) ([]*models.TiDBCluster, error)
+	GetTiDBClustersByStatus(ctx context.Context, status string) ([]*models.TiDBCluster, error)
+	CreateTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error
+	// UpsertTiDBCluster creates tc or replaces the tidb cluster of the same
+	// name, the replaced one keeps its id, init time and labels.
+	UpsertTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error
+	UpdateTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error
+	DeleteTiDBCluster(ctx context.Context, name string) error
+	SearchTiDBCluster(ctx context.Context, s map[string]interface{}) ([]*models.TiDBCluster, error)
+	CreateUpgradeHistory(ctx context.Context, h *models.UpgradeHistory) error
+	GetUpgradeHistoryByName(ctx context.Context, name string) ([]*models.UpgradeHistory, error)
+	// Close releases the resources of the client, it must not be used after.
+	Close() error
+}
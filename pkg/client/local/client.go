@@ -1,41 +1,86 @@
 package local
 
 import (
+	"context"
+
+	"github.com/tidbops/tim/pkg/client"
 	"github.com/tidbops/tim/pkg/models"
 )
 
+var _ client.Client = (*Client)(nil)
+
 type Client struct{}
 
 func NewLocalClient() (*Client, error) {
+	return NewLocalClientWithConfig(models.DefaultEngineConfig())
+}
+
+// NewLocalClientWithConfig creates a client storing the tidb clusters in the
+// database of cfg.
+func NewLocalClientWithConfig(cfg models.EngineConfig) (*Client, error) {
 	c := &Client{}
 
-	if err := models.NewEngine(); err != nil {
+	if err := models.NewEngineWithConfig(cfg); err != nil {
 		return nil, err
 	}
 
 	return c, nil
 }
 
-func (c *Client) LoadTiDBClusters() ([]*models.TiDBCluster, error) {
-	return models.LoadTiDBClusters()
+func (c *Client) LoadTiDBClusters(ctx context.Context) ([]*models.TiDBCluster, error) {
+	return models.LoadTiDBClusters(ctx)
+}
+
+func (c *Client) LoadTiDBClustersPaged(ctx context.Context, offset, limit int) ([]*models.TiDBCluster, int, error) {
+	return models.LoadTiDBClustersPaged(ctx, offset, limit)
+}
+
+func (c *Client) GetTiDBClusterByHost(ctx context.Context, host string) ([]*models.TiDBCluster, error) {
+	return models.GetTiDBClusterByHost(ctx, host)
+}
+
+func (c *Client) GetTiDBClusterByName(ctx context.Context, name string) (*models.TiDBCluster, error) {
+	return models.GetTiDBClusterByName(ctx, name)
+}
+
+func (c *Client) GetTiDBClustersByVersion(ctx context.Context, version string) ([]*models.TiDBCluster, error) {
+	return models.GetTiDBClustersByVersion(ctx, version)
+}
+
+func (c *Client) GetTiDBClustersByStatus(ctx context.Context, status string) ([]*models.TiDBCluster, error) {
+	return models.GetTiDBClustersByStatus(ctx, status)
+}
+
+func (c *Client) CreateTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error {
+	return models.CreateTiDBCluster(ctx, tc)
+}
+
+func (c *Client) UpsertTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error {
+	return models.UpsertTiDBCluster(ctx, tc)
+}
+
+func (c *Client) SearchTiDBCluster(ctx context.Context, s map[string]interface{}) ([]*models.TiDBCluster, error) {
+	return models.SearchTiDBClusters(ctx, s)
 }
 
-func (c *Client) GetTiDBClusterByHost(host string) ([]*models.TiDBCluster, error) {
-	return models.GetTiDBClusterByHost(host)
+func (c *Client) UpdateTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error {
+	return models.UpdateTiDBCluster(ctx, tc)
 }
 
-func (c *Client) GetTiDBClusterByName(name string) (*models.TiDBCluster, error) {
-	return models.GetTiDBClusterByName(name)
+func (c *Client) DeleteTiDBCluster(ctx context.Context, name string) error {
+	return models.DeleteTiDBCluster(ctx, name)
 }
 
-func (c *Client) CreateTiDBCluster(tc *models.TiDBCluster) error {
-	return models.CreateTiDBCluster(tc)
+func (c *Client) CreateUpgradeHistory(ctx context.Context, h *models.UpgradeHistory) error {
+	return models.CreateUpgradeHistory(ctx, h)
 }
 
-func (c *Client) SearchTiDBCluster(s map[string]interface{}) ([]*models.TiDBCluster, error) {
-	return models.SearchTiDBClusters(s)
+func (c *Client) GetUpgradeHistoryByName(ctx context.Context, name string) ([]*models.UpgradeHistory, error) {
+	return models.GetUpgradeHistoryByName(ctx, name)
 }
 
-func (c *Client) UpdateTiDBCluster(tc *models.TiDBCluster) error {
-	return models.UpdateTiDBCluster(tc)
+// Close closes the database engine, it is shared by the local clients of the
+// process, so the others must not be used after it either.
+func (c *Client) Close() error {
+	return models.CloseEngine()
 }
@@ -0,0 +1,72 @@
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/tidbops/tim/pkg/models"
+)
+
+func TestClientCreateUpdateDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tim-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewLocalClientWithConfig(models.SqliteEngineConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	tc := &models.TiDBCluster{
+		Name:    "tidb",
+		Version: "v3.0.4",
+		Path:    "/data/tidb",
+		Host:    "tim-1",
+		Hosts:   []string{"172.16.10.1", "172.16.10.4"},
+		Status:  string(models.TiDBInited),
+	}
+	if err := c.CreateTiDBCluster(ctx, tc); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetTiDBClusterByName(ctx, tc.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != tc.ID || got.Version != "v3.0.4" || got.Path != tc.Path || len(got.Hosts) != 2 {
+		t.Errorf("created %+v, want %+v", got, tc)
+	}
+
+	got.Version = "v3.0.5"
+	got.Status = models.TiDBRunning
+	got.Hosts = []string{"172.16.10.1"}
+	if err := c.UpdateTiDBCluster(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := c.GetTiDBClusterByName(ctx, tc.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != "v3.0.5" || updated.Status != models.TiDBRunning ||
+		len(updated.Hosts) != 1 || updated.Path != tc.Path || updated.Host != tc.Host {
+		t.Errorf("updated %+v, want %+v", updated, got)
+	}
+
+	if err := c.DeleteTiDBCluster(ctx, tc.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetTiDBClusterByName(ctx, tc.Name); !models.IsErrTiDBClusterNotExist(err) {
+		t.Errorf("get the deleted tidb cluster: %v, want not exist", err)
+	}
+	if tcs, err := c.LoadTiDBClusters(ctx); err != nil || len(tcs) != 0 {
+		t.Errorf("tidb clusters %v %v after the delete, want none", tcs, err)
+	}
+	if err := c.DeleteTiDBCluster(ctx, tc.Name); !models.IsErrTiDBClusterNotExist(err) {
+		t.Errorf("delete the deleted tidb cluster: %v, want not exist", err)
+	}
+}
@@ -1,8 +1,11 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/tidbops/tim/pkg/client"
 	"github.com/tidbops/tim/pkg/models"
 	"github.com/tidbops/tim/pkg/server/api"
 	"io/ioutil"
@@ -10,137 +13,326 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
-type Client struct{}
+var _ client.Client = (*Client)(nil)
 
-var (
+var errNotFound = errors.New("not found")
+
+type Client struct {
 	address string
-)
+}
 
+// NewServerClient creates a client of tim-server, addr is the base url of
+// tim-server, http is used when the scheme is not specified.
 func NewServerClient(addr string) (*Client, error) {
-	address = addr
-	return &Client{}, nil
+	if addr == "" {
+		return nil, errors.New("tim-server address is empty")
+	}
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+	if _, err := url.Parse(addr); err != nil {
+		return nil, fmt.Errorf("invalid tim-server address %s, %v", addr, err)
+	}
+	return &Client{address: strings.TrimSuffix(addr, "/")}, nil
 }
 
-func (c *Client) LoadTiDBClusters() ([]*models.TiDBCluster, error) {
-	resp, err := getRpcCall("/api/loadtidbclusters", map[string]interface{}{})
+func (c *Client) LoadTiDBClusters(ctx context.Context) ([]*models.TiDBCluster, error) {
+	resp, err := c.getRpcCall(ctx, "/api/loadtidbclusters", map[string]interface{}{})
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, err
 }
 
-func (c *Client) GetTiDBClusterByHost(host string) ([]*models.TiDBCluster, error) {
+func (c *Client) LoadTiDBClustersPaged(ctx context.Context, offset, limit int) ([]*models.TiDBCluster, int, error) {
+	params := map[string]interface{}{
+		"offset": strconv.Itoa(offset),
+		"limit":  strconv.Itoa(limit),
+	}
+	resp, err := c.getRpcCall(ctx, "/api/loadtidbclusterspaged", params)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Data, resp.Total, nil
+}
+
+func (c *Client) GetTiDBClusterByHost(ctx context.Context, host string) ([]*models.TiDBCluster, error) {
 	params := map[string]interface{}{
 		"host": host,
 	}
-	resp, err := getRpcCall("/api/gettidbclustersbyhost", params)
+	resp, err := c.getRpcCall(ctx, "/api/gettidbclustersbyhost", params)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, err
 }
 
-func (c *Client) GetTiDBClusterByName(name string) (*models.TiDBCluster, error) {
+func (c *Client) GetTiDBClusterByName(ctx context.Context, name string) (*models.TiDBCluster, error) {
 	params := map[string]interface{}{
 		"name": name,
 	}
-	resp, err := getRpcCall("/api/gettidbclustersbyname", params)
+	resp, err := c.getRpcCall(ctx, "/api/gettidbclustersbyname", params)
+	if err == errNotFound || (err == nil && len(resp.Data) == 0) {
+		return nil, models.ErrTiDBClusterNotExist{Name: name}
+	}
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data[0], err
 }
 
-func (c *Client) CreateTiDBCluster(tc *models.TiDBCluster) error {
+func (c *Client) GetTiDBClustersByVersion(ctx context.Context, version string) ([]*models.TiDBCluster, error) {
+	params := map[string]interface{}{
+		"version": version,
+	}
+	resp, err := c.getRpcCall(ctx, "/api/gettidbclustersbyversion", params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, err
+}
+
+func (c *Client) GetTiDBClustersByStatus(ctx context.Context, status string) ([]*models.TiDBCluster, error) {
+	params := map[string]interface{}{
+		"status": status,
+	}
+	resp, err := c.getRpcCall(ctx, "/api/gettidbclustersbystatus", params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, err
+}
+
+func (c *Client) CreateTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error {
+	return c.createTiDBCluster(ctx, "/api/createtidbcluster", tc)
+}
+
+func (c *Client) UpsertTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error {
+	return c.createTiDBCluster(ctx, "/api/upserttidbcluster", tc)
+}
+
+// createTiDBCluster posts the fields of tc but the id and the init time to
+// the create api.
+func (c *Client) createTiDBCluster(ctx context.Context, api string, tc *models.TiDBCluster) error {
 	params := map[string]interface{}{
 		"name":        tc.Name,
 		"version":     tc.Version,
 		"path":        tc.Path,
 		"host":        tc.Host,
+		"hosts":       strings.Join(tc.Hosts, ","),
 		"status":      tc.Status,
 		"description": tc.Description,
 		//"initTime":    tc.InitTime,
+		"config_mode":   tc.ConfigMode,
+		"config_file":   tc.ConfigFile,
+		"config_hashes": encodeStringMap(tc.ConfigHashes),
+		"labels":        encodeStringMap(tc.Labels),
+		"ssh_address":   tc.SSHAddress,
+		"ssh_key":       tc.SSHKey,
 	}
-	_, err := postRpcCall("/api/createtidbcluster", params)
+	_, err := c.postRpcCall(ctx, api, params)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *Client) UpdateTiDBCluster(tc *models.TiDBCluster) error {
+func (c *Client) UpdateTiDBCluster(ctx context.Context, tc *models.TiDBCluster) error {
 	params := map[string]interface{}{
-		"id":          strconv.FormatInt(tc.ID, 10),
-		"name":        tc.Name,
-		"version":     tc.Version,
-		"path":        tc.Path,
-		"host":        tc.Host,
-		"status":      tc.Status,
-		"description": tc.Description,
-		"initTime":    tc.InitTime.Format("2006-01-02 15:04:05"),
+		"id":            strconv.FormatInt(tc.ID, 10),
+		"name":          tc.Name,
+		"version":       tc.Version,
+		"path":          tc.Path,
+		"host":          tc.Host,
+		"hosts":         strings.Join(tc.Hosts, ","),
+		"status":        tc.Status,
+		"description":   tc.Description,
+		"initTime":      tc.InitTime.Format("2006-01-02 15:04:05"),
+		"config_mode":   tc.ConfigMode,
+		"config_file":   tc.ConfigFile,
+		"config_hashes": encodeStringMap(tc.ConfigHashes),
+		"labels":        encodeStringMap(tc.Labels),
+		"ssh_address":   tc.SSHAddress,
+		"ssh_key":       tc.SSHKey,
+	}
+	_, err := c.postRpcCall(ctx, "/api/updatetidbcluster", params)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) DeleteTiDBCluster(ctx context.Context, name string) error {
+	params := map[string]interface{}{
+		"name": name,
+	}
+	_, err := c.postRpcCall(ctx, "/api/deletetidbcluster", params)
+	if err == errNotFound {
+		return models.ErrTiDBClusterNotExist{Name: name}
 	}
-	_, err := postRpcCall("/api/updatetidbcluster", params)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *Client) SearchTiDBCluster(s map[string]interface{}) ([]*models.TiDBCluster, error) {
-	resp, err := getRpcCall("/api/searchtidbclusters", s)
+func (c *Client) SearchTiDBCluster(ctx context.Context, s map[string]interface{}) ([]*models.TiDBCluster, error) {
+	resp, err := c.getRpcCall(ctx, "/api/searchtidbclusters", s)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, err
 }
 
-func getRpcCall(apiMethod string, params map[string]interface{}) (*api.Response, error) {
+func (c *Client) CreateUpgradeHistory(ctx context.Context, h *models.UpgradeHistory) error {
+	params := map[string]interface{}{
+		"name":          h.Name,
+		"operation":     h.Operation,
+		"fromVersion":   h.FromVersion,
+		"targetVersion": h.TargetVersion,
+		"configMode":    h.ConfigMode,
+		"configFile":    h.ConfigFile,
+		"result":        h.Result,
+		"error":         h.Error,
+		"operator":      h.Operator,
+		"host":          h.Host,
+		"artifacts":     h.Artifacts,
+		"startTime":     h.StartTime.Format(time.RFC3339),
+		"endTime":       h.EndTime.Format(time.RFC3339),
+	}
+	req, err := newPostRequest(ctx, c.address+"/api/createupgradehistory", params)
+	if err != nil {
+		return err
+	}
+	return doRpcCall(req, &api.HistoryResponse{})
+}
+
+func (c *Client) GetUpgradeHistoryByName(ctx context.Context, name string) ([]*models.UpgradeHistory, error) {
+	params := map[string]interface{}{
+		"name": name,
+	}
+	req, err := newGetRequest(ctx, c.address+"/api/getupgradehistorybyname", params)
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.HistoryResponse{}
+	if err := doRpcCall(req, resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Close closes the idle connections to tim-server.
+func (c *Client) Close() error {
+	http.DefaultClient.CloseIdleConnections()
+	return nil
+}
+
+func (c *Client) getRpcCall(ctx context.Context, apiMethod string, params map[string]interface{}) (*api.Response, error) {
+	req, err := newGetRequest(ctx, c.address+apiMethod, params)
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.Response{}
+	if err := doRpcCall(req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) postRpcCall(ctx context.Context, apiMethod string, params map[string]interface{}) (*api.Response, error) {
+	req, err := newPostRequest(ctx, c.address+apiMethod, params)
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.Response{}
+	if err := doRpcCall(req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func newGetRequest(ctx context.Context, addr string, params map[string]interface{}) (*http.Request, error) {
 	p := ""
-	for k, v := range params {
-		if v != "" {
-			p += k + "=" + v.(string) + "&"
-		}
+	if values := formValues(params); len(values) > 0 {
+		p = "?" + values.Encode()
 	}
-	if p != "" {
-		p = "?" + strings.TrimSuffix(p, "&")
+	req, err := http.NewRequest(http.MethodGet, addr+p, nil)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+func newPostRequest(ctx context.Context, addr string, params map[string]interface{}) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, addr, strings.NewReader(formValues(params).Encode()))
+	if err != nil {
+		return nil, err
 	}
-	resp, err := http.Get("http://" + address + apiMethod + p)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req.WithContext(ctx), nil
+}
+
+// doRpcCall sends req and decodes the response body into respBody.
+func doRpcCall(req *http.Request, respBody interface{}) error {
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("get call failed, %v", err)
+		return fmt.Errorf("%s call failed, %v", strings.ToLower(req.Method), err)
 	}
-	return parseResponse(resp)
+	return parseResponse(resp, respBody)
 }
 
-func postRpcCall(apiMethod string, params map[string]interface{}) (*api.Response, error) {
+func formValues(params map[string]interface{}) url.Values {
 	values := url.Values{}
 	for k, v := range params {
 		if v != "" {
 			values.Set(k, v.(string))
 		}
 	}
-	resp, err := http.PostForm("http://"+address+apiMethod, values)
-	if err != nil {
-		return nil, fmt.Errorf("call failed, %v", err)
-	}
-	return parseResponse(resp)
+	return values
 }
 
-func parseResponse(resp *http.Response) (*api.Response, error) {
+func parseResponse(resp *http.Response, respBody interface{}) error {
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read failed, %v", err)
+		return fmt.Errorf("read failed, %v", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("call failed, %s, %s", resp.Status, body)
+	}
+
+	status := &struct {
+		Code int64  `json:"code"`
+		Msg  string `json:"msg"`
+	}{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return fmt.Errorf("jsonUnmarshal failed, %v", err)
+	}
+
+	if status.Code != 0 {
+		return fmt.Errorf("code not 0, %s", status.Msg)
 	}
 
-	respBody := &api.Response{}
 	if err := json.Unmarshal(body, respBody); err != nil {
-		return nil, fmt.Errorf("jsonUnmarshal failed, %v", err)
+		return fmt.Errorf("jsonUnmarshal failed, %v", err)
 	}
+	return nil
+}
 
-	if respBody.Code != 0 {
-		return nil, fmt.Errorf("code not 0, %s", respBody.Msg)
+// encodeStringMap encodes a map field of a tidb cluster, e.g. the config hashes
+// or the labels, as a json form value, it is empty if the map is.
+func encodeStringMap(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
 	}
-	return respBody, nil
+	data, _ := json.Marshal(m)
+	return string(data)
 }
@@ -0,0 +1,24 @@
+package compat
+
+// builtinMatrix is the compatibility matrix of the tidb-ansible upgrades,
+// the ansible versions are the ones required by the tidb-ansible playbooks.
+// The major version jumps are checked by MajorJump.
+const builtinMatrix = `
+rules:
+  - target: ">=v2.1.0"
+    ansible: ">=2.4.2"
+    level: warn
+    message: "upgrade ansible on the control machine, e.g. pip install ansible==2.4.2"
+  - target: ">=v3.0.0"
+    ansible: ">=2.5.0"
+    level: warn
+    message: "upgrade ansible on the control machine, e.g. pip install ansible==2.5.0"
+  - target: ">=v4.0.0"
+    ansible: ">=2.7.11"
+    message: "the tidb-ansible playbooks of v4.0 do not run on it, e.g. pip install ansible==2.7.11"
+`
+
+// Builtin returns the builtin compatibility matrix.
+func Builtin() (*Matrix, error) {
+	return Parse([]byte(builtinMatrix))
+}
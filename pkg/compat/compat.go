@@ -0,0 +1,214 @@
+package compat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/tidbops/tim/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Levels of a Rule.
+const (
+	// LevelBlock stops the upgrade if the rule is not met.
+	LevelBlock = "block"
+	// LevelWarn only warns if the rule is not met.
+	LevelWarn = "warn"
+)
+
+// Matrix is the compatibility matrix of the upgrade paths, every rule of a
+// target version must be met to upgrade to it.
+type Matrix struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Rule is a prerequisite of the target versions matching Target, the
+// constraints are comma separated version constraints which must all match,
+// e.g. ">=v3.0.0, <v4.0.0". An empty constraint is not checked.
+type Rule struct {
+	// Target are the target versions the rule applies to
+	Target string `yaml:"target"`
+	// From are the current versions allowed to upgrade from
+	From string `yaml:"from"`
+	// Ansible are the ansible versions of the control machine allowed
+	Ansible string `yaml:"ansible"`
+	// Level is block or warn, default block
+	Level string `yaml:"level"`
+	// Message tells how to meet the rule
+	Message string `yaml:"message"`
+}
+
+// Issue is a rule not met by an upgrade.
+type Issue struct {
+	Level   string
+	Message string
+}
+
+func (i *Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Level, i.Message)
+}
+
+// Parse parses a compatibility matrix in yaml or json.
+func Parse(data []byte) (*Matrix, error) {
+	m := &Matrix{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+
+	for i, r := range m.Rules {
+		if r.Target == "" {
+			return nil, fmt.Errorf("the target of rule %d is empty", i)
+		}
+		for _, c := range []string{r.Target, r.From, r.Ansible} {
+			if _, err := parseConstraints(c); err != nil {
+				return nil, fmt.Errorf("rule %d is invalid, %v", i, err)
+			}
+		}
+		switch r.Level {
+		case "":
+			r.Level = LevelBlock
+		case LevelBlock, LevelWarn:
+		default:
+			return nil, fmt.Errorf("the level %s of rule %d is invalid, support block / warn", r.Level, i)
+		}
+	}
+
+	return m, nil
+}
+
+// LoadFile loads a compatibility matrix file in yaml or json.
+func LoadFile(file string) (*Matrix, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse compatibility matrix %s failed, %v", file, err)
+	}
+	return m, nil
+}
+
+// Check returns the rules of the target version not met by the upgrade from
+// version from with the ansible version, an unknown ansible version is empty
+// and not checked. No rule applies to a target version not in vX.Y.Z format.
+func (m *Matrix) Check(from, target, ansible string) []*Issue {
+	tv, err := utils.ParseVersion(target)
+	if err != nil {
+		return nil
+	}
+	fv, _ := utils.ParseVersion(from)
+	av, _ := utils.ParseVersion(normalizeVersion(ansible))
+
+	issues := make([]*Issue, 0)
+	for _, r := range m.Rules {
+		if !matchConstraints(r.Target, tv) {
+			continue
+		}
+
+		if r.From != "" && fv != nil && !matchConstraints(r.From, fv) {
+			issues = append(issues, &Issue{
+				Level:   r.Level,
+				Message: ruleMessage(r, fmt.Sprintf("upgrading to %s requires the current version %s, got %s", target, r.From, from)),
+			})
+		}
+
+		if r.Ansible != "" && av != nil && !matchConstraints(normalizeConstraints(r.Ansible), av) {
+			issues = append(issues, &Issue{
+				Level:   r.Level,
+				Message: ruleMessage(r, fmt.Sprintf("%s requires ansible %s, got %s", target, r.Ansible, ansible)),
+			})
+		}
+	}
+
+	return issues
+}
+
+// MajorJump returns how many major versions the upgrade from version from to
+// target jumps, it is 0 if any version is not a release version.
+func MajorJump(from, target string) int64 {
+	fv, err := utils.ParseVersion(from)
+	if err != nil {
+		return 0
+	}
+	tv, err := utils.ParseVersion(target)
+	if err != nil {
+		return 0
+	}
+	return tv.Major - fv.Major
+}
+
+var ansibleVersionRegexp = regexp.MustCompile(`(\d+\.\d+(\.\d+)?)`)
+
+// ParseAnsibleVersion returns the version in the output of ansible --version,
+// e.g. "ansible 2.7.11" or "ansible [core 2.11.1]".
+func ParseAnsibleVersion(output string) string {
+	line := strings.SplitN(output, "\n", 2)[0]
+	return ansibleVersionRegexp.FindString(line)
+}
+
+func ruleMessage(r *Rule, msg string) string {
+	if r.Message == "" {
+		return msg
+	}
+	return msg + ", " + r.Message
+}
+
+func parseConstraints(constraints string) ([]*utils.VersionConstraint, error) {
+	var cs []*utils.VersionConstraint
+	for _, s := range strings.Split(normalizeConstraints(constraints), ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		c, err := utils.ParseVersionConstraint(s)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+func matchConstraints(constraints string, v *utils.Version) bool {
+	cs, err := parseConstraints(constraints)
+	if err != nil {
+		return false
+	}
+	for _, c := range cs {
+		if !c.Match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeConstraints makes the versions of constraints like >=2.5 the
+// vX.Y.Z format of utils.ParseVersion.
+func normalizeConstraints(constraints string) string {
+	parts := strings.Split(constraints, ",")
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		j := strings.IndexFunc(p, func(r rune) bool { return r == 'v' || (r >= '0' && r <= '9') })
+		if j < 0 {
+			continue
+		}
+		parts[i] = p[:j] + normalizeVersion(p[j:])
+	}
+	return strings.Join(parts, ",")
+}
+
+// normalizeVersion makes a version like 2.5 or 2.7.11 the vX.Y.Z format of
+// utils.ParseVersion.
+func normalizeVersion(version string) string {
+	if version == "" {
+		return ""
+	}
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if strings.Count(version, ".") == 1 {
+		version += ".0"
+	}
+	return "v" + version
+}
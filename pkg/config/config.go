@@ -0,0 +1,144 @@
+// Package config keeps the defaults of the tim flags in ~/.tim/config.yaml
+// and the TIM_* env, e.g. data-dir and TIM_DATA_DIR. A flag set on the command
+// line wins, then the env and then the config file.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/tidbops/tim/pkg/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// Keys are the flags whose defaults can be set, the global ones and the
+// ones of the commands, e.g. work-dir of upgrade.
+var Keys = []string{
+	"server",
+	"data-dir",
+	"ansible-repo-url",
+	"work-dir",
+	"proxy",
+	"log-level",
+	"log-format",
+	"notify-url",
+}
+
+// the sources of a default
+const (
+	SourceEnv  = "env"
+	SourceFile = "file"
+)
+
+// IsKey returns whether key is one of Keys.
+func IsKey(key string) bool {
+	for _, k := range Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvName returns the env of key, e.g. TIM_DATA_DIR of data-dir.
+func EnvName(key string) string {
+	return "TIM_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// DefaultFile returns the config file, TIM_CONFIG or ~/.tim/config.yaml.
+func DefaultFile() (string, error) {
+	if file := os.Getenv("TIM_CONFIG"); file != "" {
+		return file, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".tim", "config.yaml"), nil
+}
+
+// Load reads the settings of the config file, a missing file has none.
+func Load(file string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]string{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("parse config file %s failed, %v", file, err)
+	}
+	for key := range settings {
+		if !IsKey(key) {
+			return nil, fmt.Errorf("%s of config file %s is invalid, support %s", key, file, strings.Join(Keys, " / "))
+		}
+	}
+	return settings, nil
+}
+
+// Save writes the settings to the config file, only its owner can read it.
+func Save(file string, settings map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteToFile(string(data), file); err != nil {
+		return err
+	}
+	return os.Chmod(file, 0600)
+}
+
+// Lookup returns the default of key from the env or settings and its source,
+// it is not found if neither has it.
+func Lookup(key string, settings map[string]string) (string, string, bool) {
+	if value, ok := os.LookupEnv(EnvName(key)); ok && value != "" {
+		return value, SourceEnv, true
+	}
+	if value, ok := settings[key]; ok {
+		return value, SourceFile, true
+	}
+	return "", "", false
+}
+
+// ApplyDefaults sets the flags of Keys in fs not set on the command line to
+// their defaults of the env and the config file.
+func ApplyDefaults(fs *pflag.FlagSet) error {
+	file, err := DefaultFile()
+	if err != nil {
+		return err
+	}
+	settings, err := Load(file)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range Keys {
+		f := fs.Lookup(key)
+		if f == nil || f.Changed {
+			continue
+		}
+		value, source, ok := Lookup(key, settings)
+		if !ok {
+			continue
+		}
+		if err := fs.Set(key, value); err != nil {
+			if source == SourceEnv {
+				return fmt.Errorf("%s %s is invalid, %v", EnvName(key), value, err)
+			}
+			return fmt.Errorf("%s %s of config file %s is invalid, %v", key, value, file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bndr/gotabulate"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+const (
+	// backupMetaFile is the metadata file in a backup
+	backupMetaFile = "backup.json"
+	// backupTimeFormat is the format of the backup directory names
+	backupTimeFormat = "20060102-150405"
+)
+
+// backupFiles are the config files copied by a backup without --full.
+var backupFiles = []string{"conf", "inventory.ini", "hosts.ini"}
+
+type BackupCommandFlags struct {
+	Full bool
+	Tar  bool
+	List bool
+}
+
+var (
+	backupCmdFlags = &BackupCommandFlags{}
+)
+
+// backupMeta is the state of a tidb cluster when it is backed up.
+type backupMeta struct {
+	Name    string    `json:"name"`
+	Version string    `json:"version"`
+	Status  string    `json:"status"`
+	Path    string    `json:"path"`
+	Host    string    `json:"host"`
+	Full    bool      `json:"full"`
+	Time    time.Time `json:"time"`
+
+	// Location is where the backup is, it is not saved
+	Location string `json:"-"`
+}
+
+func NewBackupCommand() *cobra.Command {
+	backupCmd := &cobra.Command{
+		Use:   "backup <name>",
+		Short: "backup the config files of a tidb cluster to ~/.tim/backups",
+		Args:  exactArgs(1),
+		RunE:  backupCommandFunc,
+	}
+
+	backupCmd.Flags().BoolVar(&backupCmdFlags.Full, "full", false,
+		"backup the whole tidb-ansible directory instead of conf, inventory.ini and hosts.ini")
+	backupCmd.Flags().BoolVar(&backupCmdFlags.Tar, "tar", false, "archive the backup as a tar.gz file")
+	backupCmd.Flags().BoolVar(&backupCmdFlags.List, "list", false, "list the backups of the tidb cluster")
+
+	return backupCmd
+}
+
+func backupCommandFunc(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	if backupCmdFlags.List {
+		backups, err := listBackups(name)
+		if err != nil {
+			return err
+		}
+		cmd.Println(getBackupsTableString(backups))
+		return nil
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	if tc.Host != strings.ToLower(getHostName()) {
+		return fmt.Errorf("%s tidb-ansible files not on this node, you should login to %s to operate tidb cluster",
+			tc.Name, tc.Host)
+	}
+
+	location, err := createBackup(tc, backupCmdFlags.Full, backupCmdFlags.Tar)
+	if err != nil {
+		return fmt.Errorf("backup %s failed, %v", tc.Name, err)
+	}
+
+	cmd.Printf("Success! %s backed up to %s\n", tc.Name, location)
+
+	return nil
+}
+
+// backupsDir returns the directory of the backups of a tidb cluster.
+func backupsDir(name string) (string, error) {
+	home, err := timHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "backups", name), nil
+}
+
+// createBackup copies the config files of tc, or the whole tidb-ansible
+// directory with full, to a timestamped directory in backupsDir and returns
+// the location of the backup.
+func createBackup(tc *models.TiDBCluster, full bool, archive bool) (string, error) {
+	dir, err := backupsDir(tc.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	location := filepath.Join(dir, now.Format(backupTimeFormat))
+	if utils.FileExists(location) || utils.FileExists(location+".tar.gz") {
+		return "", fmt.Errorf("backup %s already exists", location)
+	}
+
+	if full {
+		if err := utils.CopyDir(tc.Path, location); err != nil {
+			return "", err
+		}
+	} else {
+		if err := os.MkdirAll(location, 0755); err != nil {
+			return "", err
+		}
+		if err := copyBackupFiles(tc.Path, location); err != nil {
+			os.RemoveAll(location)
+			return "", err
+		}
+	}
+
+	meta := &backupMeta{
+		Name:    tc.Name,
+		Version: tc.Version,
+		Status:  tc.Status,
+		Path:    tc.Path,
+		Host:    tc.Host,
+		Full:    full,
+		Time:    now,
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		os.RemoveAll(location)
+		return "", err
+	}
+	if err := utils.WriteToFile(string(data), filepath.Join(location, backupMetaFile)); err != nil {
+		os.RemoveAll(location)
+		return "", err
+	}
+
+	if !archive {
+		return location, nil
+	}
+
+	if err := utils.TarGz(location, location+".tar.gz"); err != nil {
+		os.RemoveAll(location)
+		return "", err
+	}
+
+	if err := os.RemoveAll(location); err != nil {
+		return "", err
+	}
+
+	return location + ".tar.gz", nil
+}
+
+// copyBackupFiles copies backupFiles in src to dist, a missing hosts.ini is
+// skipped.
+func copyBackupFiles(src, dist string) error {
+	for _, f := range backupFiles {
+		srcFile := filepath.Join(src, f)
+		fi, err := os.Stat(srcFile)
+		if os.IsNotExist(err) && f == "hosts.ini" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			err = utils.CopyDir(srcFile, filepath.Join(dist, f))
+		} else {
+			err = utils.CopyFile(srcFile, filepath.Join(dist, f))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listBackups returns the backups of a tidb cluster sorted by time.
+func listBackups(name string) ([]*backupMeta, error) {
+	dir, err := backupsDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]*backupMeta, 0, len(entries))
+	for _, entry := range entries {
+		location := filepath.Join(dir, entry.Name())
+		meta, err := readBackupMeta(location)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, meta)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.Before(backups[j].Time)
+	})
+
+	return backups, nil
+}
+
+// readBackupMeta reads the metadata of a backup directory or tar.gz file.
+func readBackupMeta(location string) (*backupMeta, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if strings.HasSuffix(location, ".tar.gz") {
+		data, err = utils.ReadTarGzFile(location, backupMetaFile)
+	} else {
+		data, err = ioutil.ReadFile(filepath.Join(location, backupMetaFile))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a tim backup, %v", location, err)
+	}
+
+	meta := &backupMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("%s is not a tim backup, %v", location, err)
+	}
+	meta.Location = location
+
+	return meta, nil
+}
+
+func getBackupsTableString(backups []*backupMeta) string {
+	var arr [][]string
+	for _, b := range backups {
+		arr = append(arr, []string{b.Time.Format("2006-01-02 15:04:05"), b.Version, b.Status,
+			fmt.Sprintf("%v", b.Full), b.Location})
+	}
+	if len(arr) == 0 {
+		return "no backups found"
+	}
+	t := gotabulate.Create(arr)
+	t.SetHeaders([]string{"Time", "Version", "Status", "Full", "Location"})
+	t.SetAlign("right")
+	return t.Render("grid")
+}
@@ -0,0 +1,163 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/parser"
+	tyaml "github.com/tidbops/tim/pkg/yaml"
+	yaml "gopkg.in/mikefarah/yaml.v2"
+)
+
+type CheckRuleCommandFlags struct {
+	Component string
+	Sample    string
+}
+
+var (
+	checkRuleCmdFlags = &CheckRuleCommandFlags{}
+)
+
+func NewCheckRuleCommand() *cobra.Command {
+	checkRuleCmd := &cobra.Command{
+		Use:   "check-rule <rule-file>",
+		Short: "check a rule file and show the keys it adds, deletes and renames, no tidb cluster is changed",
+		Args:  exactArgs(1),
+		RunE:  checkRuleCommandFunc,
+	}
+
+	checkRuleCmd.Flags().StringVar(&checkRuleCmdFlags.Component, "component", "tikv",
+		"the component of the rules to check, support "+supportedComponents())
+	checkRuleCmd.Flags().StringVar(&checkRuleCmdFlags.Sample, "sample", "",
+		"the sample config the delete paths must exist in, the changes of the rules to it are shown")
+
+	return checkRuleCmd
+}
+
+func checkRuleCommandFunc(cmd *cobra.Command, args []string) error {
+	ruleFile := args[0]
+	component := checkRuleCmdFlags.Component
+	if _, ok := configFilePaths[component]; !ok {
+		return fmt.Errorf("component %s is invalid, support %s", component, supportedComponents())
+	}
+	if checkRuleCmdFlags.Sample != "" {
+		if err := validateConfigFile(checkRuleCmdFlags.Sample); err != nil {
+			return err
+		}
+	}
+
+	rules, err := parseComponentRules(ruleFile, component)
+	if err != nil {
+		return err
+	}
+
+	added := rulePaths(rules.New.Config, "")
+	cmd.Printf("The %s rules of %s:\n", component, ruleFile)
+	for _, path := range added {
+		cmd.Printf("  add %s\n", path)
+	}
+	for _, path := range rules.Delete.Delete {
+		cmd.Printf("  delete %s\n", path)
+	}
+	for _, r := range renamePaths(rules.Rename) {
+		cmd.Printf("  rename %s to %s\n", r.From, r.To)
+	}
+
+	if checkRuleCmdFlags.Sample != "" {
+		if err := checkRulesWithSample(cmd, checkRuleCmdFlags.Sample, component, rules); err != nil {
+			return err
+		}
+	}
+
+	cmd.Printf("%s is valid, %d keys added, %d deleted, %d renamed\n",
+		ruleFile, len(added), len(rules.Delete.Delete), len(rules.Rename.Rename))
+	return nil
+}
+
+// parseComponentRules parses the rules of component of the rule file, the
+// rules of a plain rule file are the ones of component.
+func parseComponentRules(ruleFile string, component string) (*parser.Rules, error) {
+	p := parser.NewParser()
+	multi, err := p.IsMultiComponent(ruleFile, configComponents)
+	if err != nil {
+		return nil, fmt.Errorf("rule file %s is invalid, %v", ruleFile, err)
+	}
+
+	if !multi {
+		rules, err := p.Parse(ruleFile)
+		if err != nil {
+			return nil, fmt.Errorf("rule file %s is invalid, %v", ruleFile, err)
+		}
+		return rules, nil
+	}
+
+	all, err := p.ParseMulti(ruleFile, configComponents)
+	if err != nil {
+		return nil, fmt.Errorf("rule file %s is invalid, %v", ruleFile, err)
+	}
+	rules, ok := all[component]
+	if !ok {
+		return nil, fmt.Errorf("%s has no %s rules", ruleFile, component)
+	}
+	return rules, nil
+}
+
+// rulePaths returns the paths of the leaves of the new rules in the format of
+// the rule files, a key containing dots is quoted.
+func rulePaths(rules yaml.MapSlice, prefix string) []string {
+	var paths []string
+	for _, item := range rules {
+		key := fmt.Sprintf("%v", item.Key)
+		if strings.Contains(key, ".") {
+			key = fmt.Sprintf("%q", key)
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if m, ok := item.Value.(yaml.MapSlice); ok && len(m) > 0 {
+			paths = append(paths, rulePaths(m, key)...)
+			continue
+		}
+		paths = append(paths, key)
+	}
+	return paths
+}
+
+// checkRulesWithSample checks the delete paths of the rules exist in the
+// sample config and shows the changes the rules make to it, a rename path not
+// found is warned as the upgrade does.
+func checkRulesWithSample(cmd *cobra.Command, sample string, component string, rules *parser.Rules) error {
+	missing, err := tyaml.MissingPaths(sample, rules.Delete.Delete)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("delete paths %s not found in %s", strings.Join(missing, ", "), sample)
+	}
+
+	tmpPath, err := ioutil.TempDir("", "tim-check-rule")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	_, target, err := generateConfigByRuleFile(sample, tmpPath, component, rules)
+	if err != nil {
+		return fmt.Errorf("generate %s config from %s failed, %v", component, sample, err)
+	}
+	diffStr, err := tyaml.Diff(sample, target, isTerminalFile(os.Stdout))
+	if err != nil {
+		return err
+	}
+	if len(diffStr) == 0 {
+		cmd.Printf("The rules do not change %s\n", sample)
+		return nil
+	}
+	cmd.Printf("The rules change %s:\n", sample)
+	cmd.Println(diffStr)
+	return nil
+}
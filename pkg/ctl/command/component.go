@@ -0,0 +1,172 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// component is a tidb component whose config file in the conf directory of
+// tidb-ansible is managed by tim.
+type component struct {
+	Name string
+	// ConfigFileName is the name of the default config file in the conf of
+	// the tidb-ansible repo
+	ConfigFileName string
+	// ConfigPath is the path of the config file in the conf of the
+	// tidb-ansible files of a tidb cluster, e.g. pd/pd.yml, ConfigFileName if
+	// it is empty. --config-paths overrides it.
+	ConfigPath string
+	// RawURLTemplate is formatted with the repo url, the version and
+	// ConfigFileName to get the raw url of the default config file
+	RawURLTemplate string
+}
+
+// configURL returns the raw url of the default config file in version.
+func (c *component) configURL(repoURL string, version string) string {
+	return fmt.Sprintf(c.RawURLTemplate, strings.TrimSuffix(repoURL, "/"), version, c.ConfigFileName)
+}
+
+// components is the registry of the components whose configs are upgraded,
+// in the order they are prepared, compared and generated. A new component
+// only needs an entry here.
+var components = []*component{
+	{Name: "tikv", ConfigFileName: "tikv.yml", RawURLTemplate: rawConfigURL},
+	{Name: "pd", ConfigFileName: "pd.yml", RawURLTemplate: rawConfigURL},
+	{Name: "tidb", ConfigFileName: "tidb.yml", RawURLTemplate: rawConfigURL},
+}
+
+var (
+	configComponents = componentNames()
+	// configFilePaths are the paths of the config files of the components in
+	// conf, with the overrides of --config-paths
+	configFilePaths = componentConfigPaths(nil)
+)
+
+// getComponent returns the registered component of name.
+func getComponent(name string) (*component, bool) {
+	for _, c := range components {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func componentNames() []string {
+	names := make([]string, 0, len(components))
+	for _, c := range components {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// componentConfigPaths returns the paths of the config files of the
+// components in conf, the ones of overrides replace the registered ones.
+func componentConfigPaths(overrides map[string]string) map[string]string {
+	paths := make(map[string]string, len(components))
+	for _, c := range components {
+		switch {
+		case overrides[c.Name] != "":
+			paths[c.Name] = overrides[c.Name]
+		case c.ConfigPath != "":
+			paths[c.Name] = c.ConfigPath
+		default:
+			paths[c.Name] = c.ConfigFileName
+		}
+	}
+	return paths
+}
+
+// parseConfigPaths parses the comma separated component=path pairs of
+// --config-paths, a path is relative to conf and stays in it.
+func parseConfigPaths(s string) (map[string]string, error) {
+	paths := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("config path %s is invalid, it should be component=path", pair)
+		}
+		name, path := strings.TrimSpace(kv[0]), filepath.Clean(strings.TrimSpace(kv[1]))
+		if _, ok := getComponent(name); !ok {
+			return nil, fmt.Errorf("component %s of config path %s is invalid, support %s", name, pair, supportedComponents())
+		}
+		if filepath.IsAbs(path) || path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("config path %s is invalid, the path must be in conf, e.g. pd/pd.yml", pair)
+		}
+		paths[name] = path
+	}
+	return paths, nil
+}
+
+// ApplyConfigPaths sets the config file paths of the components by the
+// --config-paths flag of cmd, the registered ones are used without it.
+func ApplyConfigPaths(cmd *cobra.Command) error {
+	s, err := cmd.Flags().GetString("config-paths")
+	if err != nil {
+		s = ""
+	}
+
+	overrides, err := parseConfigPaths(s)
+	if err != nil {
+		return err
+	}
+	configFilePaths = componentConfigPaths(overrides)
+	return nil
+}
+
+// allComponents selects all the registered components in a --component list.
+const allComponents = "all"
+
+// parseComponents returns the registered components of the comma separated
+// list s in the registry order, all or an empty s selects all of them.
+func parseComponents(s string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == allComponents:
+			return configComponents, nil
+		default:
+			if _, ok := getComponent(name); !ok {
+				return nil, fmt.Errorf("component %s is invalid, support %s / %s", name, supportedComponents(), allComponents)
+			}
+			selected[name] = true
+		}
+	}
+	if len(selected) == 0 {
+		return configComponents, nil
+	}
+
+	names := make([]string, 0, len(selected))
+	for _, c := range configComponents {
+		if selected[c] {
+			names = append(names, c)
+		}
+	}
+	return names, nil
+}
+
+// selectsAllComponents returns whether the --component list s selects all the
+// components rather than lists them.
+func selectsAllComponents(s string) bool {
+	for _, name := range strings.Split(s, ",") {
+		if strings.TrimSpace(name) == allComponents {
+			return true
+		}
+	}
+	return strings.TrimSpace(s) == ""
+}
+
+// supportedComponents returns the component names for the flag usages and
+// the error messages, e.g. "tikv / pd / tidb".
+func supportedComponents() string {
+	return strings.Join(configComponents, " / ")
+}
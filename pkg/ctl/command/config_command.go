@@ -0,0 +1,144 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/config"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+func NewConfigCommand() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "set or get the defaults of the flags in ~/.tim/config.yaml, support " + strings.Join(config.Keys, " / "),
+	}
+
+	configCmd.AddCommand(
+		&cobra.Command{
+			Use:   "set <key> <value>",
+			Short: "set the default of the flag key, the flag and the TIM_* env of key still override it",
+			Args:  exactArgs(2),
+			RunE:  configSetCommandFunc,
+		},
+		&cobra.Command{
+			Use:   "get [key]",
+			Short: "print the default of the flag key, or all the defaults set, from the TIM_* env or the config file",
+			Args:  cobra.MaximumNArgs(1),
+			RunE:  configGetCommandFunc,
+		},
+		&cobra.Command{
+			Use:   "unset <key>",
+			Short: "remove the default of the flag key from the config file",
+			Args:  exactArgs(1),
+			RunE:  configUnsetCommandFunc,
+		},
+	)
+
+	return configCmd
+}
+
+func configSetCommandFunc(cmd *cobra.Command, args []string) error {
+	key, value := args[0], args[1]
+	if err := checkConfigKey(key); err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("the value of %s is empty, use config unset to remove it", key)
+	}
+	if key == "proxy" {
+		if _, err := utils.ParseProxyURL(value); err != nil {
+			return err
+		}
+	}
+
+	file, settings, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	settings[key] = value
+	if err := config.Save(file, settings); err != nil {
+		return fmt.Errorf("save config file %s failed, %v", file, err)
+	}
+
+	cmd.Printf("Success! %s=%s is set in %s\n", key, value, file)
+	return nil
+}
+
+func configGetCommandFunc(cmd *cobra.Command, args []string) error {
+	keys := config.Keys
+	if len(args) > 0 {
+		if err := checkConfigKey(args[0]); err != nil {
+			return err
+		}
+		keys = args[:1]
+	}
+
+	_, settings, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		value, source, ok := config.Lookup(key, settings)
+		if !ok {
+			if len(args) > 0 {
+				return fmt.Errorf("%s is not set", key)
+			}
+			continue
+		}
+		if len(args) > 0 {
+			cmd.Println(value)
+			continue
+		}
+		if source == config.SourceEnv {
+			cmd.Printf("%s=%s (%s)\n", key, value, config.EnvName(key))
+			continue
+		}
+		cmd.Printf("%s=%s\n", key, value)
+	}
+	return nil
+}
+
+func configUnsetCommandFunc(cmd *cobra.Command, args []string) error {
+	key := args[0]
+	if err := checkConfigKey(key); err != nil {
+		return err
+	}
+
+	file, settings, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	if _, ok := settings[key]; !ok {
+		return fmt.Errorf("%s is not set in %s", key, file)
+	}
+	delete(settings, key)
+	if err := config.Save(file, settings); err != nil {
+		return fmt.Errorf("save config file %s failed, %v", file, err)
+	}
+
+	cmd.Printf("Success! %s is removed from %s\n", key, file)
+	return nil
+}
+
+func checkConfigKey(key string) error {
+	if !config.IsKey(key) {
+		return fmt.Errorf("%s is invalid, support %s", key, strings.Join(config.Keys, " / "))
+	}
+	return nil
+}
+
+// loadConfigFile returns the config file and its settings.
+func loadConfigFile() (string, map[string]string, error) {
+	file, err := config.DefaultFile()
+	if err != nil {
+		return "", nil, err
+	}
+	settings, err := config.Load(file)
+	if err != nil {
+		return "", nil, err
+	}
+	return file, settings, nil
+}
@@ -0,0 +1,188 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/inventory"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type CreateCommandFlags struct {
+	Path        string
+	Version     string
+	Description string
+	SSHAddress  string
+	SSHKey      string
+	// Force replaces the tidb cluster of the same name
+	Force bool
+}
+
+var (
+	createCmdFlags = &CreateCommandFlags{}
+)
+
+func NewCreateCommand() *cobra.Command {
+	createCmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "register an existing tidb cluster deployed by tidb-ansible",
+		Args:  exactArgs(1),
+		RunE:  createCommandFunc,
+	}
+
+	createCmd.Flags().StringVar(&createCmdFlags.Path, "path", "", "path specifies the storage path of the tidb-ansible file, required")
+	createCmd.Flags().StringVar(&createCmdFlags.Version, "tidb-version", "", "version specifies the tidb version of the cluster, required")
+	createCmd.Flags().StringVar(&createCmdFlags.Description, "desc", "", "description of the tidb cluster")
+	createCmd.Flags().StringVar(&createCmdFlags.SSHAddress, "ssh-address", "",
+		"[user@]host[:port] of the remote host the tidb-ansible files in path are read from over ssh, only diff and status support it")
+	createCmd.Flags().StringVar(&createCmdFlags.SSHKey, "ssh-key", "", "the identity file to login the ssh-address with")
+	createCmd.Flags().BoolVar(&createCmdFlags.Force, "force", false,
+		"replace the tidb cluster of the same name, its id, init time and labels are kept and the other fields reset")
+
+	return createCmd
+}
+
+func createCommandFunc(cmd *cobra.Command, args []string) error {
+	if createCmdFlags.Path == "" {
+		cmd.Println(cmd.UsageString())
+		return errors.New("path flag is required")
+	}
+
+	if createCmdFlags.Version == "" {
+		cmd.Println(cmd.UsageString())
+		return errors.New("tidb-version flag is required")
+	}
+
+	if createCmdFlags.SSHAddress == "" && createCmdFlags.SSHKey != "" {
+		return errors.New("ssh-key requires ssh-address")
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := newTiDBClusterFromFlags(ctx, args[0], createCmdFlags)
+	if err != nil {
+		return err
+	}
+
+	name := args[0]
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	old, err := cli.GetTiDBClusterByName(ctx, name)
+	switch {
+	case err != nil:
+		err = cli.CreateTiDBCluster(ctx, tc)
+	case !createCmdFlags.Force:
+		return fmt.Errorf("%s tidb cluster already exists, use --force to replace it", name)
+	case !containsString(idleStatuses, old.Status):
+		// the upgrade state would be lost
+		return fmt.Errorf("%s is in status %s, finish or rollback the upgrade before replacing it", name, old.Status)
+	default:
+		log.Warnf("replace the tidb cluster %s of %s at %s:%s", name, old.Version, old.Host, old.Path)
+		err = cli.UpsertTiDBCluster(ctx, tc)
+	}
+	if err != nil {
+		return fmt.Errorf("store tidb cluster information failed, %v", err)
+	}
+
+	tc, err = cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	cmd.Println(GetTiDBClustersTableString([]*models.TiDBCluster{tc}))
+
+	return nil
+}
+
+// newTiDBClusterFromFlags returns the tidb cluster name of the flags,
+// the inventory.ini of a remote one is read over ssh and its host is the
+// remote host, so the commands changing the files refuse to run here.
+func newTiDBClusterFromFlags(ctx context.Context, name string, flags *CreateCommandFlags) (*models.TiDBCluster, error) {
+	if flags.SSHAddress == "" {
+		path, err := filepath.Abs(flags.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !utils.FileExists(path) {
+			return nil, fmt.Errorf("path %s not exist", path)
+		}
+
+		if !utils.FileExists(filepath.Join(path, "inventory.ini")) {
+			return nil, fmt.Errorf("inventory.ini not found in %s, it is not a tidb-ansible directory", path)
+		}
+
+		inv, err := loadInventory(path)
+		if err != nil {
+			return nil, err
+		}
+		return newTiDBCluster(name, flags.Version, path, flags.Description, inv), nil
+	}
+
+	key := flags.SSHKey
+	if key != "" {
+		var err error
+		if key, err = filepath.Abs(key); err != nil {
+			return nil, err
+		}
+	}
+	target, err := utils.ParseSSHAddress(flags.SSHAddress, key)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(flags.Path) {
+		return nil, fmt.Errorf("path %s of %s must be absolute", flags.Path, target)
+	}
+
+	tc := &models.TiDBCluster{
+		Path:       filepath.Clean(flags.Path),
+		SSHAddress: target.String(),
+		SSHKey:     key,
+	}
+	path, cleanup, err := clusterFilesPath(ctx, tc)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	if !utils.FileExists(filepath.Join(path, "inventory.ini")) {
+		return nil, fmt.Errorf("inventory.ini not found in %s, it is not a tidb-ansible directory",
+			clusterFileLabel(tc, ""))
+	}
+
+	inv, err := loadInventory(path)
+	if err != nil {
+		return nil, err
+	}
+	remote := newTiDBCluster(name, flags.Version, tc.Path, flags.Description, inv)
+	remote.Host = target.Host
+	remote.SSHAddress = tc.SSHAddress
+	remote.SSHKey = tc.SSHKey
+	return remote, nil
+}
+
+// newTiDBCluster returns a running tidb cluster deployed by the tidb-ansible
+// files in path of this node.
+func newTiDBCluster(name, version, path, desc string, inv *inventory.Inventory) *models.TiDBCluster {
+	return &models.TiDBCluster{
+		Name:        name,
+		Version:     version,
+		Path:        path,
+		Description: desc,
+		InitTime:    time.Now(),
+		Host:        getHostName(),
+		Hosts:       inv.AllAddresses(),
+		Status:      models.TiDBRunning,
+	}
+}
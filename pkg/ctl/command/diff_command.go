@@ -0,0 +1,130 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/utils"
+	tyaml "github.com/tidbops/tim/pkg/yaml"
+)
+
+type DiffCommandFlags struct {
+	Component string
+	Against   string
+	NoCache   bool
+}
+
+var (
+	diffCmdFlags = &DiffCommandFlags{}
+)
+
+func NewDiffCommand() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff <name>",
+		Short: "show the changes of a tidb cluster config from the default config of its version",
+		Args:  exactArgs(1),
+		RunE:  diffCommandFunc,
+	}
+
+	diffCmd.Flags().StringVar(&diffCmdFlags.Component, "component", allComponents,
+		"the comma separated component configs to compare, support "+supportedComponents()+" / all")
+	diffCmd.Flags().StringVar(&diffCmdFlags.Against, "against", "",
+		"compare with the default config of the version instead of the cluster version")
+	diffCmd.Flags().BoolVar(&diffCmdFlags.NoCache, "no-cache", false,
+		"download the default config file again even if it is cached")
+
+	return diffCmd
+}
+
+func diffCommandFunc(cmd *cobra.Command, args []string) error {
+	components, err := parseComponents(diffCmdFlags.Component)
+	if err != nil {
+		return err
+	}
+
+	name := args[0]
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	version := tc.Version
+	if diffCmdFlags.Against != "" {
+		version = diffCmdFlags.Against
+	}
+
+	tmpPath, err := ioutil.TempDir("", "tim-diff")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	path, cleanup, err := clusterFilesPath(ctx, tc)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	src := &configSource{
+		RepoURL: getAnsibleRepoURL(cmd),
+		NoCache: diffCmdFlags.NoCache,
+	}
+	// a component of all without a config file is skipped, a listed one must
+	// have it
+	all := selectsAllComponents(diffCmdFlags.Component)
+	for _, component := range components {
+		currentFile := filepath.Join(path, "conf", configFilePaths[component])
+		label := clusterFileLabel(tc, filepath.Join("conf", configFilePaths[component]))
+		if all && !utils.FileExists(currentFile) {
+			log.Infof("%s not found, skip %s config", label, component)
+			continue
+		}
+		if err := diffComponentConfig(ctx, cmd, src, tmpPath, version, component, currentFile, label); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// diffComponentConfig prints the changes of currentFile, shown as label, from
+// the default config of component in version.
+func diffComponentConfig(ctx context.Context, cmd *cobra.Command, src *configSource, tmpPath string,
+	version string, component string, currentFile string, label string) error {
+	if err := validateConfigFile(currentFile); err != nil {
+		return err
+	}
+
+	defaultFile := filepath.Join(tmpPath, fmt.Sprintf("%s-%s.yml", version, component))
+	if err := fetchConfigFile(ctx, src, version, component, defaultFile); err != nil {
+		return fmt.Errorf("prepare config file failed, %v", err)
+	}
+
+	diffStr, err := tyaml.Diff(defaultFile, currentFile, isTerminalFile(os.Stdout))
+	if err != nil {
+		return fmt.Errorf("compare %s %s failed, %v", defaultFile, label, err)
+	}
+
+	if len(diffStr) == 0 {
+		cmd.Printf("%s is the same as the default %s config of %s\n", label, component, version)
+		return nil
+	}
+
+	cmd.Printf("Changes of %s from the default %s config of %s:\n", label, component, version)
+	cmd.Println(diffStr)
+	return nil
+}
@@ -0,0 +1,291 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/compat"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type DoctorCommandFlags struct {
+	TargetVersion string
+	WorkDir       string
+}
+
+var (
+	doctorCmdFlags = &DoctorCommandFlags{}
+)
+
+// the results of the doctor checks
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// doctorCheck is a check of the environment of tim, a failed critical one
+// fails the doctor command, the others are only warned.
+type doctorCheck struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context, cmd *cobra.Command) *checkResult
+}
+
+// checkResult is the result of a doctor check, Hint tells how to fix a failed
+// or warned one.
+type checkResult struct {
+	Status string
+	Detail string
+	Hint   string
+}
+
+func passCheck(format string, args ...interface{}) *checkResult {
+	return &checkResult{Status: checkPass, Detail: fmt.Sprintf(format, args...)}
+}
+
+func NewDoctorCommand() *cobra.Command {
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "check the store, the network, ansible and the work dir tim upgrades with",
+		Args:  exactArgs(0),
+		RunE:  doctorCommandFunc,
+	}
+
+	doctorCmd.Flags().StringVar(&doctorCmdFlags.TargetVersion, "target-version", "",
+		"check the ansible version against the compatibility matrix of the version, default the versions of the tidb clusters")
+	doctorCmd.Flags().StringVar(&doctorCmdFlags.WorkDir, "work-dir", filepath.Join(os.TempDir(), "tim"),
+		"the work dir of the upgrades to check")
+
+	return doctorCmd
+}
+
+func doctorCommandFunc(cmd *cobra.Command, args []string) error {
+	if doctorCmdFlags.TargetVersion != "" {
+		if _, err := utils.ParseVersion(doctorCmdFlags.TargetVersion); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	checks := []*doctorCheck{
+		{Name: "store", Critical: true, Run: checkStore},
+		{Name: "ansible repo", Run: checkAnsibleRepo},
+		{Name: "git", Critical: true, Run: checkGit},
+		{Name: "ansible-playbook", Critical: true, Run: checkAnsiblePlaybook},
+		{Name: "work dir", Critical: true, Run: checkWorkDir},
+	}
+
+	failed, warned := 0, 0
+	for _, c := range checks {
+		r := c.Run(ctx, cmd)
+		if r.Status == checkFail && !c.Critical {
+			r.Status = checkWarn
+		}
+		cmd.Printf("[%s] %s: %s\n", r.Status, c.Name, r.Detail)
+		if r.Status != checkPass && r.Hint != "" {
+			cmd.Printf("       hint: %s\n", r.Hint)
+		}
+		switch r.Status {
+		case checkFail:
+			failed++
+		case checkWarn:
+			warned++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	if warned > 0 {
+		cmd.Printf("The critical checks passed, %d warned\n", warned)
+		return nil
+	}
+	cmd.Println("All checks passed")
+	return nil
+}
+
+// checkStore checks the tidb clusters can be loaded from the store, and the
+// local database can be written.
+func checkStore(ctx context.Context, cmd *cobra.Command) *checkResult {
+	cli, err := genClient(cmd)
+	if err != nil {
+		return &checkResult{Status: checkFail, Detail: fmt.Sprintf("init client failed, %v", err),
+			Hint: "check --server, or --data-dir and the permissions of its tim.db"}
+	}
+	defer cli.Close()
+
+	tcs, err := cli.LoadTiDBClusters(ctx)
+	if err != nil {
+		return &checkResult{Status: checkFail, Detail: fmt.Sprintf("load the tidb clusters failed, %v", err),
+			Hint: "check the tim-server of --server is running, or the tim.db of --data-dir is not corrupted"}
+	}
+
+	if addr, err := cmd.Flags().GetString("server"); err == nil && addr != "" {
+		return passCheck("tim-server %s, %d tidb clusters", addr, len(tcs))
+	}
+
+	dir := "."
+	if d, err := cmd.Flags().GetString("data-dir"); err == nil && d != "" {
+		dir = d
+	}
+	file, _ := filepath.Abs(filepath.Join(dir, models.DefaultDataFile))
+	if err := checkWritable(dir, file); err != nil {
+		return &checkResult{Status: checkFail, Detail: fmt.Sprintf("%s is not writable, %v", file, err),
+			Hint: "run tim as the owner of the data dir or use a writable --data-dir"}
+	}
+	return passCheck("%s, %d tidb clusters", file, len(tcs))
+}
+
+// checkAnsibleRepo downloads a config file of the ansible repo url through the
+// proxy of the downloads.
+func checkAnsibleRepo(ctx context.Context, cmd *cobra.Command) *checkResult {
+	repoURL := getAnsibleRepoURL(cmd)
+	tmpFile, err := ioutil.TempFile("", "tim-doctor")
+	if err != nil {
+		return &checkResult{Status: checkFail, Detail: err.Error(), Hint: "check the temp dir is writable"}
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	// a failed check is reported at once
+	retries := utils.DownloadRetries
+	utils.DownloadRetries = 0
+	defer func() { utils.DownloadRetries = retries }()
+
+	url := fmt.Sprintf(rawConfigURL, repoURL, "master", configFilePaths["tikv"])
+	if err := utils.DownloadFile(ctx, url, tmpFile.Name()); err != nil {
+		return &checkResult{Status: checkFail, Detail: err.Error(),
+			Hint: "check the network, set --proxy or the HTTPS_PROXY env, or a reachable --ansible-repo-url, " +
+				"only the default configs cached in ~/.tim/cache can be used"}
+	}
+	return passCheck("%s is reachable", repoURL)
+}
+
+// checkGit checks git is on PATH to clone the tidb-ansible files.
+func checkGit(ctx context.Context, cmd *cobra.Command) *checkResult {
+	out, err := exec.CommandContext(ctx, "git", "--version").Output()
+	if err != nil {
+		return &checkResult{Status: checkFail, Detail: fmt.Sprintf("run git --version failed, %v", err),
+			Hint: "install git to clone the tidb-ansible files, e.g. yum install git"}
+	}
+	return passCheck("%s", strings.TrimSpace(string(out)))
+}
+
+// checkAnsiblePlaybook checks ansible-playbook is on PATH and its version meets
+// the compatibility matrix of the target versions.
+func checkAnsiblePlaybook(ctx context.Context, cmd *cobra.Command) *checkResult {
+	out, err := exec.CommandContext(ctx, "ansible-playbook", "--version").Output()
+	if err != nil {
+		return &checkResult{Status: checkFail, Detail: fmt.Sprintf("run ansible-playbook --version failed, %v", err),
+			Hint: "install ansible on the control machine, e.g. pip install ansible==2.7.11"}
+	}
+	version := compat.ParseAnsibleVersion(string(out))
+	if version == "" {
+		return &checkResult{Status: checkWarn, Detail: "the version of ansible-playbook is unknown",
+			Hint: "check ansible-playbook --version prints the version of ansible"}
+	}
+
+	versions, err := doctorTargetVersions(ctx, cmd)
+	if err != nil {
+		return &checkResult{Status: checkWarn, Detail: fmt.Sprintf("ansible %s, the target versions are unknown, %v", version, err),
+			Hint: "set --target-version to check the ansible version"}
+	}
+	m, err := compat.Builtin()
+	if err != nil {
+		return &checkResult{Status: checkFail, Detail: err.Error()}
+	}
+
+	r := passCheck("ansible %s", version)
+	for _, target := range versions {
+		for _, issue := range m.Check("", target, version) {
+			status := checkWarn
+			if issue.Level != compat.LevelWarn {
+				status = checkFail
+			}
+			if r.Status != checkFail {
+				r.Status = status
+			}
+			r.Detail += "; " + issue.Message
+		}
+	}
+	if r.Status != checkPass {
+		r.Hint = "upgrade ansible before upgrading the tidb clusters to the versions"
+	}
+	return r
+}
+
+// doctorTargetVersions returns --target-version, or the versions of the tidb
+// clusters in the store.
+func doctorTargetVersions(ctx context.Context, cmd *cobra.Command) ([]string, error) {
+	if doctorCmdFlags.TargetVersion != "" {
+		return []string{doctorCmdFlags.TargetVersion}, nil
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	tcs, err := cli.LoadTiDBClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(tcs))
+	versions := make([]string, 0, len(tcs))
+	for _, tc := range tcs {
+		if !seen[tc.Version] {
+			seen[tc.Version] = true
+			versions = append(versions, tc.Version)
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// checkWorkDir checks the work dir of the upgrades can be created and written.
+func checkWorkDir(ctx context.Context, cmd *cobra.Command) *checkResult {
+	dir, err := filepath.Abs(doctorCmdFlags.WorkDir)
+	if err == nil {
+		err = os.MkdirAll(dir, 0700)
+	}
+	if err == nil {
+		err = checkWritable(dir, "")
+	}
+	if err != nil {
+		return &checkResult{Status: checkFail, Detail: fmt.Sprintf("%s is not writable, %v", doctorCmdFlags.WorkDir, err),
+			Hint: "use a writable --work-dir of upgrade"}
+	}
+	return passCheck("%s is writable", dir)
+}
+
+// checkWritable checks a file can be created in dir, and file can be opened
+// for writing if it is set and exists.
+func checkWritable(dir string, file string) error {
+	f, err := ioutil.TempFile(dir, ".tim-doctor-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	if file == "" || !utils.FileExists(file) {
+		return nil
+	}
+	f, err = os.OpenFile(file, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -1,6 +1,8 @@
 package command
 
 import (
+	"context"
+	"fmt"
 	"os/exec"
 
 	"github.com/spf13/cobra"
@@ -11,7 +13,7 @@ func NewEnvCommand() *cobra.Command {
 	envCmd := &cobra.Command{
 		Use:   "env",
 		Short: "init environment for tidb-ansible",
-		Run:   envCommandFunc,
+		RunE:  envCommandFunc,
 	}
 
 	return envCmd
@@ -22,18 +24,17 @@ const (
 	initScitpFile = "/tmp/init_env.sh"
 )
 
-func envCommandFunc(cmd *cobra.Command, args []string) {
-	if err := utils.DownloadFile(initScriptURL, initScitpFile); err != nil {
-		cmd.Println(err)
-		return
+func envCommandFunc(cmd *cobra.Command, args []string) error {
+	if err := utils.DownloadFile(context.Background(), initScriptURL, initScitpFile); err != nil {
+		return err
 	}
 
 	shCmd := exec.Command("sh", initScitpFile)
 	stdoutStderr, err := shCmd.CombinedOutput()
 	if err != nil {
-		cmd.Println(string(stdoutStderr))
-		return
+		return fmt.Errorf("run %s failed, %v\n%s", initScitpFile, err, stdoutStderr)
 	}
 
 	cmd.Println("Success!")
+	return nil
 }
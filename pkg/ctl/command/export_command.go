@@ -0,0 +1,155 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+type ExportCommandFlags struct {
+	Output string
+	Format string
+}
+
+var (
+	exportCmdFlags = &ExportCommandFlags{}
+)
+
+// clustersFile is the content of an exported file, the clusters keep the
+// json field names in both json and yaml.
+type clustersFile struct {
+	Clusters []*models.TiDBCluster `json:"clusters"`
+}
+
+func NewExportCommand() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "export all the tidb clusters to a yaml or json file",
+		Args:  exactArgs(0),
+		RunE:  exportCommandFunc,
+	}
+
+	exportCmd.Flags().StringVarP(&exportCmdFlags.Output, "output", "o", "-",
+		"the file to export to, - means stdout")
+	exportCmd.Flags().StringVar(&exportCmdFlags.Format, "format", "",
+		"the format of the file, support yaml / json, default json for a .json file and yaml for others")
+
+	return exportCmd
+}
+
+func exportCommandFunc(cmd *cobra.Command, args []string) error {
+	format := exportCmdFlags.Format
+	if format == "" {
+		format = "yaml"
+		if strings.HasSuffix(exportCmdFlags.Output, ".json") {
+			format = "json"
+		}
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tcs, err := cli.LoadTiDBClusters(ctx)
+	if err != nil {
+		return fmt.Errorf("load list failed, %v", err)
+	}
+
+	data, err := encodeClusters(tcs, format)
+	if err != nil {
+		return err
+	}
+
+	if exportCmdFlags.Output == "-" {
+		cmd.Print(string(data))
+		return nil
+	}
+
+	if err := utils.WriteToFile(string(data), exportCmdFlags.Output); err != nil {
+		return err
+	}
+	cmd.Printf("%d tidb clusters exported to %s\n", len(tcs), exportCmdFlags.Output)
+
+	return nil
+}
+
+func encodeClusters(tcs []*models.TiDBCluster, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(&clustersFile{Clusters: tcs}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "json":
+		return append(data, '\n'), nil
+	case "yaml":
+		return jsonToYAML(data)
+	default:
+		return nil, fmt.Errorf("format %s is invalid, support yaml / json", format)
+	}
+}
+
+// jsonToYAML re-encodes the json data in block style yaml, json is yaml, so
+// the json field names are kept.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	clearStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yamlv3.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encoder.Close()
+}
+
+// clearStyle removes the flow style of the json nodes, so they are encoded in
+// block style.
+func clearStyle(node *yamlv3.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		clearStyle(n)
+	}
+}
+
+// readClustersFile reads the tidb clusters exported to file in yaml or json.
+func readClustersFile(file string) ([]*models.TiDBCluster, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var content interface{}
+	if err := yamlv3.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("parse %s failed, %v", file, err)
+	}
+
+	// convert the yaml to json, so the json field names are used
+	jsonData, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s failed, %v", file, err)
+	}
+
+	f := &clustersFile{}
+	if err := json.Unmarshal(jsonData, f); err != nil {
+		return nil, fmt.Errorf("parse %s failed, %v", file, err)
+	}
+
+	return f.Clusters, nil
+}
@@ -0,0 +1,187 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/parser"
+	"github.com/tidbops/tim/pkg/utils"
+	tyaml "github.com/tidbops/tim/pkg/yaml"
+	yaml "gopkg.in/mikefarah/yaml.v2"
+)
+
+type GenRulesCommandFlags struct {
+	From      string
+	To        string
+	Component string
+	Output    string
+	NoCache   bool
+}
+
+var (
+	genRulesCmdFlags = &GenRulesCommandFlags{}
+)
+
+func NewGenRulesCommand() *cobra.Command {
+	genRulesCmd := &cobra.Command{
+		Use:   "gen-rules",
+		Short: "generate a rule file scaffold from the default config changes between two versions",
+		Args:  exactArgs(0),
+		RunE:  genRulesCommandFunc,
+	}
+
+	genRulesCmd.Flags().StringVar(&genRulesCmdFlags.From, "from", "", "the version to upgrade from")
+	genRulesCmd.Flags().StringVar(&genRulesCmdFlags.To, "to", "", "the version to upgrade to")
+	genRulesCmd.Flags().StringVar(&genRulesCmdFlags.Component, "component", "tikv",
+		"the component of the rules, support "+supportedComponents())
+	genRulesCmd.Flags().StringVarP(&genRulesCmdFlags.Output, "output", "o", "-",
+		"the rule file to write, - means stdout")
+	genRulesCmd.Flags().BoolVar(&genRulesCmdFlags.NoCache, "no-cache", false,
+		"download the default config files again even if they are cached")
+
+	return genRulesCmd
+}
+
+func genRulesCommandFunc(cmd *cobra.Command, args []string) error {
+	if genRulesCmdFlags.From == "" || genRulesCmdFlags.To == "" {
+		cmd.Println(cmd.UsageString())
+		return fmt.Errorf("from and to flags are required")
+	}
+
+	component := genRulesCmdFlags.Component
+	if _, ok := configFilePaths[component]; !ok {
+		return fmt.Errorf("component %s is invalid, support %s", component, supportedComponents())
+	}
+
+	tmpPath, err := ioutil.TempDir("", "tim-gen-rules")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	src := &configSource{
+		RepoURL: getAnsibleRepoURL(cmd),
+		NoCache: genRulesCmdFlags.NoCache,
+	}
+	if isTerminalFile(os.Stderr) {
+		src.Progress = os.Stderr
+	}
+
+	fromFile := filepath.Join(tmpPath, fmt.Sprintf("%s-%s.yml", genRulesCmdFlags.From, component))
+	if err := fetchConfigFile(ctx, src, genRulesCmdFlags.From, component, fromFile); err != nil {
+		return fmt.Errorf("prepare config file failed, %v", err)
+	}
+	toFile := filepath.Join(tmpPath, fmt.Sprintf("%s-%s.yml", genRulesCmdFlags.To, component))
+	if err := fetchConfigFile(ctx, src, genRulesCmdFlags.To, component, toFile); err != nil {
+		return fmt.Errorf("prepare config file failed, %v", err)
+	}
+
+	entries, err := tyaml.DiffStructured(fromFile, toFile)
+	if err != nil {
+		return fmt.Errorf("compare %s %s failed, %v", fromFile, toFile, err)
+	}
+
+	ruleFile, err := genRuleFile(entries, component, genRulesCmdFlags.From, genRulesCmdFlags.To)
+	if err != nil {
+		return err
+	}
+
+	if genRulesCmdFlags.Output == "-" {
+		cmd.Print(ruleFile)
+		return nil
+	}
+
+	if err := utils.WriteToFile(ruleFile, genRulesCmdFlags.Output); err != nil {
+		return err
+	}
+	cmd.Printf("Success! rule file of %s from %s to %s saved to %s\n",
+		component, genRulesCmdFlags.From, genRulesCmdFlags.To, genRulesCmdFlags.Output)
+
+	return nil
+}
+
+// genRuleFile returns the rule file scaffold of the default config changes,
+// the removed keys are in the delete section and the added keys with their
+// default values are commented out in the new section for review. The rules
+// of pd and tidb are grouped by the component, as a plain rule file only
+// changes tikv.yml.
+func genRuleFile(entries []tyaml.DiffEntry, component, from, to string) (string, error) {
+	var (
+		added   yaml.MapSlice
+		deleted = []string{}
+	)
+	for _, e := range entries {
+		switch e.Kind {
+		case tyaml.DiffAdded:
+			added = setMapSlice(added, tyaml.ParsePath(e.Path), e.New)
+		case tyaml.DiffRemoved:
+			deleted = append(deleted, e.Path)
+		}
+	}
+
+	var newRules, deleteRules interface{} = added, deleted
+	if component != "tikv" {
+		newRules = yaml.MapSlice{{Key: component, Value: added}}
+		deleteRules = yaml.MapSlice{{Key: component, Value: deleted}}
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# the %s rules generated from the default configs of %s and %s, review them before use,\n",
+		component, from, to)
+	fmt.Fprintf(b, "# uncomment the new keys to add them with the default values of %s\n", to)
+	if component != "tikv" {
+		b.WriteString("# " + parser.ComponentsMark + "\n")
+	}
+	b.WriteString("# @new\n---\n")
+	if len(added) > 0 {
+		data, err := yaml.Marshal(newRules)
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			b.WriteString("# " + line + "\n")
+		}
+	}
+
+	b.WriteString("\n# @delete\n---\n")
+	data, err := yaml.Marshal(yaml.MapSlice{{Key: "delete", Value: deleteRules}})
+	if err != nil {
+		return "", err
+	}
+	b.Write(data)
+
+	return b.String(), nil
+}
+
+// setMapSlice sets the value of the path of keys in m, the maps on the path
+// are created in order.
+func setMapSlice(m yaml.MapSlice, keys []string, value interface{}) yaml.MapSlice {
+	if len(keys) == 0 {
+		return m
+	}
+
+	for i, item := range m {
+		if fmt.Sprintf("%v", item.Key) != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			m[i].Value = value
+			return m
+		}
+		child, _ := item.Value.(yaml.MapSlice)
+		m[i].Value = setMapSlice(child, keys[1:], value)
+		return m
+	}
+
+	if len(keys) == 1 {
+		return append(m, yaml.MapItem{Key: keys[0], Value: value})
+	}
+	return append(m, yaml.MapItem{Key: keys[0], Value: setMapSlice(nil, keys[1:], value)})
+}
@@ -1,31 +1,69 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bndr/gotabulate"
+	"github.com/ngaut/log"
 	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/client"
 	"github.com/tidbops/tim/pkg/client/local"
 	"github.com/tidbops/tim/pkg/client/server"
+	"github.com/tidbops/tim/pkg/inventory"
 	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
 )
 
-type Client interface {
-	LoadTiDBClusters() ([]*models.TiDBCluster, error)
-	GetTiDBClusterByHost(host string) ([]*models.TiDBCluster, error)
-	GetTiDBClusterByName(name string) (*models.TiDBCluster, error)
-	CreateTiDBCluster(tc *models.TiDBCluster) error
-	UpdateTiDBCluster(tc *models.TiDBCluster) error
-	SearchTiDBCluster(s map[string]interface{}) ([]*models.TiDBCluster, error)
+// loadInventory parses and validates the inventory.ini of a tidb-ansible
+// directory.
+func loadInventory(path string) (*inventory.Inventory, error) {
+	file := filepath.Join(path, "inventory.ini")
+	inv, err := inventory.ParseFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s failed, %v", file, err)
+	}
+
+	if err := inv.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s, %v", file, err)
+	}
+
+	return inv, nil
+}
+
+// exactArgs is like cobra.ExactArgs, but it prints the usage if the number
+// of args is not n.
+func exactArgs(n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) != n {
+			cmd.Println(cmd.UsageString())
+			return fmt.Errorf("%s requires %d arg(s), received %d", cmd.UseLine(), n, len(args))
+		}
+		return nil
+	}
 }
 
-func genClient(cmd *cobra.Command) (Client, error) {
+func genClient(cmd *cobra.Command) (client.Client, error) {
 	addr, err := cmd.Flags().GetString("server")
 	if err != nil || addr == "" {
-		c, err := local.NewLocalClient()
+		cfg := models.DefaultEngineConfig()
+		if dir, err := cmd.Flags().GetString("data-dir"); err == nil && dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, err
+			}
+			cfg = models.SqliteEngineConfig(dir)
+		}
+
+		c, err := local.NewLocalClientWithConfig(cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -40,18 +78,358 @@ func genClient(cmd *cobra.Command) (Client, error) {
 	return c, nil
 }
 
-func initTiDBAnsible(version string, path string) error {
-	gitCmd := exec.Command("sh", "-c",
-		fmt.Sprintf("git clone -b %s %s %s", version, TiDBAnsibleURL, path))
+// ansibleRequiredFiles are the files of a tidb-ansible tree used by tim, the
+// ones ending with / are directories.
+var ansibleRequiredFiles = []string{
+	"local_prepare.yml",
+	"excessive_rolling_update.yml",
+	"conf/",
+}
+
+// ansibleSource is where initTiDBAnsible gets the tidb-ansible files from.
+type ansibleSource struct {
+	// GitURL is the git repo to clone, TiDBAnsibleURL if empty
+	GitURL string
+	// GitRef is the branch, tag or commit to check out, the branch of the
+	// tidb version if empty
+	GitRef string
+	// Manifest is the sha256sum file to verify the files with, optional
+	Manifest string
+}
 
-	stdoutStderr, err := gitCmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%s, %v", stdoutStderr, err)
+func (s *ansibleSource) gitURL() string {
+	if s.GitURL == "" {
+		return TiDBAnsibleURL
+	}
+	return s.GitURL
+}
+
+// ref returns the git ref checked out for version.
+func (s *ansibleSource) ref(version string) string {
+	if s.GitRef == "" {
+		return version
+	}
+	return s.GitRef
+}
+
+// initTiDBAnsible clones the tidb-ansible files of version from src to path,
+// an existing path is an error unless clean is set, then it is removed first.
+// The cloned files are verified by verifyTiDBAnsible, the files of a failed or
+// broken clone are removed, so it can be retried.
+func initTiDBAnsible(version string, path string, clean bool, src *ansibleSource) error {
+	if utils.FileExists(path) {
+		if !clean {
+			return fmt.Errorf("%s already exists", path)
+		}
+		log.Warnf("remove the existing %s to init %s tidb-ansible files", path, version)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	if err := cloneTiDBAnsible(src, version, path); err != nil {
+		if err := os.RemoveAll(path); err != nil {
+			log.Warnf("remove %s failed, %v", path, err)
+		}
+		return err
+	}
+
+	if err := verifyTiDBAnsible(path, src.ref(version), src.Manifest); err != nil {
+		if err := os.RemoveAll(path); err != nil {
+			log.Warnf("remove %s failed, %v", path, err)
+		}
+		return fmt.Errorf("verify %s tidb-ansible files failed, %v", version, err)
+	}
+
+	return nil
+}
+
+// cloneTiDBAnsible clones the git repo of src to path. The branch of version
+// is cloned by default, a git ref of src may be any branch, tag or commit,
+// it is checked out after the clone.
+func cloneTiDBAnsible(src *ansibleSource, version string, path string) error {
+	cmds := [][]string{{"clone", "-b", version, src.gitURL(), path}}
+	if src.GitRef != "" {
+		cmds = [][]string{
+			{"clone", src.gitURL(), path},
+			{"-C", path, "checkout", "-q", src.GitRef},
+		}
+	}
+
+	for _, args := range cmds {
+		gitCmd := "git " + strings.Join(args, " ")
+		log.Debugf("run %s", gitCmd)
+		stdoutStderr, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s failed, %s, %v", gitCmd, strings.TrimSpace(string(stdoutStderr)), err)
+		}
+	}
+
+	return nil
+}
+
+// verifyTiDBAnsible checks the tidb-ansible tree in path is complete and of
+// version if it is known, and the files match the sha256 checksums of the
+// manifest file in the format of sha256sum if it is not empty.
+func verifyTiDBAnsible(path string, version string, manifest string) error {
+	for _, name := range ansibleRequiredFiles {
+		fi, err := os.Stat(filepath.Join(path, name))
+		if err != nil {
+			return fmt.Errorf("%s not found in %s", name, path)
+		}
+		if strings.HasSuffix(name, "/") && !fi.IsDir() {
+			return fmt.Errorf("%s in %s is not a directory", name, path)
+		}
+	}
+
+	if actual, err := ansibleVersion(path); err == nil && actual != version {
+		return fmt.Errorf("%s has the tidb-ansible files of %s, not %s", path, actual, version)
+	}
+
+	if manifest != "" {
+		if err := utils.VerifyManifest(path, manifest); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// ansibleVersion returns the tag or the branch of the tidb-ansible files in
+// path checked out by initTiDBAnsible.
+func ansibleVersion(path string) (string, error) {
+	for _, args := range [][]string{
+		{"describe", "--tags", "--exact-match"},
+		{"rev-parse", "--abbrev-ref", "HEAD"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", path}, args...)...).Output()
+		if version := strings.TrimSpace(string(out)); err == nil && version != "" && version != "HEAD" {
+			return version, nil
+		}
+	}
+
+	return "", fmt.Errorf("the version of %s tidb-ansible files is unknown", path)
+}
+
+// idleStatuses are the statuses of a tidb cluster not in an upgrade, the
+// tidb-ansible files can be changed in place then.
+var idleStatuses = []string{
+	string(models.TiDBInited),
+	models.TiDBRunning,
+	models.TiDBStoped,
+	models.TiDBUpgraded,
+}
+
+// setTiDBClusterStatus changes the status of tc and persists it.
+func setTiDBClusterStatus(ctx context.Context, cli client.Client, tc *models.TiDBCluster, status string) error {
+	if err := models.CheckTiDBStatusTransition(tc.Status, status); err != nil {
+		return err
+	}
+
+	tc.Status = status
+	return cli.UpdateTiDBCluster(ctx, tc)
+}
+
+// upgradeBackup is a <path>-<version>-bak directory left by upgrade.
+type upgradeBackup struct {
+	Dir string
+	// Version is the version the tidb-ansible files were backed up from
+	Version string
+	ModTime time.Time
+}
+
+// siblingVersionRegexp matches a version inside the middle part of a backup
+// directory, e.g. v3.0.1 of 2-v3.0.1 or v3.0.0-v3.0.1.
+var siblingVersionRegexp = regexp.MustCompile(`.-v\d+\.\d+\.\d+`)
+
+// upgradeBackupVersion returns the version of the backup directory dir of the
+// tidb-ansible directory path, it is not ok if dir is not <path>-<version>-bak,
+// e.g. /data/tidb-2-v3.0.1-bak is a backup of /data/tidb-2, not /data/tidb.
+func upgradeBackupVersion(path string, dir string) (string, bool) {
+	prefix := filepath.Clean(path) + "-"
+	if !strings.HasPrefix(dir, prefix) || !strings.HasSuffix(dir, "-bak") {
+		return "", false
+	}
+	version := strings.TrimSuffix(strings.TrimPrefix(dir, prefix), "-bak")
+	if _, err := utils.ParseVersion(version); err != nil {
+		return "", false
+	}
+	// a backup of the sibling <path>-<version> also parses as a pre-release
+	if siblingVersionRegexp.MatchString(version) {
+		return "", false
+	}
+	return version, true
+}
+
+// listUpgradeBackups returns the backup directories left by the upgrades of
+// the tidb-ansible directory path, the latest first. The ones of the tidb
+// clusters whose paths have path as the prefix are not listed.
+func listUpgradeBackups(path string) ([]*upgradeBackup, error) {
+	path = filepath.Clean(path)
+	matches, err := filepath.Glob(path + "-*-bak")
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []*upgradeBackup
+	for _, m := range matches {
+		version, ok := upgradeBackupVersion(path, m)
+		if !ok {
+			continue
+		}
+		fi, err := os.Stat(m)
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+		backups = append(backups, &upgradeBackup{
+			Dir:     m,
+			Version: version,
+			ModTime: fi.ModTime(),
+		})
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool { return backups[i].ModTime.After(backups[j].ModTime) })
+	return backups, nil
+}
+
+// findUpgradeBackup returns the latest <path>-<version>-bak directory left by
+// upgrade and the version it was backed up from, or an empty dir if none exists.
+func findUpgradeBackup(path string) (string, string, error) {
+	backups, err := listUpgradeBackups(path)
+	if err != nil || len(backups) == 0 {
+		return "", "", err
+	}
+
+	return backups[0].Dir, backups[0].Version, nil
+}
+
+// getAnsibleRepoURL returns the tidb-ansible raw file url from the
+// --ansible-repo-url flag, the TIM_ANSIBLE_REPO_URL env or the default one.
+func getAnsibleRepoURL(cmd *cobra.Command) string {
+	if repoURL, err := cmd.Flags().GetString("ansible-repo-url"); err == nil && repoURL != "" {
+		return repoURL
+	}
+
+	if repoURL := os.Getenv("TIM_ANSIBLE_REPO_URL"); repoURL != "" {
+		return repoURL
+	}
+
+	return DefaultAnsibleRepoURL
+}
+
+// interrupts are the cancel funcs of the contexts of the running commands by
+// the id of interruptContext.
+var interrupts = struct {
+	sync.Mutex
+	next    int
+	cancels map[int]context.CancelFunc
+	ctxs    map[int]context.Context
+}{cancels: map[int]context.CancelFunc{}, ctxs: map[int]context.Context{}}
+
+// interruptContext returns a context of a command cancelled by Interrupt, the
+// main of tim calls it on the first SIGINT, and the deferred cleanups of the
+// command, e.g. the lock release, run before it returns.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	interrupts.Lock()
+	id := interrupts.next
+	interrupts.next++
+	interrupts.cancels[id] = cancel
+	interrupts.ctxs[id] = ctx
+	interrupts.Unlock()
+
+	return ctx, func() {
+		interrupts.Lock()
+		delete(interrupts.cancels, id)
+		delete(interrupts.ctxs, id)
+		interrupts.Unlock()
+		cancel()
+	}
+}
+
+// Interrupt cancels the contexts of the running commands, it returns false if
+// none is left to cancel, e.g. on a second SIGINT, the caller exits then.
+func Interrupt() bool {
+	interrupts.Lock()
+	defer interrupts.Unlock()
+
+	cancelled := false
+	for id, cancel := range interrupts.cancels {
+		if interrupts.ctxs[id].Err() == nil {
+			cancel()
+			cancelled = true
+		}
+	}
+	return cancelled
+}
+
+// assumeYes returns whether --yes is set.
+func assumeYes(cmd *cobra.Command) bool {
+	yes, err := cmd.Flags().GetBool("yes")
+	return err == nil && yes
+}
+
+// isQuiet returns whether --quiet is set, the commands print only the results
+// and the errors then, and do not ask.
+func isQuiet(cmd *cobra.Command) bool {
+	quiet, err := cmd.Flags().GetBool("quiet")
+	return err == nil && quiet
+}
+
+// infof prints the informational output of a command, e.g. a hint of the next
+// step, unless --quiet is set.
+func infof(cmd *cobra.Command, format string, args ...interface{}) {
+	if !isQuiet(cmd) {
+		cmd.Printf(format, args...)
+	}
+}
+
+// confirm asks to confirm label, --yes confirms it without asking and it is
+// not confirmed in quiet mode otherwise.
+func confirm(cmd *cobra.Command, label string) bool {
+	if assumeYes(cmd) {
+		infof(cmd, "%s yes\n", label)
+		return true
+	}
+
+	if isQuiet(cmd) || !prompter.Interactive() {
+		return false
+	}
+
+	return prompter.Confirm(label) == nil
+}
+
+// confirmDestructive is like confirm, but --yes does not confirm a destructive
+// operation, only force does.
+func confirmDestructive(cmd *cobra.Command, label string, force bool) bool {
+	if force {
+		return true
+	}
+
+	if assumeYes(cmd) {
+		cmd.Printf("%s no, --force is required to confirm it\n", label)
+		return false
+	}
+
+	return confirm(cmd, label)
+}
+
+func isTerminalFile(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// timHomeDir returns ~/.tim, where tim keeps its local files.
+func timHomeDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".tim"), nil
+}
+
 func getHostName() string {
 	hostname, _ := os.Hostname()
 	return hostname
@@ -0,0 +1,74 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// makeBackupDirs creates the dirs under root, the later ones newer.
+func makeBackupDirs(t *testing.T, root string, dirs ...string) {
+	t.Helper()
+	now := time.Now()
+	for i, d := range dirs {
+		dir := filepath.Join(root, d)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i-len(dirs)) * time.Minute)
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpgradeBackupVersion(t *testing.T) {
+	cases := []struct {
+		dir     string
+		version string
+		ok      bool
+	}{
+		{"/data/tidb-v3.0.0-bak", "v3.0.0", true},
+		{"/data/tidb-v4.0.0-rc.1-bak", "v4.0.0-rc.1", true},
+		{"/data/tidb-2-v3.0.1-bak", "", false},
+		{"/data/tidb-v3.0.0-v3.0.1-bak", "", false},
+		{"/data/tidb-master-bak", "", false},
+		{"/data/tidb-v3.0.0", "", false},
+		{"/data/other-v3.0.0-bak", "", false},
+	}
+	for _, c := range cases {
+		version, ok := upgradeBackupVersion("/data/tidb/", c.dir)
+		if version != c.version || ok != c.ok {
+			t.Errorf("upgradeBackupVersion(%s) = %q, %v, want %q, %v", c.dir, version, ok, c.version, c.ok)
+		}
+	}
+}
+
+func TestListUpgradeBackupsSkipsSiblings(t *testing.T) {
+	root, err := ioutil.TempDir("", "tim-backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// tidb-2-v3.0.1-bak is the newest, it is the backup of tidb-2
+	makeBackupDirs(t, root, "tidb", "tidb-2", "tidb-v3.0.0-bak", "tidb-2-v3.0.1-bak")
+
+	backups, err := listUpgradeBackups(filepath.Join(root, "tidb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || backups[0].Version != "v3.0.0" {
+		t.Fatalf("backups of tidb = %v, want only tidb-v3.0.0-bak", backups)
+	}
+
+	dir, version, err := findUpgradeBackup(filepath.Join(root, "tidb-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != filepath.Join(root, "tidb-2-v3.0.1-bak") || version != "v3.0.1" {
+		t.Fatalf("backup of tidb-2 = %s %s, want tidb-2-v3.0.1-bak v3.0.1", dir, version)
+	}
+}
@@ -0,0 +1,147 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bndr/gotabulate"
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/client"
+	"github.com/tidbops/tim/pkg/models"
+)
+
+type HistoryCommandFlags struct {
+	Output string
+}
+
+var (
+	historyCmdFlags = &HistoryCommandFlags{}
+)
+
+// recordTimeout is the time limit of recording an upgrade history entry, it
+// is recorded even if the upgrade is interrupted.
+const recordTimeout = 10 * time.Second
+
+func NewHistoryCommand() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:   "history <name>",
+		Short: "show the upgrade and rollback history of a tidb cluster",
+		Args:  exactArgs(1),
+		RunE:  historyCommandFunc,
+	}
+
+	historyCmd.Flags().StringVarP(&historyCmdFlags.Output, "output", "o", "table",
+		"output format, support table / json")
+
+	return historyCmd
+}
+
+func historyCommandFunc(cmd *cobra.Command, args []string) error {
+	if historyCmdFlags.Output != "table" && historyCmdFlags.Output != "json" {
+		return fmt.Errorf("output format %s is not supported", historyCmdFlags.Output)
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	hs, err := cli.GetUpgradeHistoryByName(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("load history failed, %v", err)
+	}
+
+	if historyCmdFlags.Output == "json" {
+		data, err := json.MarshalIndent(hs, "", "  ")
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(data))
+		return nil
+	}
+
+	if len(hs) == 0 {
+		cmd.Printf("no upgrade history of %s\n", args[0])
+		return nil
+	}
+	cmd.Println(getUpgradeHistoryTableString(hs))
+
+	return nil
+}
+
+func getUpgradeHistoryTableString(hs []*models.UpgradeHistory) string {
+	var rows [][]string
+	for _, h := range hs {
+		config := h.ConfigMode
+		if h.ConfigFile != "" {
+			config = fmt.Sprintf("%s: %s", h.ConfigMode, h.ConfigFile)
+		}
+		result := h.Result
+		if h.Error != "" {
+			// the output of the failed commands is kept in one cell
+			result = fmt.Sprintf("%s: %s", h.Result, strings.Join(strings.Fields(h.Error), " "))
+		}
+		rows = append(rows, []string{
+			strconv.FormatInt(h.ID, 10),
+			h.StartTime.Format("2006-01-02 15:04:05"),
+			h.EndTime.Sub(h.StartTime).Round(time.Second).String(),
+			h.Operation, h.FromVersion, h.TargetVersion, config, result, h.Operator, h.Host, h.Artifacts,
+		})
+	}
+	t := gotabulate.Create(rows)
+	t.SetHeaders([]string{"ID", "StartTime", "Duration", "Operation", "From", "Target", "Config", "Result",
+		"Operator", "Host", "Artifacts"})
+	t.SetAlign("left")
+	t.SetMaxCellSize(60)
+	t.SetWrapStrings(true)
+	return t.Render("grid")
+}
+
+// newUpgradeHistory returns the history entry of an operation of tc starting
+// now, the version of tc is the version it changes from.
+func newUpgradeHistory(tc *models.TiDBCluster, operation, target string) *models.UpgradeHistory {
+	return &models.UpgradeHistory{
+		Name:          tc.Name,
+		Operation:     operation,
+		FromVersion:   tc.Version,
+		TargetVersion: target,
+		Operator:      getOperator(),
+		Host:          strings.ToLower(getHostName()),
+		StartTime:     time.Now(),
+	}
+}
+
+// recordUpgradeHistory appends h with the outcome err to the history, a
+// failure to record it is logged and does not fail the operation.
+func recordUpgradeHistory(cli client.Client, h *models.UpgradeHistory, err error) {
+	h.EndTime = time.Now()
+	if err != nil {
+		h.Result = models.UpgradeFailed
+		h.Error = err.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	if err := cli.CreateUpgradeHistory(ctx, h); err != nil {
+		log.Warnf("record the %s history of %s failed, %v", h.Operation, h.Name, err)
+	}
+}
+
+// getOperator returns the name of the user running tim.
+func getOperator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,213 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/utils"
+	yaml "gopkg.in/mikefarah/yaml.v2"
+)
+
+type ImportCommandFlags struct {
+	Version     string
+	Description string
+	DryRun      bool
+	File        string
+}
+
+var (
+	importCmdFlags = &ImportCommandFlags{}
+)
+
+func NewImportCommand() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import {<dir> | --file <file>}",
+		Short: "register the tidb clusters in the sub directories of a directory",
+		Args:  importArgs,
+		RunE:  importCommandFunc,
+	}
+
+	importCmd.Flags().StringVar(&importCmdFlags.Version, "tidb-version", "",
+		"the tidb version of the clusters whose version can not be detected")
+	importCmd.Flags().StringVar(&importCmdFlags.Description, "desc", "", "description of the tidb clusters")
+	importCmd.Flags().BoolVar(&importCmdFlags.DryRun, "dry-run", false,
+		"only show the tidb clusters that would be imported")
+	importCmd.Flags().StringVarP(&importCmdFlags.File, "file", "f", "",
+		"recreate the tidb clusters exported to the file by export instead of scanning a directory")
+
+	return importCmd
+}
+
+// importArgs requires a directory unless --file is set.
+func importArgs(cmd *cobra.Command, args []string) error {
+	if importCmdFlags.File != "" {
+		return exactArgs(0)(cmd, args)
+	}
+	return exactArgs(1)(cmd, args)
+}
+
+// importCommandFunc registers every sub directory of dir holding tidb-ansible
+// files as a tidb cluster named after the directory.
+func importCommandFunc(cmd *cobra.Command, args []string) error {
+	if importCmdFlags.File != "" {
+		return importClustersFile(cmd, importCmdFlags.File)
+	}
+
+	dir, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	var imported, skipped, failed int
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if !utils.FileExists(filepath.Join(path, "inventory.ini")) {
+			log.Warnf("skip %s, inventory.ini not found", path)
+			skipped++
+			continue
+		}
+
+		inv, err := loadInventory(path)
+		if err != nil {
+			log.Warnf("skip %s, %v", path, err)
+			skipped++
+			continue
+		}
+
+		version := detectTiDBVersion(path, inv.Var("tidb_version"))
+		if version == "" {
+			version = importCmdFlags.Version
+		}
+		if version == "" {
+			log.Warnf("skip %s, tidb version not found, use --tidb-version to specify it", path)
+			skipped++
+			continue
+		}
+
+		if _, err := cli.GetTiDBClusterByName(ctx, name); err == nil {
+			log.Warnf("skip %s, %s tidb cluster already exists", path, name)
+			skipped++
+			continue
+		}
+
+		if importCmdFlags.DryRun {
+			cmd.Printf("would import %s %s from %s\n", name, version, path)
+			imported++
+			continue
+		}
+
+		tc := newTiDBCluster(name, version, path, importCmdFlags.Description, inv)
+		if err := cli.CreateTiDBCluster(ctx, tc); err != nil {
+			log.Errorf("import %s failed, %v", path, err)
+			failed++
+			continue
+		}
+		cmd.Printf("imported %s %s from %s\n", name, version, path)
+		imported++
+	}
+
+	return printImportResult(cmd, imported, skipped, failed)
+}
+
+// importClustersFile recreates the tidb clusters exported to file, the ones
+// with existing names are skipped.
+func importClustersFile(cmd *cobra.Command, file string) error {
+	tcs, err := readClustersFile(file)
+	if err != nil {
+		return err
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	var imported, skipped, failed int
+	for _, tc := range tcs {
+		if _, err := cli.GetTiDBClusterByName(ctx, tc.Name); err == nil {
+			log.Warnf("skip %s, tidb cluster already exists", tc.Name)
+			skipped++
+			continue
+		}
+
+		if importCmdFlags.DryRun {
+			cmd.Printf("would import %s %s\n", tc.Name, tc.Version)
+			imported++
+			continue
+		}
+
+		// the id belongs to the exported store, a new one is assigned
+		tc.ID = 0
+		if err := cli.CreateTiDBCluster(ctx, tc); err != nil {
+			log.Errorf("import %s failed, %v", tc.Name, err)
+			failed++
+			continue
+		}
+		cmd.Printf("imported %s %s\n", tc.Name, tc.Version)
+		imported++
+	}
+
+	return printImportResult(cmd, imported, skipped, failed)
+}
+
+func printImportResult(cmd *cobra.Command, imported, skipped, failed int) error {
+	if importCmdFlags.DryRun {
+		cmd.Printf("Dry run, %d would be imported, %d skipped\n", imported, skipped)
+	} else {
+		cmd.Printf("%d imported, %d skipped, %d failed\n", imported, skipped, failed)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d tidb clusters failed to import", failed)
+	}
+
+	return nil
+}
+
+// detectTiDBVersion returns the tidb_version of inventory.ini, or the one in
+// group_vars/all.yml of path, it is empty if neither is set.
+func detectTiDBVersion(path string, inventoryVersion string) string {
+	if inventoryVersion != "" {
+		return inventoryVersion
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(path, "group_vars", "all.yml"))
+	if err != nil {
+		return ""
+	}
+
+	vars := struct {
+		TiDBVersion string `yaml:"tidb_version"`
+	}{}
+	if err := yaml.Unmarshal(data, &vars); err != nil {
+		return ""
+	}
+
+	return vars.TiDBVersion
+}
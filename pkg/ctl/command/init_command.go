@@ -1,6 +1,8 @@
 package command
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -16,6 +18,9 @@ type InitCommandFlags struct {
 	Path        string
 	Version     string
 	Description string
+	Manifest    string
+	GitURL      string
+	GitRef      string
 }
 
 var (
@@ -26,33 +31,41 @@ func NewInitCommand() *cobra.Command {
 	initCmd := &cobra.Command{
 		Use:   "init",
 		Short: "init tidb-ansible files",
-		Run:   initCommandFunc,
+		RunE:  initCommandFunc,
 	}
 
 	initCmd.Flags().StringVar(&initCmdFlags.Name, "name", "", "name specified the name of tidb cluster, required")
 	initCmd.Flags().StringVar(&initCmdFlags.Path, "path", "./demo", "path specifies the storage path of the tidb-ansible file, required")
 	initCmd.Flags().StringVar(&initCmdFlags.Version, "tidb-version", "master", "version specifies the tidb version to init, required")
 	initCmd.Flags().StringVar(&initCmdFlags.Description, "desc", "", "description of the installed tidb cluster")
+	initCmd.Flags().StringVar(&initCmdFlags.Manifest, "ansible-manifest", "",
+		"verify the tidb-ansible files with the sha256 checksums of the file in the format of sha256sum")
+	initCmd.Flags().StringVar(&initCmdFlags.GitURL, "ansible-git-url", TiDBAnsibleURL,
+		"the git repo to clone the tidb-ansible files from")
+	initCmd.Flags().StringVar(&initCmdFlags.GitRef, "ansible-git-ref", "",
+		"the branch, tag or commit of the tidb-ansible files to check out, default the branch of the tidb version")
 
 	return initCmd
 }
 
-func initCommandFunc(cmd *cobra.Command, args []string) {
+func initCommandFunc(cmd *cobra.Command, args []string) error {
 	if initCmdFlags.Name == "" {
-		cmd.Println("name flag is required")
 		cmd.Println(cmd.UsageString())
-		return
+		return errors.New("name flag is required")
 	}
 
 	if initCmdFlags.Version == "" {
-		cmd.Println("tidb-version flag is required")
 		cmd.Println(cmd.UsageString())
-		return
+		return errors.New("tidb-version flag is required")
 	}
 
-	if err := initTiDBAnsible(initCmdFlags.Version, initCmdFlags.Path); err != nil {
-		cmd.Println(err)
-		return
+	src := &ansibleSource{
+		GitURL:   initCmdFlags.GitURL,
+		GitRef:   initCmdFlags.GitRef,
+		Manifest: initCmdFlags.Manifest,
+	}
+	if err := initTiDBAnsible(initCmdFlags.Version, initCmdFlags.Path, false, src); err != nil {
+		return err
 	}
 
 	tc := &models.TiDBCluster{
@@ -66,13 +79,17 @@ func initCommandFunc(cmd *cobra.Command, args []string) {
 	}
 	cli, err := genClient(cmd)
 	if err != nil {
-		cmd.Printf("init client failed, %v\n", err)
-		return
+		return fmt.Errorf("init client failed, %v", err)
 	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
 
-	if err := cli.CreateTiDBCluster(tc); err != nil {
-		cmd.Printf("store tidb cluster information failed, %v\n", err)
-		return
+	if err := cli.CreateTiDBCluster(ctx, tc); err != nil {
+		return fmt.Errorf("store tidb cluster information failed, %v", err)
 	}
 	cmd.Printf("Success! tidb-ansible files saved %s, version %s\n", initCmdFlags.Path, initCmdFlags.Version)
+
+	return nil
 }
@@ -0,0 +1,121 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// labelKeyPattern and labelValuePattern are the formats of the labels, a
+// value can not contain , or = which separate the selector pairs.
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+)
+
+func NewLabelCommand() *cobra.Command {
+	labelCmd := &cobra.Command{
+		Use:   "label <name> [key=value | key-]...",
+		Short: "set or remove the labels of a tidb cluster, the labels are printed without pairs",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  labelCommandFunc,
+	}
+
+	return labelCmd
+}
+
+func labelCommandFunc(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	set := make(map[string]string)
+	var remove []string
+	for _, arg := range args[1:] {
+		if strings.HasSuffix(arg, "-") && !strings.Contains(arg, "=") {
+			key := strings.TrimSuffix(arg, "-")
+			if err := checkLabel(key, "-"); err != nil {
+				return err
+			}
+			remove = append(remove, key)
+			continue
+		}
+
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("label %s is invalid, it should be key=value to set or key- to remove", arg)
+		}
+		if err := checkLabel(kv[0], kv[1]); err != nil {
+			return err
+		}
+		set[kv[0]] = kv[1]
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	if len(set) == 0 && len(remove) == 0 {
+		for _, label := range formatLabels(tc.Labels) {
+			cmd.Println(label)
+		}
+		return nil
+	}
+
+	if tc.Labels == nil {
+		tc.Labels = make(map[string]string, len(set))
+	}
+	for key, value := range set {
+		tc.Labels[key] = value
+	}
+	for _, key := range remove {
+		if _, ok := tc.Labels[key]; !ok {
+			return fmt.Errorf("%s has no label %s", name, key)
+		}
+		delete(tc.Labels, key)
+	}
+
+	if err := cli.UpdateTiDBCluster(ctx, tc); err != nil {
+		return fmt.Errorf("update tidb cluster information failed, %v", err)
+	}
+	if len(tc.Labels) == 0 {
+		cmd.Printf("Success! %s has no labels now\n", name)
+		return nil
+	}
+	cmd.Printf("Success! %s labeled %s\n", name, strings.Join(formatLabels(tc.Labels), ","))
+
+	return nil
+}
+
+// checkLabel returns an error if key or value is not in the format of the
+// labels.
+func checkLabel(key, value string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("label key %s is invalid, it should be letters, digits, . _ / and -", key)
+	}
+	if !labelValuePattern.MatchString(value) {
+		return fmt.Errorf("label value %s of %s is invalid, it should be letters, digits, . _ / and -", value, key)
+	}
+	return nil
+}
+
+// formatLabels returns the key=value pairs of labels sorted by key.
+func formatLabels(labels map[string]string) []string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
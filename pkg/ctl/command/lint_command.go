@@ -0,0 +1,130 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/lint"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type LintCommandFlags struct {
+	Component     string
+	TargetVersion string
+	Deprecations  string
+}
+
+var (
+	lintCmdFlags = &LintCommandFlags{}
+)
+
+func NewLintCommand() *cobra.Command {
+	lintCmd := &cobra.Command{
+		Use:   "lint <name>",
+		Short: "report the deprecated options in the configs of a tidb cluster, the configs are not changed",
+		Args:  exactArgs(1),
+		RunE:  lintCommandFunc,
+	}
+
+	lintCmd.Flags().StringVar(&lintCmdFlags.Component, "component", allComponents,
+		"the comma separated component configs to lint, support "+supportedComponents()+" / all")
+	lintCmd.Flags().StringVar(&lintCmdFlags.TargetVersion, "target-version", "",
+		"report the options deprecated in the version instead of the cluster version, e.g. before upgrading to it")
+	lintCmd.Flags().StringVar(&lintCmdFlags.Deprecations, "deprecations", "",
+		"the deprecation list file in yaml or json instead of the builtin one")
+
+	return lintCmd
+}
+
+func lintCommandFunc(cmd *cobra.Command, args []string) error {
+	components, err := parseComponents(lintCmdFlags.Component)
+	if err != nil {
+		return err
+	}
+
+	l, err := loadDeprecations(lintCmdFlags.Deprecations)
+	if err != nil {
+		return err
+	}
+
+	name := args[0]
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	version := tc.Version
+	if lintCmdFlags.TargetVersion != "" {
+		version = lintCmdFlags.TargetVersion
+	}
+
+	total := 0
+	for _, component := range components {
+		configFile := filepath.Join(tc.Path, "conf", configFilePaths[component])
+		if !utils.FileExists(configFile) {
+			log.Infof("%s not found, skip %s config", configFile, component)
+			continue
+		}
+
+		issues, err := l.CheckFile(component, version, configFile)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			cmd.Printf("%s: %s\n", configFile, issue)
+		}
+		total += len(issues)
+	}
+
+	if total == 0 {
+		cmd.Printf("no options deprecated in %s found in the configs of %s\n", version, tc.Name)
+		return nil
+	}
+	cmd.Printf("%d options deprecated in %s found in the configs of %s\n", total, version, tc.Name)
+	return nil
+}
+
+// loadDeprecations returns the deprecation list of the file, or the builtin
+// one if the file is empty.
+func loadDeprecations(file string) (lint.List, error) {
+	if file != "" {
+		return lint.LoadFile(file)
+	}
+	return lint.Builtin()
+}
+
+// warnDeprecatedOptions logs the options deprecated in version of the config
+// files by component, they are only reported.
+func warnDeprecatedOptions(name, version string, files map[string]string) {
+	l, err := lint.Builtin()
+	if err != nil {
+		log.Warnf("load the builtin deprecation list failed, %v", err)
+		return
+	}
+
+	for _, component := range configComponents {
+		file, ok := files[component]
+		if !ok {
+			continue
+		}
+		issues, err := l.CheckFile(component, version, file)
+		if err != nil {
+			log.Warnf("lint the %s config of %s failed, %v", component, name, err)
+			continue
+		}
+		for _, issue := range issues {
+			log.Warnf("%s %s config: %s, see tim lint", name, component, issue)
+		}
+	}
+}
@@ -1,31 +1,162 @@
 package command
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/query"
+)
+
+type ListCommandFlags struct {
+	Status   string
+	Version  string
+	Output   string
+	Limit    int
+	Offset   int
+	Filter   string
+	Selector string
+}
+
+var (
+	listCmdFlags = &ListCommandFlags{}
 )
 
 func NewListCommand() *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "tidb-clusters list info",
-		Run:   listCommandFunc,
+		RunE:  listCommandFunc,
 	}
+	listCmd.Flags().StringVar(&listCmdFlags.Status, "status", "", "only list the tidb clusters in the status, e.g. WaitingUpgrade")
+	listCmd.Flags().StringVar(&listCmdFlags.Version, "tidb-version", "",
+		"only list the tidb clusters of the version, support the operators <, <=, >, >=, = and !=, e.g. \"<v4.0.0\"")
+	listCmd.Flags().StringVarP(&listCmdFlags.Output, "output", "o", "table",
+		"output format, support table / json / yaml / go-template=<template>, "+
+			"the template is executed for each tidb cluster, e.g. go-template='{{.Name}} {{.Version}}'")
+	listCmd.Flags().StringVarP(&listCmdFlags.Filter, "filter", "f", "",
+		"only list the tidb clusters matching the expression of name / version / status / path, "+
+			"e.g. \"version<v4.0.0 && status=waiting-upgrade\"")
+	listCmd.Flags().StringVar(&listCmdFlags.Selector, "selector", "",
+		"only list the tidb clusters matching the comma separated key=value pairs, "+
+			"support name / version / status / host / path and the labels, e.g. team=payments")
+	listCmd.Flags().IntVar(&listCmdFlags.Limit, "limit", 0, "list at most the number of tidb clusters, 0 lists all of them")
+	listCmd.Flags().IntVar(&listCmdFlags.Offset, "offset", 0, "skip the number of tidb clusters ordered by name")
 	return listCmd
 }
 
-func listCommandFunc(cmd *cobra.Command, args []string) {
+func listCommandFunc(cmd *cobra.Command, args []string) error {
+	out, err := parseOutputFormat(listCmdFlags.Output, "table")
+	if err != nil {
+		return err
+	}
+
+	if listCmdFlags.Limit < 0 || listCmdFlags.Offset < 0 {
+		return fmt.Errorf("limit and offset must not be negative")
+	}
+	paged := listCmdFlags.Limit > 0 || listCmdFlags.Offset > 0
+
+	var filter *query.Query
+	if listCmdFlags.Filter != "" {
+		q, err := query.Parse(listCmdFlags.Filter)
+		if err != nil {
+			return fmt.Errorf("invalid filter %q, %v", listCmdFlags.Filter, err)
+		}
+		filter = q
+	}
+
+	selector, err := parseSelector(listCmdFlags.Selector)
+	if err != nil {
+		return err
+	}
+
+	if listCmdFlags.Status != "" {
+		if err := models.CheckTiDBStatus(listCmdFlags.Status); err != nil {
+			return err
+		}
+	}
+
 	cli, err := genClient(cmd)
 	if err != nil {
-		cmd.Printf("init client failed, %v", err)
-		return
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	var (
+		tcs   []*models.TiDBCluster
+		total = -1
+	)
+	switch {
+	case listCmdFlags.Version != "":
+		tcs, err = cli.GetTiDBClustersByVersion(ctx, listCmdFlags.Version)
+	case listCmdFlags.Status != "":
+		tcs, err = cli.GetTiDBClustersByStatus(ctx, listCmdFlags.Status)
+	case paged && filter == nil && len(selector) == 0:
+		// only the page is loaded, filtering needs all the clusters
+		tcs, total, err = cli.LoadTiDBClustersPaged(ctx, listCmdFlags.Offset, listCmdFlags.Limit)
+	default:
+		tcs, err = cli.LoadTiDBClusters(ctx)
 	}
-	tc, err := cli.LoadTiDBClusters()
 	if err != nil {
-		cmd.Printf("load list failed, %v", err)
-		return
+		return fmt.Errorf("load list failed, %v", err)
+	}
+
+	tc := make([]*models.TiDBCluster, 0, len(tcs))
+	for _, t := range tcs {
+		if listCmdFlags.Status != "" && t.Status != listCmdFlags.Status {
+			continue
+		}
+		tc = append(tc, t)
+	}
+	if filter != nil {
+		tc = filter.Filter(tc)
+	}
+	if len(selector) > 0 {
+		matched := tc[:0]
+		for _, t := range tc {
+			if selector.match(t) {
+				matched = append(matched, t)
+			}
+		}
+		tc = matched
+	}
+	sort.Slice(tc, func(i, j int) bool { return tc[i].Name < tc[j].Name })
+	if total < 0 {
+		total = len(tc)
+		tc = pageTiDBClusters(tc, listCmdFlags.Offset, listCmdFlags.Limit)
+	}
+
+	if out.structured() {
+		items := make([]interface{}, 0, len(tc))
+		for _, t := range tc {
+			items = append(items, t)
+		}
+		return out.writeOutput(cmd, tc, items...)
 	}
+
 	if len(tc) == 0 {
-		return
+		return nil
 	}
 	cmd.Println(GetTiDBClustersTableString(tc))
+	if paged {
+		cmd.Printf("%d-%d of %d tidb clusters\n", listCmdFlags.Offset+1, listCmdFlags.Offset+len(tc), total)
+	}
+
+	return nil
+}
+
+// pageTiDBClusters returns at most limit tidb clusters of tcs from offset, a
+// limit <= 0 returns all the ones from offset.
+func pageTiDBClusters(tcs []*models.TiDBCluster, offset, limit int) []*models.TiDBCluster {
+	if offset >= len(tcs) {
+		return tcs[len(tcs):]
+	}
+	tcs = tcs[offset:]
+	if limit > 0 && limit < len(tcs) {
+		tcs = tcs[:limit]
+	}
+	return tcs
 }
@@ -0,0 +1,163 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/client"
+	"github.com/tidbops/tim/pkg/models"
+)
+
+// clusterLock is the content of the lock file of a tidb cluster, it tells who
+// is operating the tidb cluster.
+type clusterLock struct {
+	Pid     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+}
+
+// lockFile returns the lock file of the tidb cluster at path, it is beside the
+// tidb-ansible directory which is moved by upgrade and rollback.
+func lockFile(path string) string {
+	return filepath.Clean(path) + ".tim.lock"
+}
+
+// lockTiDBCluster acquires the advisory lock of tc for the mutating command
+// cmd, it fails if another tim process holds it. A stale lock left by a
+// crashed process is only removed with --force-unlock, the lock of a process
+// still running on this node is never removed. The returned func releases the
+// lock.
+func lockTiDBCluster(cmd *cobra.Command, tc *models.TiDBCluster) (func(), error) {
+	file := lockFile(tc.Path)
+	if forceUnlock(cmd) {
+		if l := readClusterLock(file); l != nil && l.Host == strings.ToLower(getHostName()) && processAlive(l.Pid) {
+			return nil, fmt.Errorf("cluster %s is locked by %d/%s, %s is still running, --force-unlock only removes a stale lock",
+				tc.Name, l.Pid, l.Host, l.Command)
+		}
+		if err := os.Remove(file); err == nil {
+			log.Warnf("the lock of %s is removed by --force-unlock", tc.Name)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("remove the lock of %s failed, %v", tc.Name, err)
+		}
+	}
+
+	l := &clusterLock{
+		Pid:     os.Getpid(),
+		Host:    strings.ToLower(getHostName()),
+		Command: cmd.CommandPath(),
+		Time:    time.Now(),
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, lockedError(tc.Name, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock %s failed, %v", tc.Name, err)
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(file)
+		return nil, fmt.Errorf("lock %s failed, %v", tc.Name, err)
+	}
+
+	return func() {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Warnf("release the lock of %s failed, %v", tc.Name, err)
+		}
+	}, nil
+}
+
+// lockAndReloadTiDBCluster acquires the lock of tc like lockTiDBCluster and
+// reads tc again from the store, so the command checks the tidb cluster left
+// by the previous holder of the lock instead of tc. It fails if the path or
+// the host of tc is changed meanwhile, the lock is of the old path then.
+func lockAndReloadTiDBCluster(
+	ctx context.Context,
+	cmd *cobra.Command,
+	cli client.Client,
+	tc *models.TiDBCluster,
+) (*models.TiDBCluster, func(), error) {
+	unlock, err := lockTiDBCluster(cmd, tc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	locked, err := cli.GetTiDBClusterByName(ctx, tc.Name)
+	if err != nil {
+		unlock()
+		return nil, nil, fmt.Errorf("reload %s tidb cluster failed, %v", tc.Name, err)
+	}
+	if locked.Path != tc.Path || locked.Host != tc.Host {
+		unlock()
+		return nil, nil, fmt.Errorf("%s tidb cluster is moved to %s:%s while locking it, run the command again",
+			tc.Name, locked.Host, locked.Path)
+	}
+	return locked, unlock, nil
+}
+
+// lockedError describes the holder of the existing lock file of the tidb
+// cluster name.
+func lockedError(name string, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("cluster %s is locked, %v", name, err)
+	}
+	l := &clusterLock{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return fmt.Errorf("cluster %s is locked by an invalid lock file %s, use --force-unlock to remove it", name, file)
+	}
+
+	msg := fmt.Sprintf("cluster %s is locked by %d/%s since %s", name, l.Pid, l.Host,
+		l.Time.Format("2006-01-02 15:04:05"))
+	if l.Host == strings.ToLower(getHostName()) && !processAlive(l.Pid) {
+		return fmt.Errorf("%s, the process is not running, use --force-unlock to remove the stale lock", msg)
+	}
+	return fmt.Errorf("%s, %s is running", msg, l.Command)
+}
+
+// readClusterLock returns the content of the lock file, nil if it is missing
+// or invalid.
+func readClusterLock(file string) *clusterLock {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	l := &clusterLock{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil
+	}
+	return l
+}
+
+// processAlive returns whether the process of pid is running on this node.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+func forceUnlock(cmd *cobra.Command) bool {
+	force, err := cmd.Flags().GetBool("force-unlock")
+	return err == nil && force
+}
@@ -0,0 +1,131 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/client"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+// storeClient is a client.Client of a single tidb cluster, the other methods
+// are not implemented.
+type storeClient struct {
+	client.Client
+	tc *models.TiDBCluster
+}
+
+func (c *storeClient) GetTiDBClusterByName(ctx context.Context, name string) (*models.TiDBCluster, error) {
+	tc := *c.tc
+	return &tc, nil
+}
+
+func lockCommand(forceUnlock bool) *cobra.Command {
+	cmd := &cobra.Command{Use: "upgrade"}
+	cmd.Flags().Bool("force-unlock", forceUnlock, "")
+	return cmd
+}
+
+func writeLock(t *testing.T, file string, pid int) {
+	t.Helper()
+	data, err := json.Marshal(&clusterLock{
+		Pid:     pid,
+		Host:    strings.ToLower(getHostName()),
+		Command: "tim upgrade",
+		Time:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	root, err := ioutil.TempDir("", "tim-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	tc := &models.TiDBCluster{Name: "tidb", Path: filepath.Join(root, "tidb")}
+	file := lockFile(tc.Path)
+
+	// the lock of a running process is kept
+	writeLock(t, file, os.Getpid())
+	if _, err := lockTiDBCluster(lockCommand(true), tc); err == nil {
+		t.Fatal("--force-unlock removed the lock of a running process")
+	}
+	if !utils.FileExists(file) {
+		t.Fatal("the lock of a running process is removed")
+	}
+
+	// the lock of a process not running is stale
+	writeLock(t, file, 1<<30)
+	if _, err := lockTiDBCluster(lockCommand(false), tc); err == nil {
+		t.Fatal("locked without --force-unlock over a stale lock")
+	}
+	unlock, err := lockTiDBCluster(lockCommand(true), tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &clusterLock{}
+	if err := json.Unmarshal(data, l); err != nil || l.Pid != os.Getpid() {
+		t.Errorf("lock %s, want the one of pid %d", data, os.Getpid())
+	}
+	unlock()
+	if utils.FileExists(file) {
+		t.Error("the lock is not released")
+	}
+}
+
+func TestLockAndReloadTiDBCluster(t *testing.T) {
+	root, err := ioutil.TempDir("", "tim-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	tc := &models.TiDBCluster{
+		Name:   "tidb",
+		Path:   filepath.Join(root, "tidb"),
+		Host:   strings.ToLower(getHostName()),
+		Status: models.TiDBRunning,
+	}
+
+	// the status changed by the previous holder of the lock is returned
+	stored := *tc
+	stored.Status = models.TiDBUpgradeBackedUp
+	cli := &storeClient{tc: &stored}
+	locked, unlock, err := lockAndReloadTiDBCluster(ctx, lockCommand(false), cli, tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked.Status != models.TiDBUpgradeBackedUp {
+		t.Errorf("status %s, want %s of the store", locked.Status, models.TiDBUpgradeBackedUp)
+	}
+	unlock()
+
+	// the lock of the old path does not protect a moved tidb cluster
+	stored.Path = filepath.Join(root, "tidb-new")
+	if _, _, err := lockAndReloadTiDBCluster(ctx, lockCommand(false), cli, tc); err == nil {
+		t.Fatal("locked a tidb cluster moved meanwhile")
+	}
+	if utils.FileExists(lockFile(tc.Path)) {
+		t.Error("the lock of the moved tidb cluster is not released")
+	}
+}
@@ -0,0 +1,104 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/models"
+)
+
+// notifyTimeout is the time limit of posting a notification.
+const notifyTimeout = 10 * time.Second
+
+// upgradeNotification is the json payload posted to the notify url when an
+// upgrade of a tidb cluster ends, Text is a summary for the chat webhooks
+// like slack.
+type upgradeNotification struct {
+	Text          string    `json:"text"`
+	Cluster       string    `json:"cluster"`
+	FromVersion   string    `json:"from_version"`
+	TargetVersion string    `json:"target_version"`
+	Status        string    `json:"status"`
+	Result        string    `json:"result"`
+	Error         string    `json:"error,omitempty"`
+	Operator      string    `json:"operator"`
+	Host          string    `json:"host"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+}
+
+// getNotifyURL returns the webhook url from the --notify-url flag or the
+// TIM_NOTIFY_URL env, it is empty if neither is set.
+func getNotifyURL(cmd *cobra.Command) string {
+	if notifyURL, err := cmd.Flags().GetString("notify-url"); err == nil && notifyURL != "" {
+		return notifyURL
+	}
+
+	return os.Getenv("TIM_NOTIFY_URL")
+}
+
+// notifyUpgrade posts the outcome of the upgrade recorded in h to url, it is
+// best-effort, a failure is logged and does not fail the upgrade.
+func notifyUpgrade(url string, tc *models.TiDBCluster, h *models.UpgradeHistory) {
+	if url == "" {
+		return
+	}
+
+	n := &upgradeNotification{
+		Cluster:       h.Name,
+		FromVersion:   h.FromVersion,
+		TargetVersion: h.TargetVersion,
+		Status:        tc.Status,
+		Result:        h.Result,
+		Error:         h.Error,
+		Operator:      h.Operator,
+		Host:          h.Host,
+		StartTime:     h.StartTime,
+		EndTime:       h.EndTime,
+	}
+	n.Text = fmt.Sprintf("tim upgrade %s from %s to %s: %s, status %s", n.Cluster, n.FromVersion, n.TargetVersion, n.Result, n.Status)
+	if n.Error != "" {
+		n.Text += ", " + n.Error
+	}
+
+	if err := postNotification(url, n); err != nil {
+		log.Warnf("notify the upgrade of %s to %s failed, %v", h.Name, url, err)
+	}
+}
+
+func postNotification(url string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// the upgrade context may be cancelled, a failure is notified too
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s, %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
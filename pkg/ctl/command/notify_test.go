@@ -0,0 +1,138 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/models"
+)
+
+func TestGetNotifyURL(t *testing.T) {
+	saved := os.Getenv("TIM_NOTIFY_URL")
+	defer os.Setenv("TIM_NOTIFY_URL", saved)
+
+	notifyCommand := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{Use: "upgrade"}
+		cmd.Flags().String("notify-url", "", "")
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+		return cmd
+	}
+
+	cases := []struct {
+		env  string
+		args []string
+		want string
+	}{
+		{"", nil, ""},
+		{"http://env/hook", nil, "http://env/hook"},
+		{"", []string{"--notify-url", "http://flag/hook"}, "http://flag/hook"},
+		// the flag wins over the env
+		{"http://env/hook", []string{"--notify-url", "http://flag/hook"}, "http://flag/hook"},
+	}
+	for _, c := range cases {
+		os.Setenv("TIM_NOTIFY_URL", c.env)
+		if got := getNotifyURL(notifyCommand(c.args...)); got != c.want {
+			t.Errorf("env %q args %v: notify url %q, want %q", c.env, c.args, got, c.want)
+		}
+	}
+
+	// a command without the flag takes the env
+	os.Setenv("TIM_NOTIFY_URL", "http://env/hook")
+	if got := getNotifyURL(&cobra.Command{}); got != "http://env/hook" {
+		t.Errorf("notify url %q without the flag, want the env", got)
+	}
+}
+
+func TestNotifyUpgrade(t *testing.T) {
+	var (
+		posted []upgradeNotification
+		status = http.StatusOK
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s with content type %q, want a json post", r.Method, r.Header.Get("Content-Type"))
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		n := upgradeNotification{}
+		if err := json.Unmarshal(data, &n); err != nil {
+			t.Errorf("invalid payload %s, %v", data, err)
+		}
+		posted = append(posted, n)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	start := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	tc := &models.TiDBCluster{Name: "tidb", Status: models.TiDBWaitingUpgrade}
+	h := &models.UpgradeHistory{
+		Name:          "tidb",
+		FromVersion:   "v3.0.4",
+		TargetVersion: "v3.0.5",
+		Result:        models.UpgradeGenerated,
+		Operator:      "tidb",
+		Host:          "tim-1",
+		StartTime:     start,
+		EndTime:       start.Add(time.Minute),
+	}
+	notifyUpgrade(server.URL, tc, h)
+	if len(posted) != 1 {
+		t.Fatalf("%d notifications posted, want 1", len(posted))
+	}
+	n := posted[0]
+	want := upgradeNotification{
+		Text:          n.Text,
+		Cluster:       "tidb",
+		FromVersion:   "v3.0.4",
+		TargetVersion: "v3.0.5",
+		Status:        models.TiDBWaitingUpgrade,
+		Result:        models.UpgradeGenerated,
+		Operator:      "tidb",
+		Host:          "tim-1",
+		StartTime:     h.StartTime,
+		EndTime:       h.EndTime,
+	}
+	if !n.StartTime.Equal(want.StartTime) || !n.EndTime.Equal(want.EndTime) {
+		t.Errorf("times %v - %v, want %v - %v", n.StartTime, n.EndTime, want.StartTime, want.EndTime)
+	}
+	n.StartTime, n.EndTime = want.StartTime, want.EndTime
+	if n != want {
+		t.Errorf("posted %+v, want %+v", n, want)
+	}
+	if !strings.Contains(n.Text, "tidb from v3.0.4 to v3.0.5") {
+		t.Errorf("text %q has no versions", n.Text)
+	}
+
+	// a failure is notified with its error, and a failed post does not
+	// fail the upgrade
+	status = http.StatusInternalServerError
+	h.Result = models.UpgradeFailed
+	h.Error = "rolling update failed"
+	tc.Status = models.TiDBUpgrading
+	notifyUpgrade(server.URL, tc, h)
+	if len(posted) != 2 {
+		t.Fatalf("%d notifications posted, want 2", len(posted))
+	}
+	n = posted[1]
+	if n.Error != h.Error || n.Result != models.UpgradeFailed || n.Status != models.TiDBUpgrading ||
+		!strings.Contains(n.Text, h.Error) {
+		t.Errorf("posted %+v, want the failure", n)
+	}
+
+	// no url posts nothing
+	notifyUpgrade("", tc, h)
+	if len(posted) != 2 {
+		t.Errorf("%d notifications posted without a url", len(posted))
+	}
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+// goTemplatePrefix is the prefix of an --output go template, e.g.
+// go-template='{{.Name}} {{.Version}}'.
+const goTemplatePrefix = "go-template="
+
+// outputFormat is a parsed --output flag, the format is the name of a builtin
+// one or go-template with tmpl set.
+type outputFormat struct {
+	format string
+	tmpl   *template.Template
+}
+
+// parseOutputFormat parses the --output flag of a command supporting the
+// structured formats json / yaml / go-template and the builtin ones.
+func parseOutputFormat(output string, builtin ...string) (*outputFormat, error) {
+	if strings.HasPrefix(output, goTemplatePrefix) {
+		text := strings.TrimPrefix(output, goTemplatePrefix)
+		// a missing field is an error, a missing label is empty
+		tmpl, err := template.New("output").Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid go-template %q, %v", text, err)
+		}
+		return &outputFormat{format: "go-template", tmpl: tmpl}, nil
+	}
+
+	for _, f := range append(builtin, "json", "yaml") {
+		if output == f {
+			return &outputFormat{format: output}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("output format %s is not supported, support %s / json / yaml / go-template=<template>",
+		output, strings.Join(builtin, " / "))
+}
+
+// structured returns whether the format is json, yaml or go-template, which
+// are written by writeOutput.
+func (o *outputFormat) structured() bool {
+	return o.format == "json" || o.format == "yaml" || o.format == "go-template"
+}
+
+// writeOutput writes v in the structured format. The go template is executed
+// against every item of items, one line each, and v is not used then, so a
+// list can be templated by item.
+func (o *outputFormat) writeOutput(cmd *cobra.Command, v interface{}, items ...interface{}) error {
+	switch o.format {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(data))
+	case "yaml":
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data, err = jsonToYAML(data)
+		if err != nil {
+			return err
+		}
+		cmd.Print(string(data))
+	case "go-template":
+		// the output is written after all the items are executed, so an
+		// error is not mixed with partial output
+		var buf bytes.Buffer
+		for _, item := range items {
+			if err := o.tmpl.Execute(&buf, item); err != nil {
+				return fmt.Errorf("execute go-template failed, %v", err)
+			}
+			buf.WriteString("\n")
+		}
+		cmd.Print(buf.String())
+	default:
+		return fmt.Errorf("output format %s is not structured", o.format)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/client"
+	"github.com/tidbops/tim/pkg/models"
+)
+
+type PlaybookCommandFlags struct {
+	Execute bool
+	Force   bool
+}
+
+var (
+	playbookCmdFlags = &PlaybookCommandFlags{}
+)
+
+// rollingUpdatePlaybooks are the playbooks upgrading a tidb cluster to the
+// version of its tidb-ansible files, in order.
+var rollingUpdatePlaybooks = []string{"local_prepare.yml", "excessive_rolling_update.yml"}
+
+func NewPlaybookCommand() *cobra.Command {
+	playbookCmd := &cobra.Command{
+		Use:   "playbook <name>",
+		Short: "show the ansible playbook commands to run for a tidb cluster by its status",
+		Args:  exactArgs(1),
+		RunE:  playbookCommandFunc,
+	}
+
+	playbookCmd.Flags().BoolVar(&playbookCmdFlags.Execute, "execute", false,
+		"run the playbooks in the tidb-ansible directory with streamed output")
+	playbookCmd.Flags().BoolVar(&playbookCmdFlags.Force, "force", false,
+		"run the playbooks without asking")
+
+	return playbookCmd
+}
+
+func playbookCommandFunc(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	playbooks, note := statusPlaybooks(tc)
+	cmd.Printf("# %s\n", note)
+	if len(playbooks) == 0 {
+		return nil
+	}
+	printPlaybooks(cmd, tc.Path, playbooks)
+
+	if !playbookCmdFlags.Execute {
+		return nil
+	}
+
+	if tc.Host != strings.ToLower(getHostName()) {
+		return fmt.Errorf("%s tidb-ansible files not on this node, you should login to %s to operate tidb cluster",
+			tc.Name, tc.Host)
+	}
+
+	status := tc.Status
+	tc, unlock, err := lockAndReloadTiDBCluster(ctx, cmd, cli, tc)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// the playbooks shown are of the status before the lock is acquired
+	if tc.Status != status {
+		return fmt.Errorf("%s changed from status %s to %s, run playbook again to see its playbooks",
+			tc.Name, status, tc.Status)
+	}
+	if !confirmDestructive(cmd, fmt.Sprintf("Do you want to run the playbooks of %s?", tc.Name), playbookCmdFlags.Force) {
+		return nil
+	}
+
+	if tc.Status != models.TiDBWaitingUpgrade && tc.Status != models.TiDBUpgrading {
+		// the playbooks of the other statuses deploy or start the tidb cluster
+		if err := runPlaybooks(ctx, cmd, tc.Path, playbooks); err != nil {
+			return err
+		}
+		return setTiDBClusterStatus(ctx, cli, tc, models.TiDBRunning)
+	}
+
+	h := newUpgradeHistory(tc, models.OperationUpgrade, tc.Version)
+	if _, version, err := findUpgradeBackup(tc.Path); err == nil && version != "" {
+		h.FromVersion = version
+	}
+	err = executeRollingUpdate(ctx, cmd, cli, tc, h)
+	recordUpgradeHistory(cli, h, err)
+	return err
+}
+
+// statusPlaybooks returns the playbooks to run for tc in its status and a
+// note of them, there are none if tc is up to date or in an interrupted
+// upgrade.
+func statusPlaybooks(tc *models.TiDBCluster) ([]string, string) {
+	switch tc.Status {
+	case string(models.TiDBInited):
+		return []string{"local_prepare.yml", "bootstrap.yml", "deploy.yml", "start.yml"},
+			fmt.Sprintf("%s is %s, deploy and start the %s tidb cluster:", tc.Name, tc.Status, tc.Version)
+	case models.TiDBStoped:
+		return []string{"start.yml"},
+			fmt.Sprintf("%s is %s, start it:", tc.Name, tc.Status)
+	case models.TiDBWaitingUpgrade, models.TiDBUpgrading:
+		return rollingUpdatePlaybooks,
+			fmt.Sprintf("%s is %s, run the rolling update to %s:", tc.Name, tc.Status, tc.Version)
+	case models.TiDBUpgradeBackedUp, models.TiDBAnsibleReinited:
+		return nil, fmt.Sprintf("%s is %s, the upgrade was interrupted, "+
+			"resume it by tim upgrade %s --target-version <version> or rollback it first", tc.Name, tc.Status, tc.Name)
+	default:
+		return nil, fmt.Sprintf("%s is %s, no playbooks to run", tc.Name, tc.Status)
+	}
+}
+
+// executeRollingUpdate runs the rolling update playbooks of tc, the status is
+// Upgraded if they succeed and back to WaitingUpgrade if one fails.
+func executeRollingUpdate(
+	ctx context.Context,
+	cmd *cobra.Command,
+	cli client.Client,
+	tc *models.TiDBCluster,
+	h *models.UpgradeHistory,
+) error {
+	if err := setTiDBClusterStatus(ctx, cli, tc, models.TiDBUpgrading); err != nil {
+		return err
+	}
+
+	if err := runPlaybooks(ctx, cmd, tc.Path, rollingUpdatePlaybooks); err != nil {
+		if e := setTiDBClusterStatus(context.Background(), cli, tc, models.TiDBWaitingUpgrade); e != nil {
+			log.Warnf("change %s status back to %s failed, %v", tc.Name, models.TiDBWaitingUpgrade, e)
+		}
+		return err
+	}
+
+	if err := setTiDBClusterStatus(ctx, cli, tc, models.TiDBUpgraded); err != nil {
+		return err
+	}
+	h.Result = models.UpgradeSucceeded
+	cmd.Printf("Success! %s upgraded to %s\n", tc.Name, tc.Version)
+	return nil
+}
+
+// printPlaybooks prints the commands to run the playbooks in dir.
+func printPlaybooks(cmd *cobra.Command, dir string, playbooks []string) {
+	cmd.Printf("cd %s\n", dir)
+	for _, p := range playbooks {
+		cmd.Printf("ansible-playbook %s\n", p)
+	}
+}
+
+// runPlaybooks runs the playbooks in dir in order with the output streamed to
+// the output of cmd, it stops at the first failed one.
+func runPlaybooks(ctx context.Context, cmd *cobra.Command, dir string, playbooks []string) error {
+	for _, p := range playbooks {
+		log.Infof("run ansible-playbook %s in %s", p, dir)
+		c := exec.CommandContext(ctx, "ansible-playbook", p)
+		c.Dir = dir
+		c.Stdout = cmd.OutOrStdout()
+		c.Stderr = cmd.ErrOrStderr()
+		if err := c.Run(); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				return fmt.Errorf("run %s failed, exit code %d", p, exitErr.ExitCode())
+			}
+			return fmt.Errorf("run %s failed, %v", p, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+)
+
+// Prompter asks the operator for the choices of the commands. The default one
+// prompts on the terminal, a ScriptedPrompter answers without it.
+type Prompter interface {
+	// Select returns the item of items selected for label.
+	Select(label string, items []string) (string, error)
+	// Input returns the line input for label, it is checked by validate if
+	// validate is not nil.
+	Input(label string, validate func(string) error) (string, error)
+	// Confirm returns an error unless label is confirmed.
+	Confirm(label string) error
+	// Interactive returns whether it can ask, the commands refuse to wait for
+	// the choices it can not answer.
+	Interactive() bool
+}
+
+// prompter is the Prompter of the commands.
+var prompter Prompter = &terminalPrompter{}
+
+// SetPrompter replaces the Prompter of the commands, e.g. by a
+// ScriptedPrompter to run them without a terminal. It returns the replaced one.
+func SetPrompter(p Prompter) Prompter {
+	old := prompter
+	prompter = p
+	return old
+}
+
+// terminalPrompter prompts on the terminal by promptui.
+type terminalPrompter struct{}
+
+func (p *terminalPrompter) Select(label string, items []string) (string, error) {
+	prompt := promptui.Select{
+		Label: label,
+		Items: items,
+	}
+	_, result, err := prompt.Run()
+	return result, err
+}
+
+func (p *terminalPrompter) Input(label string, validate func(string) error) (string, error) {
+	prompt := promptui.Prompt{
+		Label: label,
+	}
+	if validate != nil {
+		prompt.Validate = validate
+	}
+	return prompt.Run()
+}
+
+func (p *terminalPrompter) Confirm(label string) error {
+	prompt := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+	}
+	_, err := prompt.Run()
+	return err
+}
+
+// Interactive returns whether stdin is a terminal which prompts can read from.
+func (p *terminalPrompter) Interactive() bool {
+	return isTerminalFile(os.Stdin)
+}
+
+// ScriptedPrompter answers the prompts with Answers in order, a select takes
+// an item, an input a line and a confirm y or yes. It fails when an answer is
+// not valid or they run out.
+type ScriptedPrompter struct {
+	Answers []string
+}
+
+// NewScriptedPrompter returns a ScriptedPrompter of the answers.
+func NewScriptedPrompter(answers ...string) *ScriptedPrompter {
+	return &ScriptedPrompter{Answers: answers}
+}
+
+func (p *ScriptedPrompter) next(label string) (string, error) {
+	if len(p.Answers) == 0 {
+		return "", fmt.Errorf("no answer to %q", label)
+	}
+	answer := p.Answers[0]
+	p.Answers = p.Answers[1:]
+	return answer, nil
+}
+
+func (p *ScriptedPrompter) Select(label string, items []string) (string, error) {
+	answer, err := p.next(label)
+	if err != nil {
+		return "", err
+	}
+	if !containsString(items, answer) {
+		return "", fmt.Errorf("answer %q to %q is not one of %s", answer, label, strings.Join(items, " / "))
+	}
+	return answer, nil
+}
+
+func (p *ScriptedPrompter) Input(label string, validate func(string) error) (string, error) {
+	answer, err := p.next(label)
+	if err != nil {
+		return "", err
+	}
+	if validate != nil {
+		if err := validate(answer); err != nil {
+			return "", err
+		}
+	}
+	return answer, nil
+}
+
+func (p *ScriptedPrompter) Confirm(label string) error {
+	answer, err := p.next(label)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.New("not confirmed")
+}
+
+func (p *ScriptedPrompter) Interactive() bool {
+	return true
+}
@@ -0,0 +1,128 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type PruneCommandFlags struct {
+	KeepBackups int
+	DryRun      bool
+}
+
+var (
+	pruneCmdFlags = &PruneCommandFlags{}
+)
+
+// defaultKeepBackups is the number of the upgrade backups kept of a tidb
+// cluster by default.
+const defaultKeepBackups = 3
+
+func NewPruneCommand() *cobra.Command {
+	pruneCmd := &cobra.Command{
+		Use:   "prune <name>",
+		Short: "remove the old <path>-<version>-bak directories left by the upgrades of a tidb cluster",
+		Args:  exactArgs(1),
+		RunE:  pruneCommandFunc,
+	}
+
+	pruneCmd.Flags().IntVar(&pruneCmdFlags.KeepBackups, "keep-backups", defaultKeepBackups,
+		"the number of the latest backup directories to keep, the one rollback needs is always kept")
+	pruneCmd.Flags().BoolVar(&pruneCmdFlags.DryRun, "dry-run", false,
+		"only show the backup directories that would be removed")
+
+	return pruneCmd
+}
+
+func pruneCommandFunc(cmd *cobra.Command, args []string) error {
+	if pruneCmdFlags.KeepBackups < 1 {
+		return fmt.Errorf("keep-backups %d is invalid, it must be at least 1", pruneCmdFlags.KeepBackups)
+	}
+
+	name := args[0]
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	if tc.Host != strings.ToLower(getHostName()) {
+		return fmt.Errorf("%s tidb-ansible files not on this node, you should login to %s to operate tidb cluster",
+			tc.Name, tc.Host)
+	}
+
+	tc, unlock, err := lockAndReloadTiDBCluster(ctx, cmd, cli, tc)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return pruneUpgradeBackups(cmd, tc, pruneCmdFlags.KeepBackups, pruneCmdFlags.DryRun)
+}
+
+// pruneUpgradeBackups removes the upgrade backup directories of tc but the
+// keep latest ones and reports the space reclaimed. The latest one is what
+// rollback restores and the one of tc.Version is what an interrupted upgrade
+// resumes from, they are never removed. The backups of the tidb clusters
+// whose paths have tc.Path as the prefix are not touched.
+func pruneUpgradeBackups(cmd *cobra.Command, tc *models.TiDBCluster, keep int, dryRun bool) error {
+	backups, err := listUpgradeBackups(tc.Path)
+	if err != nil {
+		return err
+	}
+	if keep < 1 {
+		keep = 1
+	}
+	if len(backups) <= keep {
+		log.Infof("%d backup directories of %s, nothing to prune", len(backups), tc.Name)
+		return nil
+	}
+
+	var reclaimed int64
+	for _, b := range backups[keep:] {
+		if b.Version == tc.Version && !containsString(idleStatuses, tc.Status) {
+			log.Infof("keep %s, %s is in status %s", b.Dir, tc.Name, tc.Status)
+			continue
+		}
+
+		size, err := utils.DirSize(b.Dir)
+		if err != nil {
+			log.Warnf("get the size of %s failed, %v", b.Dir, err)
+		}
+
+		if dryRun {
+			cmd.Printf("would remove %s of %s, %s\n", b.Dir, b.Version, utils.FormatBytes(size))
+			reclaimed += size
+			continue
+		}
+
+		if err := os.RemoveAll(b.Dir); err != nil {
+			return fmt.Errorf("remove %s failed, %v", b.Dir, err)
+		}
+		cmd.Printf("removed %s of %s, %s\n", b.Dir, b.Version, utils.FormatBytes(size))
+		reclaimed += size
+	}
+
+	if dryRun {
+		cmd.Printf("Dry run, %s would be reclaimed, the latest %d backup directories are kept\n",
+			utils.FormatBytes(reclaimed), keep)
+		return nil
+	}
+	cmd.Printf("%s reclaimed, the latest %d backup directories of %s are kept\n",
+		utils.FormatBytes(reclaimed), keep, tc.Name)
+	return nil
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+func TestPruneUpgradeBackupsSharedPrefix(t *testing.T) {
+	root, err := ioutil.TempDir("", "tim-prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// the backups of tidb-2 are interleaved with the ones of tidb, and the
+	// latest of them is what the rollback of tidb-2 needs
+	makeBackupDirs(t, root,
+		"tidb", "tidb-2",
+		"tidb-v3.0.0-bak", "tidb-2-v3.0.0-bak",
+		"tidb-v3.0.1-bak", "tidb-2-v3.0.1-bak",
+		"tidb-v3.0.2-bak", "tidb-2-v3.0.2-bak",
+	)
+
+	tc := &models.TiDBCluster{
+		Name:    "tidb",
+		Path:    filepath.Join(root, "tidb"),
+		Version: "v3.0.3",
+		Status:  models.TiDBRunning,
+	}
+	cmd := &cobra.Command{}
+	out := &bytes.Buffer{}
+	cmd.SetOutput(out)
+	if err := pruneUpgradeBackups(cmd, tc, 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for dir, exist := range map[string]bool{
+		"tidb-v3.0.0-bak":   false,
+		"tidb-v3.0.1-bak":   false,
+		"tidb-v3.0.2-bak":   true,
+		"tidb-2-v3.0.0-bak": true,
+		"tidb-2-v3.0.1-bak": true,
+		"tidb-2-v3.0.2-bak": true,
+	} {
+		if utils.FileExists(filepath.Join(root, dir)) != exist {
+			t.Errorf("%s exists %v, want %v, output:\n%s", dir, !exist, exist, out)
+		}
+	}
+}
+
+func TestPruneUpgradeBackupsKeepsResumeBackup(t *testing.T) {
+	root, err := ioutil.TempDir("", "tim-prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	makeBackupDirs(t, root, "tidb-v3.0.0-bak", "tidb-v3.0.1-bak", "tidb-v3.0.2-bak")
+
+	// an upgrade of v3.0.0 interrupted after the backup resumes from it
+	tc := &models.TiDBCluster{
+		Name:    "tidb",
+		Path:    filepath.Join(root, "tidb"),
+		Version: "v3.0.0",
+		Status:  models.TiDBUpgradeBackedUp,
+	}
+	cmd := &cobra.Command{}
+	cmd.SetOutput(&bytes.Buffer{})
+	if err := pruneUpgradeBackups(cmd, tc, 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for dir, exist := range map[string]bool{
+		"tidb-v3.0.0-bak": true,
+		"tidb-v3.0.1-bak": false,
+		"tidb-v3.0.2-bak": true,
+	} {
+		if utils.FileExists(filepath.Join(root, dir)) != exist {
+			t.Errorf("%s exists %v, want %v", dir, !exist, exist)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/client"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type ReconcileCommandFlags struct {
+	Fix bool
+}
+
+var (
+	reconcileCmdFlags = &ReconcileCommandFlags{}
+)
+
+// clusterDrift is a field of a tidb cluster in the store differing from its
+// tidb-ansible files, Store is empty if Disk describes the drift alone. Hint
+// tells how to fix one --fix can not.
+type clusterDrift struct {
+	Field string
+	Store string
+	Disk  string
+	Fix   func(tc *models.TiDBCluster)
+	Hint  string
+}
+
+func NewReconcileCommand() *cobra.Command {
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile [name...]",
+		Short: "check the version, hosts and status of the tidb clusters in the store against their tidb-ansible files, default all",
+		RunE:  reconcileCommandFunc,
+	}
+
+	reconcileCmd.Flags().BoolVar(&reconcileCmdFlags.Fix, "fix", false,
+		"update the version and hosts in the store to the ones of the tidb-ansible files")
+
+	return reconcileCmd
+}
+
+func reconcileCommandFunc(cmd *cobra.Command, args []string) error {
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	var tcs []*models.TiDBCluster
+	if len(args) == 0 {
+		if tcs, err = cli.LoadTiDBClusters(ctx); err != nil {
+			return fmt.Errorf("load tidb clusters failed, %v", err)
+		}
+	}
+	for _, name := range args {
+		tc, err := cli.GetTiDBClusterByName(ctx, name)
+		if err != nil {
+			return fmt.Errorf("%s tidb cluster not exist", name)
+		}
+		tcs = append(tcs, tc)
+	}
+
+	host := strings.ToLower(getHostName())
+	checked, drifted, unfixed := 0, 0, 0
+	for _, tc := range tcs {
+		if tc.Host != host && tc.SSHAddress == "" {
+			cmd.Printf("%s: skipped, the tidb-ansible files are on %s\n", tc.Name, tc.Host)
+			continue
+		}
+		checked++
+
+		drifts := checkClusterDrifts(ctx, tc)
+		if len(drifts) == 0 {
+			cmd.Printf("%s: in sync\n", tc.Name)
+			continue
+		}
+		drifted++
+
+		cmd.Printf("%s:\n", tc.Name)
+		for _, d := range drifts {
+			if d.Store == "" {
+				cmd.Printf("  %s: %s\n", d.Field, d.Disk)
+			} else {
+				cmd.Printf("  %s: %s in the store, %s on disk\n", d.Field, d.Store, d.Disk)
+			}
+			if d.Fix == nil || !reconcileCmdFlags.Fix {
+				if d.Hint != "" {
+					cmd.Printf("    hint: %s\n", d.Hint)
+				}
+			}
+		}
+
+		n, err := fixClusterDrifts(ctx, cmd, cli, tc, drifts)
+		if err != nil {
+			return err
+		}
+		unfixed += n
+	}
+
+	if drifted == 0 {
+		cmd.Printf("All %d tidb clusters are in sync\n", checked)
+		return nil
+	}
+	if unfixed > 0 {
+		return fmt.Errorf("%d of %d tidb clusters drifted, %d drifts not fixed", drifted, checked, unfixed)
+	}
+	cmd.Printf("%d of %d tidb clusters drifted, all fixed\n", drifted, checked)
+	return nil
+}
+
+// checkClusterDrifts returns the fields of tc in the store differing from its
+// tidb-ansible files, the version and hosts are read from the files, and a
+// status of an upgrade is a drift if no upgrade holds the lock of tc.
+func checkClusterDrifts(ctx context.Context, tc *models.TiDBCluster) []*clusterDrift {
+	var drifts []*clusterDrift
+	if inUpgradeStatus(tc.Status) && tc.SSHAddress == "" && !utils.FileExists(lockFile(tc.Path)) {
+		drifts = append(drifts, &clusterDrift{
+			Field: "status",
+			Store: tc.Status,
+			Disk:  "no upgrade running",
+			Hint: fmt.Sprintf("the upgrade of %s was interrupted, run upgrade to resume it or rollback to restore %s",
+				tc.Name, tc.Version),
+		})
+	}
+
+	path, cleanup, err := clusterFilesPath(ctx, tc)
+	if err != nil {
+		return append(drifts, &clusterDrift{
+			Field: "path",
+			Disk:  fmt.Sprintf("%s unreadable, %v", clusterFileLabel(tc, ""), err),
+			Hint:  "check the ssh address and key of the tidb cluster",
+		})
+	}
+	defer cleanup()
+
+	if _, err := os.Stat(path); err != nil {
+		return append(drifts, &clusterDrift{
+			Field: "path",
+			Disk:  fmt.Sprintf("%s not found", tc.Path),
+			Hint:  fmt.Sprintf("restore the tidb-ansible files, or create %s --force with the new path", tc.Name),
+		})
+	}
+	inv, err := loadInventory(path)
+	if err != nil {
+		return append(drifts, &clusterDrift{
+			Field: "path",
+			Disk:  err.Error(),
+			Hint:  "fix the inventory.ini of the tidb-ansible files",
+		})
+	}
+
+	version := detectTiDBVersion(path, inv.Var("tidb_version"))
+	if version != "" && version != tc.Version {
+		d := &clusterDrift{
+			Field: "version",
+			Store: tc.Version,
+			Disk:  version,
+			Fix:   func(tc *models.TiDBCluster) { tc.Version = version },
+		}
+		// rollback restores the version in the store of an upgrade
+		if inUpgradeStatus(tc.Status) {
+			d.Fix = nil
+			d.Hint = "finish or rollback the upgrade first"
+		}
+		drifts = append(drifts, d)
+	}
+
+	hosts := inv.AllAddresses()
+	if !sameHosts(tc.Hosts, hosts) {
+		drifts = append(drifts, &clusterDrift{
+			Field: "hosts",
+			Store: strings.Join(tc.Hosts, ", "),
+			Disk:  strings.Join(hosts, ", "),
+			Fix:   func(tc *models.TiDBCluster) { tc.Hosts = hosts },
+		})
+	}
+
+	return drifts
+}
+
+// fixClusterDrifts updates tc in the store with the drifts --fix can fix, and
+// returns the number of the ones left.
+func fixClusterDrifts(ctx context.Context, cmd *cobra.Command, cli client.Client, tc *models.TiDBCluster, drifts []*clusterDrift) (int, error) {
+	unfixed := 0
+	var fixes []*clusterDrift
+	for _, d := range drifts {
+		if d.Fix == nil || !reconcileCmdFlags.Fix {
+			unfixed++
+			continue
+		}
+		fixes = append(fixes, d)
+	}
+	if len(fixes) == 0 {
+		return unfixed, nil
+	}
+
+	locked, unlock, err := lockAndReloadTiDBCluster(ctx, cmd, cli, tc)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	// the drifts are of tc before the lock is acquired
+	if locked.Status != tc.Status || locked.Version != tc.Version || !sameHosts(locked.Hosts, tc.Hosts) {
+		return 0, fmt.Errorf("%s tidb cluster is changed while checking it, run reconcile again", tc.Name)
+	}
+	tc = locked
+
+	for _, d := range fixes {
+		d.Fix(tc)
+	}
+	if err := cli.UpdateTiDBCluster(ctx, tc); err != nil {
+		return 0, fmt.Errorf("update %s tidb cluster failed, %v", tc.Name, err)
+	}
+	for _, d := range fixes {
+		cmd.Printf("  fixed %s to %s\n", d.Field, d.Disk)
+	}
+	return unfixed, nil
+}
+
+// inUpgradeStatus returns whether status is one of an upgrade, the ones not in
+// idleStatuses.
+func inUpgradeStatus(status string) bool {
+	for _, s := range idleStatuses {
+		if s == status {
+			return false
+		}
+	}
+	return status != models.TiDBWaitingUpgrade
+}
+
+// sameHosts returns whether a and b have the same addresses in any order.
+func sameHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
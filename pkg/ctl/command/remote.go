@@ -0,0 +1,76 @@
+package command
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+// remoteClusterFiles are the tidb-ansible files fetched from the remote host
+// of a tidb cluster to read its configs and hosts.
+var remoteClusterFiles = []string{"conf", "inventory.ini"}
+
+// clusterSSHTarget returns the remote host of the tidb-ansible files of tc, or
+// nil if they are local.
+func clusterSSHTarget(tc *models.TiDBCluster) (*utils.SSHTarget, error) {
+	if tc.SSHAddress == "" {
+		return nil, nil
+	}
+	return utils.ParseSSHAddress(tc.SSHAddress, tc.SSHKey)
+}
+
+// clusterFilesPath returns the directory to read the tidb-ansible files of tc
+// from and a func to call when they are read. It is tc.Path for a local tidb
+// cluster, the conf and inventory.ini of a remote one are fetched to a
+// temporary directory removed by the func.
+func clusterFilesPath(ctx context.Context, tc *models.TiDBCluster) (string, func(), error) {
+	target, err := clusterSSHTarget(tc)
+	if err != nil || target == nil {
+		return tc.Path, func() {}, err
+	}
+
+	tmpPath, err := ioutil.TempDir("", "tim-remote")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmpPath) }
+
+	log.Infof("fetch %s from %s:%s", strings.Join(remoteClusterFiles, ", "), target, tc.Path)
+	if err := target.FetchFiles(ctx, tc.Path, remoteClusterFiles, tmpPath); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tmpPath, cleanup, nil
+}
+
+// clusterFileLabel returns the name of the file rel of the tidb-ansible files
+// of tc to show, prefixed by the remote host if any.
+func clusterFileLabel(tc *models.TiDBCluster, rel string) string {
+	file := filepath.Join(tc.Path, rel)
+	if tc.SSHAddress != "" {
+		return tc.SSHAddress + ":" + file
+	}
+	return file
+}
+
+// findRemoteUpgradeBackup is findUpgradeBackup of the tidb-ansible files of tc
+// on the remote host target.
+func findRemoteUpgradeBackup(ctx context.Context, target *utils.SSHTarget, tc *models.TiDBCluster) (string, error) {
+	path := filepath.Clean(tc.Path)
+	out, err := target.Output(ctx, "ls -dt "+utils.ShellQuote(path)+"-*-bak 2>/dev/null || true")
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range strings.Fields(string(out)) {
+		if _, ok := upgradeBackupVersion(path, dir); ok {
+			return dir, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,199 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type RestoreCommandFlags struct {
+	Force      bool
+	ResetState bool
+}
+
+var (
+	restoreCmdFlags = &RestoreCommandFlags{}
+)
+
+func NewRestoreCommand() *cobra.Command {
+	restoreCmd := &cobra.Command{
+		Use:   "restore <name> <backup-path>",
+		Short: "restore the config files of a tidb cluster from a backup",
+		Args:  exactArgs(2),
+		RunE:  restoreCommandFunc,
+	}
+
+	restoreCmd.Flags().BoolVar(&restoreCmdFlags.Force, "force", false,
+		"overwrite the config files of the tidb cluster, required")
+	restoreCmd.Flags().BoolVar(&restoreCmdFlags.ResetState, "reset-state", false,
+		"reset the version and status of the tidb cluster to the backup")
+
+	return restoreCmd
+}
+
+func restoreCommandFunc(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	if tc.Host != strings.ToLower(getHostName()) {
+		return fmt.Errorf("%s tidb-ansible files not on this node, you should login to %s to operate tidb cluster",
+			tc.Name, tc.Host)
+	}
+
+	tc, unlock, err := lockAndReloadTiDBCluster(ctx, cmd, cli, tc)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	location, err := resolveBackupPath(tc.Name, args[1])
+	if err != nil {
+		return err
+	}
+
+	meta, err := readBackupMeta(location)
+	if err != nil {
+		return err
+	}
+
+	if meta.Name != tc.Name {
+		return fmt.Errorf("%s is a backup of %s, not %s", location, meta.Name, tc.Name)
+	}
+
+	if !restoreCmdFlags.Force {
+		return fmt.Errorf("restore will overwrite the config files in %s, use --force to confirm it", tc.Path)
+	}
+
+	dir := location
+	if strings.HasSuffix(location, ".tar.gz") {
+		tmpDir, err := ioutil.TempDir("", "tim-restore-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if err := utils.UntarGz(location, tmpDir); err != nil {
+			return fmt.Errorf("extract %s failed, %v", location, err)
+		}
+		dir = tmpDir
+	}
+
+	if err := validateBackupDir(dir); err != nil {
+		return fmt.Errorf("invalid backup %s, %v", location, err)
+	}
+
+	safety, err := createBackup(tc, false, false)
+	if err != nil {
+		return fmt.Errorf("backup %s before restore failed, %v", tc.Name, err)
+	}
+	log.Infof("%s backed up to %s before restore", tc.Name, safety)
+
+	if err := restoreBackupFiles(dir, tc.Path); err != nil {
+		return fmt.Errorf("restore %s failed, %v, the config files before restore are in %s", tc.Name, err, safety)
+	}
+
+	if restoreCmdFlags.ResetState {
+		tc.Version = meta.Version
+		tc.Status = meta.Status
+		if err := cli.UpdateTiDBCluster(ctx, tc); err != nil {
+			return fmt.Errorf("update tidb cluster information failed, %v", err)
+		}
+	}
+
+	cmd.Printf("Success! %s restored from %s\n", tc.Name, location)
+
+	return nil
+}
+
+// resolveBackupPath returns the backup location of path, path can also be the
+// name of a backup in the backups directory of the tidb cluster.
+func resolveBackupPath(name string, path string) (string, error) {
+	if utils.FileExists(path) {
+		return filepath.Abs(path)
+	}
+
+	dir, err := backupsDir(name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, p := range []string{filepath.Join(dir, path), filepath.Join(dir, path+".tar.gz")} {
+		if utils.FileExists(p) {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("backup %s not exist", path)
+}
+
+// validateBackupDir checks the backup has the config files and a valid
+// inventory.ini.
+func validateBackupDir(dir string) error {
+	fi, err := os.Stat(filepath.Join(dir, "conf"))
+	if err != nil || !fi.IsDir() {
+		return fmt.Errorf("conf directory not found")
+	}
+
+	if _, err := loadInventory(dir); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// restoreBackupFiles copies backupFiles in the backup directory src to the
+// tidb-ansible directory dist.
+func restoreBackupFiles(src, dist string) error {
+	for _, f := range backupFiles {
+		srcFile := filepath.Join(src, f)
+		fi, err := os.Stat(srcFile)
+		if os.IsNotExist(err) && f == "hosts.ini" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		distFile := filepath.Join(dist, f)
+		if !fi.IsDir() {
+			if err := utils.CopyFile(srcFile, distFile); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tmpDir := distFile + ".restoring"
+		if err := os.RemoveAll(tmpDir); err != nil {
+			return err
+		}
+		if err := utils.CopyDir(srcFile, tmpDir); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(distFile); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpDir, distFile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
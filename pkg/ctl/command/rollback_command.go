@@ -0,0 +1,103 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type RollbackCommandFlags struct {
+	Force bool
+}
+
+var (
+	rollbackCmdFlags = &RollbackCommandFlags{}
+)
+
+func NewRollbackCommand() *cobra.Command {
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback <name>",
+		Short: "rollback tidb-ansible files from the backup of a failed or aborted upgrade",
+		Args:  exactArgs(1),
+		RunE:  rollbackCommandFunc,
+	}
+
+	rollbackCmd.Flags().BoolVar(&rollbackCmdFlags.Force, "force", false,
+		"remove the tidb-ansible files and restore the backup without asking")
+
+	return rollbackCmd
+}
+
+func rollbackCommandFunc(cmd *cobra.Command, args []string) (err error) {
+	name := args[0]
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	if tc.Host != strings.ToLower(getHostName()) {
+		return fmt.Errorf("%s tidb-ansible files not on this node, you should login to %s to operate tidb cluster",
+			tc.Name, tc.Host)
+	}
+
+	tc, unlock, err := lockAndReloadTiDBCluster(ctx, cmd, cli, tc)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	bakDir, version, err := findUpgradeBackup(tc.Path)
+	if err != nil {
+		return err
+	}
+
+	if bakDir == "" {
+		return fmt.Errorf("no backup directory of %s found, nothing to rollback", tc.Path)
+	}
+
+	label := fmt.Sprintf("Confirm to remove %s and restore it from %s?", tc.Path, bakDir)
+	if !confirmDestructive(cmd, label, rollbackCmdFlags.Force) {
+		return nil
+	}
+
+	h := newUpgradeHistory(tc, models.OperationRollback, version)
+	defer func() { recordUpgradeHistory(cli, h, err) }()
+
+	if utils.FileExists(tc.Path) {
+		// the artifacts of the upgrade rolled back are kept for audit
+		if err := carryUpgradeArtifacts(tc.Path, bakDir); err != nil {
+			log.Warnf("copy the upgrade artifacts of %s to %s failed, %v", tc.Path, bakDir, err)
+		}
+		if err := os.RemoveAll(tc.Path); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(bakDir, tc.Path); err != nil {
+		return err
+	}
+
+	tc.Version = version
+	if err := setTiDBClusterStatus(ctx, cli, tc, models.TiDBRunning); err != nil {
+		return err
+	}
+
+	h.Result = models.UpgradeSucceeded
+	cmd.Printf("Success! %s rollback to %s, tidb-ansible files restored to %s\n", tc.Name, version, tc.Path)
+
+	return nil
+}
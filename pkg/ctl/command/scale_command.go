@@ -0,0 +1,247 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/inventory"
+)
+
+type ScaleCommandFlags struct {
+	AddTiDB    []string
+	AddPD      []string
+	AddTiKV    []string
+	RemoveTiDB []string
+	RemovePD   []string
+	RemoveTiKV []string
+	DryRun     bool
+}
+
+var (
+	scaleCmdFlags = &ScaleCommandFlags{}
+)
+
+// scaleChange is the hosts added to or removed from an inventory group.
+type scaleChange struct {
+	group  string
+	remove bool
+	hosts  []string
+}
+
+func NewScaleCommand() *cobra.Command {
+	scaleCmd := &cobra.Command{
+		Use:   "scale <name>",
+		Short: "add or remove the hosts of a tidb cluster in its inventory.ini",
+		Args:  exactArgs(1),
+		RunE:  scaleCommandFunc,
+	}
+
+	scaleCmd.Flags().StringSliceVar(&scaleCmdFlags.AddTiDB, "add-tidb", nil, "the tidb hosts to add")
+	scaleCmd.Flags().StringSliceVar(&scaleCmdFlags.AddPD, "add-pd", nil, "the pd hosts to add")
+	scaleCmd.Flags().StringSliceVar(&scaleCmdFlags.AddTiKV, "add-tikv", nil, "the tikv hosts to add")
+	scaleCmd.Flags().StringSliceVar(&scaleCmdFlags.RemoveTiDB, "remove-tidb", nil, "the tidb hosts to remove")
+	scaleCmd.Flags().StringSliceVar(&scaleCmdFlags.RemovePD, "remove-pd", nil, "the pd hosts to remove")
+	scaleCmd.Flags().StringSliceVar(&scaleCmdFlags.RemoveTiKV, "remove-tikv", nil, "the tikv hosts to remove")
+	scaleCmd.Flags().BoolVar(&scaleCmdFlags.DryRun, "dry-run", false,
+		"print the changed inventory.ini without writing it")
+
+	return scaleCmd
+}
+
+func scaleCommandFunc(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	// the hosts are added first, so a pd can be replaced in one scale
+	changes := []*scaleChange{
+		{group: inventory.TiDBServers, hosts: scaleCmdFlags.AddTiDB},
+		{group: inventory.PDServers, hosts: scaleCmdFlags.AddPD},
+		{group: inventory.TiKVServers, hosts: scaleCmdFlags.AddTiKV},
+		{group: inventory.TiDBServers, remove: true, hosts: scaleCmdFlags.RemoveTiDB},
+		{group: inventory.PDServers, remove: true, hosts: scaleCmdFlags.RemovePD},
+		{group: inventory.TiKVServers, remove: true, hosts: scaleCmdFlags.RemoveTiKV},
+	}
+
+	var added, removed []string
+	for _, c := range changes {
+		if c.remove {
+			removed = appendDistinct(removed, c.hosts...)
+		} else {
+			added = appendDistinct(added, c.hosts...)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		cmd.Println(cmd.UsageString())
+		return fmt.Errorf("no hosts to add or remove")
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	if tc.Host != strings.ToLower(getHostName()) {
+		return fmt.Errorf("%s tidb-ansible files not on this node, you should login to %s to operate tidb cluster",
+			tc.Name, tc.Host)
+	}
+
+	tc, unlock, err := lockAndReloadTiDBCluster(ctx, cmd, cli, tc)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if !containsString(idleStatuses, tc.Status) {
+		return fmt.Errorf("%s is in status %s, finish or rollback the upgrade before scaling it", tc.Name, tc.Status)
+	}
+
+	file := filepath.Join(tc.Path, "inventory.ini")
+	editor, err := inventory.NewEditor(file)
+	if err != nil {
+		return fmt.Errorf("parse %s failed, %v", file, err)
+	}
+
+	if err := applyScaleChanges(editor, changes); err != nil {
+		return err
+	}
+
+	inv, err := editor.Inventory()
+	if err != nil {
+		return err
+	}
+
+	if scaleCmdFlags.DryRun {
+		cmd.Printf("Dry run, %s would be changed to:\n", file)
+		cmd.Print(editor.String())
+		return nil
+	}
+
+	location, err := createBackup(tc, false, false)
+	if err != nil {
+		return fmt.Errorf("backup %s before scale failed, %v", tc.Name, err)
+	}
+	log.Infof("%s backed up to %s before scale", tc.Name, location)
+
+	if err := editor.Save(); err != nil {
+		return fmt.Errorf("write %s failed, %v, the origin one is in %s", file, err, location)
+	}
+
+	tc.Hosts = inv.AllAddresses()
+	if err := cli.UpdateTiDBCluster(ctx, tc); err != nil {
+		return fmt.Errorf("update tidb cluster information failed, %v", err)
+	}
+
+	cmd.Printf("Success! %s scaled, the origin inventory.ini is backed up to %s\n", tc.Name, location)
+	if isQuiet(cmd) {
+		return nil
+	}
+	cmd.Printf("Run the playbooks in %s to apply it:\n", tc.Path)
+	if len(removed) > 0 {
+		cmd.Println("  # the tikv stores must be deleted by pd-ctl and become Tombstone before they are stopped")
+		cmd.Printf("  ansible-playbook -i %s stop.yml -l %s\n",
+			filepath.Join(location, "inventory.ini"), strings.Join(removed, ","))
+	}
+	if len(added) > 0 {
+		hosts := strings.Join(added, ",")
+		cmd.Printf("  ansible-playbook bootstrap.yml -l %s\n", hosts)
+		cmd.Printf("  ansible-playbook deploy.yml -l %s\n", hosts)
+		cmd.Printf("  ansible-playbook start.yml -l %s\n", hosts)
+	}
+	if len(scaleCmdFlags.AddPD) > 0 || len(scaleCmdFlags.RemovePD) > 0 {
+		cmd.Println("  # the pd members changed, update the configs of the others")
+		cmd.Println("  ansible-playbook rolling_update.yml")
+	}
+	cmd.Println("  ansible-playbook rolling_update_monitor.yml --tags=prometheus")
+
+	return nil
+}
+
+// applyScaleChanges adds and removes the hosts of changes in order, the
+// monitored_servers group follows the changed hosts if it exists. Removing
+// the last host of a required group is an error.
+func applyScaleChanges(editor *inventory.Editor, changes []*scaleChange) error {
+	inv, err := editor.Inventory()
+	if err != nil {
+		return err
+	}
+	_, monitored := inv.Groups[inventory.MonitoredServers]
+
+	for _, c := range changes {
+		for _, host := range c.hosts {
+			if c.remove {
+				if err := editor.RemoveHost(c.group, host); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := editor.AddHost(c.group, host); err != nil {
+				return err
+			}
+			if monitored && !editor.HasHost(inventory.MonitoredServers, host) {
+				if err := editor.AddHost(inventory.MonitoredServers, host); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	inv, err = editor.Inventory()
+	if err != nil {
+		return err
+	}
+
+	for _, group := range inventory.RequiredGroups {
+		if len(inv.Groups[group]) == 0 {
+			return fmt.Errorf("can not remove the last host of %s", group)
+		}
+	}
+
+	if monitored {
+		inUse := make(map[string]bool)
+		for _, addr := range inv.AllAddresses() {
+			inUse[addr] = true
+		}
+		for _, c := range changes {
+			for _, host := range c.hosts {
+				if c.remove && !inUse[host] && editor.HasHost(inventory.MonitoredServers, host) {
+					if err := editor.RemoveHost(inventory.MonitoredServers, host); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// appendDistinct appends the strings of elems not in s yet.
+func appendDistinct(s []string, elems ...string) []string {
+	for _, e := range elems {
+		if !containsString(s, e) {
+			s = append(s, e)
+		}
+	}
+	return s
+}
+
+func containsString(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
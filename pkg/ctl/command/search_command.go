@@ -1,6 +1,8 @@
 package command
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 )
 
@@ -20,7 +22,7 @@ func NewSearchCommand() *cobra.Command {
 	searchCmd := &cobra.Command{
 		Use:   "search",
 		Short: "tidb-clusters search info",
-		Run:   searchCommandFunc,
+		RunE:  searchCommandFunc,
 	}
 	searchCmd.Flags().StringVar(&searchCmdFlags.Name, "n", "", "the name of tidb cluster")
 	searchCmd.Flags().StringVar(&searchCmdFlags.Path, "p", "", "the storage path of the tidb-ansible file")
@@ -30,7 +32,7 @@ func NewSearchCommand() *cobra.Command {
 	return searchCmd
 }
 
-func searchCommandFunc(cmd *cobra.Command, args []string) {
+func searchCommandFunc(cmd *cobra.Command, args []string) error {
 	flags := map[string]interface{}{
 		"name":    searchCmdFlags.Name,
 		"path":    searchCmdFlags.Path,
@@ -40,16 +42,20 @@ func searchCommandFunc(cmd *cobra.Command, args []string) {
 	}
 	cli, err := genClient(cmd)
 	if err != nil {
-		cmd.Printf("init client failed, %v", err)
-		return
+		return fmt.Errorf("init client failed, %v", err)
 	}
-	tc, err := cli.SearchTiDBCluster(flags)
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	tc, err := cli.SearchTiDBCluster(ctx, flags)
 	if err != nil {
-		cmd.Printf("search failed, %v", err)
-		return
+		return fmt.Errorf("search failed, %v", err)
 	}
 	if len(tc) == 0 {
-		return
+		return nil
 	}
 	cmd.Println(GetTiDBClustersTableString(tc))
+
+	return nil
 }
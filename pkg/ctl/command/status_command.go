@@ -0,0 +1,123 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type StatusCommandFlags struct {
+	Output string
+}
+
+var (
+	statusCmdFlags = &StatusCommandFlags{}
+)
+
+func NewStatusCommand() *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:   "status <name>",
+		Short: "show the details of a tidb cluster",
+		Args:  cobra.ExactArgs(1),
+		RunE:  statusCommandFunc,
+	}
+
+	statusCmd.Flags().StringVarP(&statusCmdFlags.Output, "output", "o", "text",
+		"output format, support text / json / yaml / go-template=<template>, e.g. go-template='{{.Name}} {{.Version}}'")
+
+	return statusCmd
+}
+
+func statusCommandFunc(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	out, err := parseOutputFormat(statusCmdFlags.Output, "text")
+	if err != nil {
+		return err
+	}
+
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	if out.structured() {
+		return out.writeOutput(cmd, tc, tc)
+	}
+
+	// the backup and the configs of a remote tidb cluster are read over ssh
+	target, err := clusterSSHTarget(tc)
+	if err != nil {
+		return err
+	}
+	var bakDir string
+	if target != nil {
+		bakDir, err = findRemoteUpgradeBackup(ctx, target, tc)
+	} else {
+		bakDir, _, err = findUpgradeBackup(tc.Path)
+	}
+	if err != nil {
+		return err
+	}
+	if bakDir == "" {
+		bakDir = "none"
+	}
+
+	cmd.Printf("Name:        %s\n", tc.Name)
+	cmd.Printf("Version:     %s\n", tc.Version)
+	cmd.Printf("Path:        %s\n", tc.Path)
+	cmd.Printf("Host:        %s\n", tc.Host)
+	if tc.SSHAddress != "" {
+		cmd.Printf("SSH:         %s\n", tc.SSHAddress)
+	}
+	cmd.Printf("Hosts:       %s\n", strings.Join(tc.Hosts, ", "))
+	cmd.Printf("Status:      %s\n", tc.Status)
+	cmd.Printf("Description: %s\n", tc.Description)
+	cmd.Printf("InitTime:    %s\n", tc.InitTime.Format("2006-01-02 15:04:05"))
+	cmd.Printf("Backup:      %s\n", bakDir)
+	if len(tc.Labels) > 0 {
+		cmd.Printf("Labels:      %s\n", strings.Join(formatLabels(tc.Labels), ","))
+	}
+
+	if tc.ConfigMode != "" {
+		config := tc.ConfigMode
+		if tc.ConfigFile != "" {
+			config = fmt.Sprintf("%s, %s", tc.ConfigMode, tc.ConfigFile)
+		}
+		cmd.Printf("Config:      %s\n", config)
+	}
+	if len(tc.ConfigHashes) == 0 {
+		return nil
+	}
+	path, cleanup, err := clusterFilesPath(ctx, tc)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	for _, component := range configComponents {
+		hash, ok := tc.ConfigHashes[component]
+		if !ok {
+			continue
+		}
+		// the config may be changed by hand or a rollback after the upgrade
+		file := filepath.Join(path, "conf", configFilePaths[component])
+		if current, err := utils.FileSHA256(file); err != nil || current != hash {
+			hash += " (changed since the upgrade)"
+		}
+		cmd.Printf("%-12s %s\n", configFilePaths[component]+":", hash)
+	}
+
+	return nil
+}
@@ -1,17 +1,29 @@
 package command
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/manifoldco/promptui"
+	"github.com/bndr/gotabulate"
 	"github.com/ngaut/log"
 	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/client"
+	"github.com/tidbops/tim/pkg/compat"
+	"github.com/tidbops/tim/pkg/inventory"
+	"github.com/tidbops/tim/pkg/metrics"
 	"github.com/tidbops/tim/pkg/models"
 	"github.com/tidbops/tim/pkg/parser"
 	"github.com/tidbops/tim/pkg/utils"
@@ -20,222 +32,1135 @@ import (
 )
 
 const (
-	tikvRawConfigURL = "https://raw.githubusercontent.com/pingcap/tidb-ansible/%s/conf/tikv.yml"
+	// DefaultAnsibleRepoURL is the raw file url of the tidb-ansible repo,
+	// it can be changed by --ansible-repo-url or TIM_ANSIBLE_REPO_URL.
+	DefaultAnsibleRepoURL = "https://raw.githubusercontent.com/pingcap/tidb-ansible"
+
+	// rawConfigURL is formatted with the repo url, version and config file name
+	rawConfigURL = "%s/%s/conf/%s"
 )
 
 const (
-	// InputNew     = "Input a new config file"
+	InputNew     = "Input a new config file"
 	UseOrigin    = "Use the origin config file"
 	UseRuleFiles = "Use the configuration rules file to generate a new configuration file?"
 )
 
+// configModes maps the --config-mode values to the prompt options.
+var configModes = map[string]string{
+	"origin": UseOrigin,
+	"new":    InputNew,
+	"rules":  UseRuleFiles,
+}
+
 type UpgradeCommandFlags struct {
 	TargetVersion string
-	RuleFile      string
+	// RuleFiles are applied in order, the rules of a later one override the
+	// ones of the former
+	RuleFiles []string
+	DryRun    bool
+	// DiffOnly only shows the default config changes of the target version
+	DiffOnly       bool
+	AllowDowngrade bool
+	// ForceMajorJump allows upgrading more than one major version at a time
+	ForceMajorJump bool
+	// CompatMatrix is the compatibility matrix file instead of the builtin one
+	CompatMatrix string
+	NoCache      bool
+	TargetConfig string
+	ConfigMode   string
+	DiffFormat   string
+	WorkDir      string
+	KeepWorkDir  bool
+	All          bool
+	Selector     string
+	FailFast     bool
+	Force        bool
+	// Execute runs the rolling update playbooks instead of printing them
+	Execute       bool
+	ExpandAnchors bool
+	// ArrayMergeKey merges the sequences of maps of the new rules by the key
+	ArrayMergeKey string
+	// KeepBackups is the number of the backup directories kept after the
+	// upgrade, 0 keeps all of them
+	KeepBackups int
+	Reinit      bool
+	// AnsibleManifest is the sha256sum file of the target tidb-ansible files
+	AnsibleManifest string
+	// AnsibleGitURL and AnsibleGitRef are the git repo and ref of the target
+	// tidb-ansible files
+	AnsibleGitURL string
+	AnsibleGitRef string
+	// Component is the comma separated components whose configs are
+	// prepared, compared and generated, all of them by default
+	Component string
+	// ConfigOnly only upgrades the configs of the components in the current
+	// tidb-ansible files
+	ConfigOnly bool
+	// DownloadTimeout is the time limit of downloading a config file
+	DownloadTimeout time.Duration
+	// NotifyURL is the webhook notified when the upgrade of a tidb cluster
+	// ends, TIM_NOTIFY_URL if it is not set
+	NotifyURL string
+	// ConfigCheck checks the target tikv config by tikv-server --config-check
+	// of TiKVBinary before it is applied
+	ConfigCheck bool
+	TiKVBinary  string
+}
+
+// configDiffEntry is a changed key of a component default config, it is the
+// format of --diff-format json.
+type configDiffEntry struct {
+	Component string `json:"component"`
+	tyaml.DiffEntry
 }
 
 var (
 	upgradeCmdFlags = &UpgradeCommandFlags{}
+	// upgradeComponents are the components selected by --component
+	upgradeComponents []string
+)
+
+// the upgrade metrics count the upgrades of the tidb clusters, not the
+// upgrade commands, a dry run is not counted
+var (
+	upgradesAttempted = metrics.NewCounterVec("tim_upgrades_attempted_total",
+		"The upgrades of the tidb clusters attempted.")
+	upgradesSucceeded = metrics.NewCounterVec("tim_upgrades_succeeded_total",
+		"The upgrades of the tidb clusters succeeded.")
+	upgradesFailed = metrics.NewCounterVec("tim_upgrades_failed_total",
+		"The upgrades of the tidb clusters failed.")
+	upgradeDuration = metrics.NewHistogramVec("tim_upgrade_duration_seconds",
+		"The time of the upgrades of the tidb clusters, by result success / error.",
+		[]float64{1, 5, 10, 30, 60, 300, 600, 1800, 3600}, "result")
 )
 
 func NewUpgradeCommand() *cobra.Command {
 	upgradeCmd := &cobra.Command{
-		Use:   "upgrade <name>",
+		Use:   "upgrade <name>...",
 		Short: "upgrade tidb version, just generate the new version tidb-ansible files",
-		Run:   upgradeCommandFunc,
+		Args:  upgradeArgs,
+		RunE:  upgradeCommandFunc,
 	}
 
 	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.TargetVersion,
 		"target-version", "", "the version that ready to upgrade to")
-	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.RuleFile, "rule-file", "",
-		"rule files for different version of configuration conversion")
+	upgradeCmd.Flags().StringSliceVar(&upgradeCmdFlags.RuleFiles, "rule-file", nil,
+		"rule files for different version of configuration conversion, multiple ones are applied in order and the later ones override")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.DryRun, "dry-run", false,
+		"only show the generated config and the changes that would be made")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.DiffOnly, "diff-only", false,
+		"only show the changes of the default configs from the cluster version to the target version and exit")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.AllowDowngrade, "allow-downgrade", false,
+		"allow the target version to be lower than the current version")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.ForceMajorJump, "force-major-jump", false,
+		"allow upgrading more than one major version at a time")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.CompatMatrix, "compat-matrix", "",
+		"the compatibility matrix file in yaml or json instead of the builtin one")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.NoCache, "no-cache", false,
+		"download the default config files again even if they are cached")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.TargetConfig, "target-config", "",
+		"use the config file as the target tikv config, skip the prompt")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.ConfigMode, "config-mode", "",
+		"how to init the target config without prompt, support origin / new / rules")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.DiffFormat, "diff-format", "text",
+		"the format of the default config changes, support text / json")
+	upgradeCmdFlags.WorkDir = filepath.Join(os.TempDir(), "tim")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.WorkDir, "work-dir", upgradeCmdFlags.WorkDir,
+		"the directory to keep the downloaded and generated config files")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.KeepWorkDir, "keep-work-dir", false,
+		"keep the files in the work dir after the tidb-ansible files are generated")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.All, "all", false,
+		"upgrade all the tidb clusters")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.Selector, "selector", "",
+		"upgrade the tidb clusters matching the comma separated key=value pairs, "+
+			"support name / version / status / host / path and the labels, e.g. version=v3.0.5,team=payments")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.FailFast, "fail-fast", false,
+		"stop at the first failed tidb cluster when upgrading multiple tidb clusters")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.Execute, "execute", false,
+		"run the rolling update playbooks with streamed output instead of printing the commands to run them")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.Force, "force", false,
+		"run the rolling update playbooks of --execute without asking")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.Reinit, "reinit", false,
+		"remove the tidb-ansible files left by an interrupted upgrade and init them again")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.AnsibleManifest, "ansible-manifest", "",
+		"verify the target tidb-ansible files with the sha256 checksums of the file in the format of sha256sum")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.AnsibleGitURL, "ansible-git-url", TiDBAnsibleURL,
+		"the git repo to clone the target tidb-ansible files from")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.AnsibleGitRef, "ansible-git-ref", "",
+		"the branch, tag or commit of the target tidb-ansible files to check out, default the branch of the target version")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.ArrayMergeKey, "array-merge-key", "",
+		"merge the lists of maps of the new rules into the config by the value of the key of the maps, e.g. name")
+	upgradeCmd.Flags().IntVar(&upgradeCmdFlags.KeepBackups, "keep-backups", defaultKeepBackups,
+		"prune the backup directories of the tidb cluster but the latest ones after the upgrade, 0 keeps all")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.ExpandAnchors, "expand-anchors", false,
+		"expand the yaml anchors and aliases of the configs changed by the rules instead of keeping them")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.Component, "component", allComponents,
+		"the comma separated components whose configs the upgrade prepares, compares and generates, "+
+			"support "+supportedComponents()+" / all, the others keep their configs")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.ConfigOnly, "config-only", false,
+		"only write the configs of the components to the conf of the current tidb-ansible files without init them")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.NotifyURL, "notify-url", "",
+		"post the result of the upgrade of each tidb cluster in json to the webhook url, default TIM_NOTIFY_URL")
+	upgradeCmd.Flags().DurationVar(&upgradeCmdFlags.DownloadTimeout, "download-timeout", utils.DownloadTimeout,
+		"the time limit of downloading a default config file, 0 means no limit")
+	upgradeCmd.Flags().BoolVar(&upgradeCmdFlags.ConfigCheck, "config-check", false,
+		"check the target tikv config by tikv-server --config-check of --tikv-binary before applying it")
+	upgradeCmd.Flags().StringVar(&upgradeCmdFlags.TiKVBinary, "tikv-binary", "tikv-server",
+		"the tikv-server binary of the target version to check the target tikv config by --config-check")
 
 	return upgradeCmd
 }
 
-func upgradeCommandFunc(cmd *cobra.Command, args []string) {
-	if len(args) < 0 {
-		cmd.Println("name is required")
+func upgradeCommandFunc(cmd *cobra.Command, args []string) error {
+	if upgradeCmdFlags.TargetVersion == "" {
 		cmd.Println(cmd.UsageString())
-		return
+		return errors.New("target-version flag is required")
 	}
 
-	if upgradeCmdFlags.TargetVersion == "" {
-		cmd.Println("target-version flag is required")
-		cmd.Println(cmd.UsageString())
-		return
+	if _, err := utils.ParseVersion(upgradeCmdFlags.TargetVersion); err != nil {
+		return err
+	}
+
+	if upgradeCmdFlags.DiffFormat != "text" && upgradeCmdFlags.DiffFormat != "json" {
+		return fmt.Errorf("diff-format %s is invalid, support text / json", upgradeCmdFlags.DiffFormat)
+	}
+
+	components, err := parseComponents(upgradeCmdFlags.Component)
+	if err != nil {
+		return err
+	}
+	// the target config of config-mode new is a tikv config
+	if !containsString(components, "tikv") && (upgradeCmdFlags.ConfigMode == "new" || upgradeCmdFlags.TargetConfig != "") {
+		return fmt.Errorf("config-mode new and target-config require component tikv")
+	}
+	upgradeComponents = components
+
+	batch := len(args) > 1 || upgradeCmdFlags.All || upgradeCmdFlags.Selector != ""
+	if batch && !upgradeCmdFlags.DiffOnly && upgradeCmdFlags.ConfigMode == "" && upgradeCmdFlags.TargetConfig == "" && !assumeYes(cmd) {
+		return errors.New("config-mode or target-config flag is required to upgrade multiple tidb clusters")
 	}
 
-	name := args[0]
 	cli, err := genClient(cmd)
 	if err != nil {
-		cmd.Printf("init client failed, %v\n", err)
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	utils.DownloadTimeout = upgradeCmdFlags.DownloadTimeout
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	if !batch {
+		tc, err := cli.GetTiDBClusterByName(ctx, args[0])
+		if err != nil {
+			return fmt.Errorf("%s tidb cluster not exist", args[0])
+		}
+		if upgradeCmdFlags.DiffOnly {
+			return diffDefaultConfigs(ctx, cmd, tc)
+		}
+		return upgradeTiDBCluster(ctx, cmd, cli, tc, false)
 	}
 
-	tc, err := cli.GetTiDBClusterByName(name)
+	tcs, err := selectUpgradeClusters(ctx, cli, args)
 	if err != nil {
-		cmd.Printf("%s tidb cluster not exist\n", name)
-		return
+		return err
+	}
+	if len(tcs) == 0 {
+		return errors.New("no tidb cluster matched")
 	}
 
-	if tc.Host != strings.ToLower(getHostName()) {
-		cmd.Printf("%s tidb-ansible files not on this node, you should login to %s to operate tidb cluster\n",
-			tc.Name, tc.Host)
-		return
+	if upgradeCmdFlags.DiffOnly {
+		for _, tc := range tcs {
+			if upgradeCmdFlags.DiffFormat != "json" {
+				cmd.Printf("%s %s -> %s:\n", tc.Name, tc.Version, upgradeCmdFlags.TargetVersion)
+			}
+			if err := diffDefaultConfigs(ctx, cmd, tc); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	tmpID := time.Now().Unix()
-	tmpPath := fmt.Sprintf("/tmp/tim/%s/%d", tc.Name, tmpID)
+	results := make([]*upgradeResult, 0, len(tcs))
+	failed := 0
+	for _, tc := range tcs {
+		r := &upgradeResult{Name: tc.Name, Version: tc.Version}
+		results = append(results, r)
+		if (upgradeCmdFlags.FailFast && failed > 0) || ctx.Err() != nil {
+			r.Result = "Skipped"
+			continue
+		}
+
+		log.Infof("upgrade %s from %s to %s", tc.Name, tc.Version, upgradeCmdFlags.TargetVersion)
+		if err := upgradeTiDBCluster(ctx, cmd, cli, tc, true); err != nil {
+			failed++
+			r.Result = fmt.Sprintf("Failed: %v", err)
+			log.Errorf("upgrade %s failed, %v", tc.Name, err)
+			continue
+		}
+		r.Result = "Success"
+	}
+
+	cmd.Println(getUpgradeResultsTableString(results))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tidb clusters failed to upgrade", failed, len(tcs))
+	}
 
-	// just prepare tikv config fot demo
-	// TODO: support prepare pd / tidb config
-	oldTiKVConfig, targetTiKVConfig, err := prepareConfigFile(tc, upgradeCmdFlags.TargetVersion, tmpPath)
+	return nil
+}
+
+// observeUpgrade counts an upgrade of a tidb cluster started at start with
+// the outcome err.
+func observeUpgrade(start time.Time, err error) {
+	upgradesAttempted.Inc()
 	if err != nil {
-		cmd.Println("prepare config file failed, %v", err)
+		upgradesFailed.Inc()
+		upgradeDuration.ObserveSince(start, "error")
 		return
 	}
+	upgradesSucceeded.Inc()
+	upgradeDuration.ObserveSince(start, "success")
+}
+
+// upgradeArgs checks the names of the tidb clusters to upgrade, --all and
+// --selector select the tidb clusters instead of names.
+func upgradeArgs(cmd *cobra.Command, args []string) error {
+	selected := upgradeCmdFlags.All || upgradeCmdFlags.Selector != ""
+	switch {
+	case upgradeCmdFlags.All && upgradeCmdFlags.Selector != "":
+		return errors.New("all and selector flags can not be used together")
+	case selected && len(args) > 0:
+		return errors.New("tidb cluster names can not be used with all or selector flag")
+	case !selected && len(args) == 0:
+		cmd.Println(cmd.UsageString())
+		return fmt.Errorf("%s requires at least 1 arg(s), received 0", cmd.UseLine())
+	}
+	return nil
+}
+
+// upgradeResult is the result of a tidb cluster upgraded with others.
+type upgradeResult struct {
+	Name    string
+	Version string
+	Result  string
+}
+
+func getUpgradeResultsTableString(results []*upgradeResult) string {
+	var arr [][]string
+	for _, r := range results {
+		arr = append(arr, []string{r.Name, r.Version, r.Result})
+	}
+	t := gotabulate.Create(arr)
+	t.SetHeaders([]string{"Name", "Version", "Result"})
+	t.SetAlign("right")
+	return t.Render("grid")
+}
+
+// selectUpgradeClusters returns the tidb clusters of names, or the ones
+// selected by --all or --selector.
+func selectUpgradeClusters(ctx context.Context, cli client.Client, names []string) ([]*models.TiDBCluster, error) {
+	if len(names) > 0 {
+		tcs := make([]*models.TiDBCluster, 0, len(names))
+		for _, name := range names {
+			tc, err := cli.GetTiDBClusterByName(ctx, name)
+			if err != nil {
+				return nil, fmt.Errorf("%s tidb cluster not exist", name)
+			}
+			tcs = append(tcs, tc)
+		}
+		return tcs, nil
+	}
 
-	diffStr, err := tyaml.Diff(oldTiKVConfig, targetTiKVConfig, true)
+	selector, err := parseSelector(upgradeCmdFlags.Selector)
 	if err != nil {
-		cmd.Printf("compare %s %s failed, %v\n", oldTiKVConfig, targetTiKVConfig, err)
-		return
+		return nil, err
+	}
+
+	all, err := cli.LoadTiDBClusters(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(diffStr) > 0 {
-		cmd.Println("Default tikv config has changed!")
-		cmd.Println(diffStr)
+	tcs := make([]*models.TiDBCluster, 0, len(all))
+	for _, tc := range all {
+		if selector.match(tc) {
+			tcs = append(tcs, tc)
+		}
 	}
+	sort.Slice(tcs, func(i, j int) bool { return tcs[i].Name < tcs[j].Name })
+
+	return tcs, nil
+}
 
-	var useInitRule bool
-	var ruleFile string
+// clusterSelector matches the tidb clusters by the fields, the version can be
+// a constraint like <v4.0.0. The other keys match the labels.
+type clusterSelector map[string]string
 
-	if upgradeCmdFlags.RuleFile != "" {
-		prompt := promptui.Prompt{
-			Label: fmt.Sprintf("Confirm to use %s rule file generate config files?",
-				upgradeCmdFlags.RuleFile),
-			IsConfirm: true,
+func parseSelector(s string) (clusterSelector, error) {
+	selector := clusterSelector{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
 		}
 
-		_, err := prompt.Run()
-		if err == nil {
-			useInitRule = true
-			ruleFile = upgradeCmdFlags.RuleFile
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("selector %s is invalid, it should be key=value", pair)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "name", "version", "status", "host", "path":
+		default:
+			if err := checkLabel(key, value); err != nil {
+				return nil, fmt.Errorf("selector key %s is neither name / version / status / host / path nor a label, %v", key, err)
+			}
+		}
+		selector[key] = value
+	}
+
+	if v, ok := selector["version"]; ok && strings.ContainsAny(v[:1], "<>!=") {
+		if _, err := utils.ParseVersionConstraint(v); err != nil {
+			return nil, err
 		}
 	}
 
-	result := UseRuleFiles
-	if !useInitRule {
-		prompt := promptui.Select{
-			Label: "Select to init Config",
-			Items: []string{
-				UseOrigin,
-				UseRuleFiles,
-			},
+	return selector, nil
+}
+
+func (s clusterSelector) match(tc *models.TiDBCluster) bool {
+	for key, value := range s {
+		switch key {
+		case "name":
+			if tc.Name != value {
+				return false
+			}
+		case "status":
+			if tc.Status != value {
+				return false
+			}
+		case "host":
+			if tc.Host != strings.ToLower(value) {
+				return false
+			}
+		case "path":
+			if tc.Path != strings.ToLower(value) {
+				return false
+			}
+		case "version":
+			if !matchVersion(tc.Version, value) {
+				return false
+			}
+		default:
+			if label, ok := tc.Labels[key]; !ok || label != value {
+				return false
+			}
 		}
+	}
+	return true
+}
+
+// matchVersion returns true if version satisfies the constraint, a version
+// not in vX.Y.Z format is only compared as a string.
+func matchVersion(version, constraint string) bool {
+	c, err := utils.ParseVersionConstraint(constraint)
+	if err != nil {
+		return version == constraint
+	}
+	v, err := utils.ParseVersion(version)
+	if err != nil {
+		return c.Op == "!="
+	}
+	return c.Match(v)
+}
+
+// diffDefaultConfigs prints the changes of the default configs of the selected
+// components from the version of tc to the target version, tc is not changed.
+func diffDefaultConfigs(ctx context.Context, cmd *cobra.Command, tc *models.TiDBCluster) error {
+	tmpPath, err := ioutil.TempDir("", "tim-diff")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	src := &configSource{
+		RepoURL: getAnsibleRepoURL(cmd),
+		NoCache: upgradeCmdFlags.NoCache,
+	}
+	configPairs, err := prepareConfigFile(ctx, tc, upgradeCmdFlags.TargetVersion, tmpPath, upgradeComponents, src)
+	if err != nil {
+		return fmt.Errorf("prepare config file failed, %v", err)
+	}
+
+	changed, err := printDefaultConfigDiffs(cmd, configPairs)
+	if err != nil {
+		return err
+	}
+	if !changed && upgradeCmdFlags.DiffFormat != "json" {
+		cmd.Printf("Default %s configs are the same in %s and %s\n",
+			strings.Join(upgradeComponents, ", "), tc.Version, upgradeCmdFlags.TargetVersion)
+	}
+	return nil
+}
+
+// printDefaultConfigDiffs prints the changes of the default configs of
+// configPairs in --diff-format and returns whether any of them is changed.
+func printDefaultConfigDiffs(cmd *cobra.Command, configPairs []*configFilePair) (bool, error) {
+	if upgradeCmdFlags.DiffFormat == "json" {
+		return len(configPairs) > 0, printConfigDiffJSON(cmd, configPairs)
+	}
 
-		_, result, err = prompt.Run()
+	changed := false
+	for _, pair := range configPairs {
+		diffStr, err := tyaml.Diff(pair.Old, pair.Target, true)
 		if err != nil {
-			cmd.Println(err)
+			return false, fmt.Errorf("compare %s %s failed, %v", pair.Old, pair.Target, err)
+		}
+
+		if len(diffStr) > 0 {
+			changed = true
+			cmd.Printf("Default %s config has changed!\n", pair.Component)
+			cmd.Println(diffStr)
+		}
+	}
+	return changed, nil
+}
+
+// upgradeTiDBCluster generates the target version tidb-ansible files of tc,
+// no prompt is shown in batch mode and the upgrade stops after the files are
+// generated.
+func upgradeTiDBCluster(
+	ctx context.Context,
+	cmd *cobra.Command,
+	cli client.Client,
+	tc *models.TiDBCluster,
+	batch bool,
+) (err error) {
+	if tc.Host != strings.ToLower(getHostName()) {
+		return fmt.Errorf("%s tidb-ansible files not on this node, you should login to %s to operate tidb cluster",
+			tc.Name, tc.Host)
+	}
+
+	tc, unlock, err := lockAndReloadTiDBCluster(ctx, cmd, cli, tc)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// a dry run changes nothing, it is not recorded or notified
+	h := newUpgradeHistory(tc, models.OperationUpgrade, upgradeCmdFlags.TargetVersion)
+	defer func() {
+		if !upgradeCmdFlags.DryRun {
+			recordUpgradeHistory(cli, h, err)
+			notifyUpgrade(getNotifyURL(cmd), tc, h)
+			observeUpgrade(h.StartTime, err)
+		}
+	}()
+
+	// an interrupted upgrade is resumed from its status, the origin
+	// tidb-ansible files are in the backup directory then
+	bakDir := fmt.Sprintf("%s-%s-bak", tc.Path, tc.Version)
+	srcPath := tc.Path
+	resumeStatus := ""
+	configOnly := upgradeCmdFlags.ConfigOnly
+	switch {
+	case configOnly:
+		if !containsString(idleStatuses, tc.Status) {
+			return fmt.Errorf("%s is in status %s, finish or rollback the upgrade before upgrading the %s configs",
+				tc.Name, tc.Status, strings.Join(upgradeComponents, ", "))
+		}
+	case tc.Status == models.TiDBWaitingUpgrade || tc.Status == models.TiDBUpgrading:
+		return resumeRollingUpdate(ctx, cmd, cli, tc, h, batch)
+	case tc.Status == models.TiDBUpgradeBackedUp || tc.Status == models.TiDBAnsibleReinited:
+		resumeStatus = tc.Status
+		srcPath = bakDir
+		if !utils.FileExists(bakDir) {
+			return fmt.Errorf("%s is in status %s, but the backup directory %s is not found", tc.Name, tc.Status, bakDir)
+		}
+		log.Infof("resume the upgrade of %s from status %s", tc.Name, tc.Status)
+	default:
+		if err := models.CheckTiDBStatusTransition(tc.Status, models.TiDBUpgradeBackedUp); err != nil {
+			return fmt.Errorf("%s can not be upgraded, %v", tc.Name, err)
+		}
+		if utils.FileExists(bakDir) {
+			return fmt.Errorf("backup directory %s already exists, remove or move it to upgrade %s", bakDir, tc.Name)
+		}
+	}
+
+	if resumeStatus == models.TiDBAnsibleReinited && !upgradeCmdFlags.Reinit {
+		ref := targetAnsibleSource().ref(upgradeCmdFlags.TargetVersion)
+		if version, err := ansibleVersion(tc.Path); err == nil && version != ref {
+			return fmt.Errorf("%s has the tidb-ansible files of %s, use --reinit to init the %s ones",
+				tc.Path, version, ref)
+		}
+	}
+
+	// the target version is validated, a current version in the store not in
+	// vX.Y.Z format is not compared
+	if c, err := utils.CompareVersions(upgradeCmdFlags.TargetVersion, tc.Version); err == nil && c < 0 &&
+		!upgradeCmdFlags.AllowDowngrade {
+		return fmt.Errorf("target version %s is lower than %s current version %s, use --allow-downgrade to force it",
+			upgradeCmdFlags.TargetVersion, tc.Name, tc.Version)
+	}
+
+	// the playbooks of the target version are not run by a config only upgrade
+	if !configOnly {
+		if err := checkCompatibility(tc.Name, tc.Version, upgradeCmdFlags.TargetVersion); err != nil {
+			return err
+		}
+	}
+
+	inv, err := loadInventory(srcPath)
+	if err != nil {
+		return err
+	}
+	log.Infof("%s inventory.ini: %d tidb servers, %d pd servers, %d tikv servers", tc.Name,
+		len(inv.Groups[inventory.TiDBServers]), len(inv.Groups[inventory.PDServers]),
+		len(inv.Groups[inventory.TiKVServers]))
+	tc.Hosts = inv.AllAddresses()
+
+	tmpID := time.Now().Unix()
+	tmpPath, err := makeWorkDir(upgradeCmdFlags.WorkDir, tc.Name, tmpID)
+	if err != nil {
+		return fmt.Errorf("create work dir failed, %v", err)
+	}
+
+	// the work dir is removed once the target config is in place, it is kept
+	// on failure for inspecting
+	workDone := false
+	defer func() {
+		if !workDone || upgradeCmdFlags.KeepWorkDir {
+			log.Infof("work files are kept in %s", tmpPath)
 			return
 		}
+		if err := os.RemoveAll(tmpPath); err != nil {
+			log.Warnf("remove work dir %s failed, %v", tmpPath, err)
+		}
+	}()
+
+	src := &configSource{
+		RepoURL: getAnsibleRepoURL(cmd),
+		NoCache: upgradeCmdFlags.NoCache,
+	}
+	if isTerminalFile(os.Stderr) {
+		src.Progress = os.Stderr
+	}
+	configPairs, err := prepareConfigFile(ctx, tc, upgradeCmdFlags.TargetVersion, tmpPath, upgradeComponents, src)
+	if err != nil {
+		return fmt.Errorf("prepare config file failed, %v", err)
+	}
+
+	if !isQuiet(cmd) {
+		if _, err := printDefaultConfigDiffs(cmd, configPairs); err != nil {
+			return err
+		}
 	}
 
-	srcTiKVConfigFile := fmt.Sprintf("%s/conf/tikv.yml", tc.Path)
-	distTiKVConfigFile := fmt.Sprintf("%s/tikv-origin.yml", tmpPath)
-	if err := utils.CopyFile(srcTiKVConfigFile, distTiKVConfigFile); err != nil {
-		cmd.Println(err)
-		return
+	var (
+		result      string
+		ruleFiles   []string
+		interactive bool
+	)
+
+	switch {
+	case upgradeCmdFlags.ConfigMode != "":
+		mode, ok := configModes[upgradeCmdFlags.ConfigMode]
+		if !ok {
+			return fmt.Errorf("config-mode %s is invalid, support origin / new / rules", upgradeCmdFlags.ConfigMode)
+		}
+		result = mode
+		ruleFiles = upgradeCmdFlags.RuleFiles
+	case upgradeCmdFlags.TargetConfig != "":
+		result = InputNew
+	case assumeYes(cmd):
+		// use the confirmed rule files, or keep the origin config
+		result = UseOrigin
+		if len(upgradeCmdFlags.RuleFiles) > 0 {
+			result = UseRuleFiles
+			ruleFiles = upgradeCmdFlags.RuleFiles
+		}
+		infof(cmd, "Select to init Config: %s\n", result)
+	case batch:
+		return errors.New("config-mode or target-config flag is required to upgrade multiple tidb clusters")
+	case isQuiet(cmd):
+		return errors.New("config-mode or target-config flag is required in quiet mode")
+	case !prompter.Interactive():
+		return errors.New("stdin is not a terminal, config-mode or target-config flag is required")
+	default:
+		interactive = true
+		result, ruleFiles, err = promptConfigMode()
+		if err != nil {
+			return err
+		}
+	}
+
+	h.ConfigMode = configModeName(result)
+
+	originFiles, err := copyOriginConfigs(srcPath, tmpPath)
+	if err != nil {
+		return err
 	}
 
-	var targetTiKVConfigFile string
+	// targetFiles are the config files to put into conf of every component,
+	// the components not changed keep their origin files
+	targetFiles := make(map[string]string, len(originFiles))
+	for component, file := range originFiles {
+		targetFiles[component] = file
+	}
 
 	switch result {
 	case UseOrigin:
-		targetTiKVConfigFile = distTiKVConfigFile
+	case InputNew:
+		if _, ok := originFiles["tikv"]; !ok {
+			return fmt.Errorf("%s/conf/tikv.yml not found", tc.Path)
+		}
+		var targetTiKVConfigFile string
+		switch {
+		case upgradeCmdFlags.TargetConfig != "":
+			targetTiKVConfigFile = upgradeCmdFlags.TargetConfig
+			err = validateConfigFile(targetTiKVConfigFile)
+		case interactive:
+			targetTiKVConfigFile, err = prompter.Input("TiKV Config File", validateConfigFile)
+		default:
+			err = fmt.Errorf("target-config flag is required by config-mode new")
+		}
+		targetFiles["tikv"] = targetTiKVConfigFile
+		h.ConfigFile = targetTiKVConfigFile
 	case UseRuleFiles:
-		_, targetTiKVConfigFile, err = generateConfigByRuleFile(
-			cmd, distTiKVConfigFile, tmpPath, "tikv", ruleFile)
+		ruleFiles, err = confirmRuleFiles(cmd, ruleFiles, interactive)
+		if err != nil {
+			return err
+		}
+		h.ConfigFile = strings.Join(ruleFiles, ",")
+
+		var generated map[string]string
+		generated, err = generateConfigsByRuleFiles(originFiles, tmpPath, ruleFiles, upgradeComponents)
+		if err == nil {
+			err = confirmGeneratedConfigs(cmd, originFiles, generated, batch)
+		}
+		for component, file := range generated {
+			targetFiles[component] = file
+		}
 	default:
-		cmd.Printf("%s is invalid\n", result)
-		return
+		return fmt.Errorf("%s is invalid", result)
 	}
 
 	if err != nil {
-		cmd.Println(err)
-		return
+		return err
+	}
+	warnDeprecatedOptions(tc.Name, upgradeCmdFlags.TargetVersion, targetFiles)
+	if file, ok := targetFiles["tikv"]; ok && upgradeCmdFlags.ConfigCheck {
+		if err := checkTiKVConfig(ctx, upgradeCmdFlags.TiKVBinary, file); err != nil {
+			return err
+		}
 	}
 
-	bakDir := fmt.Sprintf("%s-%s-bak", tc.Path, tc.Version)
-	if err := os.Rename(tc.Path, bakDir); err != nil {
-		cmd.Println(err)
-		return
+	if configOnly {
+		files := make(map[string]string, len(upgradeComponents))
+		for _, component := range upgradeComponents {
+			file, ok := targetFiles[component]
+			if !ok {
+				return fmt.Errorf("%s/conf/%s not found", srcPath, configFilePaths[component])
+			}
+			files[component] = file
+		}
+		if err := upgradeComponentConfigs(ctx, cmd, cli, tc, h, files); err != nil {
+			return err
+		}
+		if !upgradeCmdFlags.DryRun {
+			saveUpgradeArtifacts(tc, h, tmpPath)
+		}
+		workDone = true
+		return nil
 	}
 
-	if err := initTiDBAnsible(upgradeCmdFlags.TargetVersion, tc.Path); err != nil {
-		cmd.Println(err)
-		return
+	initAnsible := resumeStatus != models.TiDBAnsibleReinited || upgradeCmdFlags.Reinit
+	if upgradeCmdFlags.DryRun {
+		for _, component := range configComponents {
+			file, ok := targetFiles[component]
+			if !ok || (file == originFiles[component] && component != "tikv") {
+				continue
+			}
+
+			targetConfig, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			cmd.Printf("Target %s config:\n", component)
+			cmd.Println(string(targetConfig))
+		}
+		cmd.Println("Dry run, the following changes would be made:")
+		if resumeStatus != "" {
+			cmd.Printf("  resume the upgrade from status %s\n", resumeStatus)
+		} else {
+			cmd.Printf("  move %s to %s\n", tc.Path, bakDir)
+		}
+		if initAnsible {
+			src := targetAnsibleSource()
+			cmd.Printf("  init %s tidb-ansible files of %s %s to %s\n", upgradeCmdFlags.TargetVersion,
+				src.gitURL(), src.ref(upgradeCmdFlags.TargetVersion), tc.Path)
+		}
+		cmd.Printf("  copy inventory.ini, hosts.ini and conf from %s to %s\n", bakDir, tc.Path)
+		for _, component := range configComponents {
+			if file, ok := targetFiles[component]; ok {
+				cmd.Printf("  replace %s/conf/%s with %s\n", tc.Path, configFilePaths[component], file)
+			}
+		}
+		cmd.Printf("  update %s version from %s to %s, status to %s\n",
+			tc.Name, tc.Version, upgradeCmdFlags.TargetVersion, models.TiDBWaitingUpgrade)
+		workDone = true
+		return nil
+	}
+
+	if resumeStatus == "" {
+		if err := os.Rename(tc.Path, bakDir); err != nil {
+			return err
+		}
+		// the backups are ordered by the modification time, the renamed
+		// directory keeps the one of tc.Path
+		now := time.Now()
+		if err := os.Chtimes(bakDir, now, now); err != nil {
+			log.Warnf("touch %s failed, %v", bakDir, err)
+		}
+
+		if err := setTiDBClusterStatus(ctx, cli, tc, models.TiDBUpgradeBackedUp); err != nil {
+			return err
+		}
+	}
+
+	if initAnsible {
+		if utils.FileExists(tc.Path) && !upgradeCmdFlags.Reinit {
+			return fmt.Errorf("%s already exists, use --reinit to remove it and init the %s tidb-ansible files again",
+				tc.Path, upgradeCmdFlags.TargetVersion)
+		}
+
+		if err := initTiDBAnsible(upgradeCmdFlags.TargetVersion, tc.Path, upgradeCmdFlags.Reinit,
+			targetAnsibleSource()); err != nil {
+			return err
+		}
+
+		if err := setTiDBClusterStatus(ctx, cli, tc, models.TiDBAnsibleReinited); err != nil {
+			return err
+		}
 	}
 
 	if err := copyConfigs(bakDir, tc.Path, tc.Version, upgradeCmdFlags.TargetVersion); err != nil {
-		cmd.Println(err)
-		return
+		return err
 	}
 
-	if err := utils.CopyFile(targetTiKVConfigFile,
-		fmt.Sprintf("%s/conf/tikv.yml", tc.Path)); err != nil {
-		cmd.Println(err)
-		return
+	for _, component := range configComponents {
+		file, ok := targetFiles[component]
+		if !ok {
+			continue
+		}
+		if err := utils.CopyFileWithOptions(file, filepath.Join(tc.Path, "conf", configFilePaths[component]), verifyCopy); err != nil {
+			return err
+		}
+	}
+
+	// the artifacts of the former upgrades are moved with the tidb-ansible
+	// files, they are for audit and a failure does not stop the upgrade
+	if err := carryUpgradeArtifacts(bakDir, tc.Path); err != nil {
+		log.Warnf("copy the upgrade artifacts of %s to %s failed, %v", bakDir, tc.Path, err)
+	}
+	saveUpgradeArtifacts(tc, h, tmpPath)
+
+	// the review is informational, a failure does not stop the upgrade
+	if !isQuiet(cmd) {
+		if err := printConfChanges(cmd, filepath.Join(bakDir, "conf"), filepath.Join(tc.Path, "conf"),
+			filepath.Join(tc.Path, "confbak")); err != nil {
+			log.Warnf("compare the conf of %s with the backup failed, %v", tc.Path, err)
+		}
+	}
+
+	if err := recordAppliedConfigs(tc, h); err != nil {
+		return err
 	}
 
 	tc.Version = upgradeCmdFlags.TargetVersion
-	tc.Status = models.TiDBWaitingUpgrade
-	if err := cli.UpdateTiDBCluster(tc); err != nil {
-		fmt.Println(err)
-		return
+	if err := setTiDBClusterStatus(ctx, cli, tc, models.TiDBWaitingUpgrade); err != nil {
+		return err
 	}
 
+	workDone = true
+	h.Result = models.UpgradeGenerated
 	cmd.Printf("Success! Init %s tidb-ansible files saved to %s\n", upgradeCmdFlags.TargetVersion, tc.Path)
+	if upgradeCmdFlags.KeepBackups > 0 {
+		if err := pruneUpgradeBackups(cmd, tc, upgradeCmdFlags.KeepBackups, false); err != nil {
+			log.Warnf("prune the backup directories of %s failed, %v", tc.Name, err)
+		}
+	}
+	if batch && !upgradeCmdFlags.Execute {
+		return nil
+	}
+
+	return runRollingUpdate(ctx, cmd, cli, tc, h)
+}
 
-	promptCon := promptui.Prompt{
-		Label:     "Do you want to continue the upgrade?",
-		IsConfirm: true,
+// upgradeComponentConfigs replaces the configs of the components in the
+// current tidb-ansible files of tc with files by component, the version and
+// the status of tc are kept. The config files are backed up first.
+func upgradeComponentConfigs(
+	ctx context.Context,
+	cmd *cobra.Command,
+	cli client.Client,
+	tc *models.TiDBCluster,
+	h *models.UpgradeHistory,
+	files map[string]string,
+) error {
+	var components []string
+	for _, component := range configComponents {
+		if _, ok := files[component]; ok {
+			components = append(components, component)
+		}
 	}
-	_, err = promptCon.Run()
+	names := strings.Join(components, ", ")
+
+	if upgradeCmdFlags.DryRun {
+		for _, component := range components {
+			targetConfig, err := ioutil.ReadFile(files[component])
+			if err != nil {
+				return err
+			}
+
+			cmd.Printf("Target %s config:\n", component)
+			cmd.Println(string(targetConfig))
+		}
+		cmd.Println("Dry run, the following changes would be made:")
+		cmd.Printf("  backup the config files of %s\n", tc.Name)
+		for _, component := range components {
+			cmd.Printf("  replace %s with %s\n", filepath.Join(tc.Path, "conf", configFilePaths[component]), files[component])
+		}
+		return nil
+	}
+
+	location, err := createBackup(tc, false, false)
 	if err != nil {
-		return
+		return fmt.Errorf("backup %s before upgrading the %s configs failed, %v", tc.Name, names, err)
+	}
+	log.Infof("%s backed up to %s", tc.Name, location)
+
+	for _, component := range components {
+		dist := filepath.Join(tc.Path, "conf", configFilePaths[component])
+		if err := utils.CopyFileWithOptions(files[component], dist, verifyCopy); err != nil {
+			return err
+		}
 	}
 
-	cmd.Println("Start to prepare binary...")
-	localPreS := fmt.Sprintf("cd %s; ansible-playbook local_prepare.yml", tc.Path)
-	pCmd := exec.Command("sh", "-c", localPreS)
-	pStdoutErr, err := pCmd.CombinedOutput()
+	if err := recordAppliedConfigs(tc, h); err != nil {
+		return err
+	}
+	if err := cli.UpdateTiDBCluster(ctx, tc); err != nil {
+		return fmt.Errorf("update tidb cluster information failed, %v", err)
+	}
+
+	h.Result = models.UpgradeGenerated
+	cmd.Printf("Success! %s configs of %s are upgraded for %s, the origin ones are backed up to %s\n",
+		names, tc.Name, upgradeCmdFlags.TargetVersion, location)
+	infof(cmd, "Run the playbook in %s to apply them:\n", tc.Path)
+	infof(cmd, "  ansible-playbook rolling_update.yml --tags=%s\n", strings.Join(components, ","))
+
+	return nil
+}
+
+// recordAppliedConfigs sets the config mode and file of h and the checksums
+// of the config files in the tidb-ansible files of tc to tc, they are saved
+// with tc.
+func recordAppliedConfigs(tc *models.TiDBCluster, h *models.UpgradeHistory) error {
+	tc.ConfigMode = h.ConfigMode
+	tc.ConfigFile = h.ConfigFile
+	if tc.ConfigFile != "" {
+		// the rule files of config-mode rules are separated by ,
+		files := strings.Split(tc.ConfigFile, ",")
+		for i, file := range files {
+			if abs, err := filepath.Abs(file); err == nil {
+				files[i] = abs
+			}
+		}
+		tc.ConfigFile = strings.Join(files, ",")
+	}
+
+	tc.ConfigHashes = make(map[string]string)
+	for _, component := range configComponents {
+		file := filepath.Join(tc.Path, "conf", configFilePaths[component])
+		if !utils.FileExists(file) {
+			continue
+		}
+		hash, err := utils.FileSHA256(file)
+		if err != nil {
+			return err
+		}
+		tc.ConfigHashes[component] = hash
+	}
+
+	return nil
+}
+
+// resumeRollingUpdate continues the upgrade of tc whose target version
+// tidb-ansible files are generated already, the rolling update playbooks are
+// run again if it was interrupted during them.
+func resumeRollingUpdate(
+	ctx context.Context,
+	cmd *cobra.Command,
+	cli client.Client,
+	tc *models.TiDBCluster,
+	h *models.UpgradeHistory,
+	batch bool,
+) error {
+	if tc.Version != upgradeCmdFlags.TargetVersion {
+		return fmt.Errorf("the %s tidb-ansible files of %s are generated already, "+
+			"use --target-version %s to continue the upgrade or rollback it first", tc.Version, tc.Name, tc.Version)
+	}
+
+	if _, version, err := findUpgradeBackup(tc.Path); err == nil && version != "" {
+		h.FromVersion = version
+	}
+	h.Result = models.UpgradeGenerated
+	log.Infof("resume the upgrade of %s from status %s", tc.Name, tc.Status)
+
+	if upgradeCmdFlags.DryRun {
+		cmd.Println("Dry run, the following changes would be made:")
+		cmd.Printf("  run local_prepare.yml and excessive_rolling_update.yml in %s\n", tc.Path)
+		cmd.Printf("  update %s status to %s\n", tc.Name, models.TiDBUpgraded)
+		return nil
+	}
+
+	if batch && !upgradeCmdFlags.Execute {
+		infof(cmd, "The %s tidb-ansible files of %s are generated already in %s\n", tc.Version, tc.Name, tc.Path)
+		return nil
+	}
+
+	return runRollingUpdate(ctx, cmd, cli, tc, h)
+}
+
+// checkCompatibility checks the upgrade of a tidb cluster from version from to
+// target against the compatibility matrix and the major version jump, the
+// warnings are logged and the blocking rules are errors.
+func checkCompatibility(name, from, target string) error {
+	if jump := compat.MajorJump(from, target); jump > 1 {
+		if !upgradeCmdFlags.ForceMajorJump {
+			return fmt.Errorf("upgrading %s from %s to %s jumps %d major versions, "+
+				"upgrade one major version at a time or use --force-major-jump to force it", name, from, target, jump)
+		}
+		log.Warnf("upgrading %s from %s to %s jumps %d major versions", name, from, target, jump)
+	}
+
+	var (
+		m   *compat.Matrix
+		err error
+	)
+	if upgradeCmdFlags.CompatMatrix != "" {
+		m, err = compat.LoadFile(upgradeCmdFlags.CompatMatrix)
+	} else {
+		m, err = compat.Builtin()
+	}
 	if err != nil {
-		cmd.Println(pStdoutErr)
-		return
+		return err
+	}
+
+	var blocked []string
+	for _, issue := range m.Check(from, target, localAnsibleVersion()) {
+		if issue.Level == compat.LevelWarn {
+			log.Warnf("%s: %s", name, issue.Message)
+			continue
+		}
+		blocked = append(blocked, issue.Message)
+	}
+
+	if len(blocked) > 0 {
+		return fmt.Errorf("%s can not be upgraded to %s:\n  %s", name, target, strings.Join(blocked, "\n  "))
 	}
 
-	cmd.Println("Start to rolling update...")
-	rS := fmt.Sprintf("cd %s; ansible-playbook excessive_rolling_update.yml", tc.Path)
-	rollingCmd := exec.Command("sh", "-c", rS)
-	rStdoutErr, err := rollingCmd.CombinedOutput()
+	return nil
+}
+
+// localAnsibleVersion returns the version of the ansible on this node, it is
+// empty if ansible is not found.
+func localAnsibleVersion() string {
+	out, err := exec.Command("ansible", "--version").Output()
 	if err != nil {
-		cmd.Println(rStdoutErr)
-		return
+		log.Debugf("get ansible version failed, %v", err)
+		return ""
 	}
+	return compat.ParseAnsibleVersion(string(out))
+}
 
-	tc.Status = models.TiDBRunning
-	if err := cli.UpdateTiDBCluster(tc); err != nil {
-		cmd.Println(err)
-		return
+// targetAnsibleSource returns the source of the target tidb-ansible files of
+// the upgrade flags.
+func targetAnsibleSource() *ansibleSource {
+	return &ansibleSource{
+		GitURL:   upgradeCmdFlags.AnsibleGitURL,
+		GitRef:   upgradeCmdFlags.AnsibleGitRef,
+		Manifest: upgradeCmdFlags.AnsibleManifest,
+	}
+}
+
+// runRollingUpdate prints the playbooks to upgrade tc to the version of its
+// tidb-ansible files, they are run after confirmed with --execute.
+func runRollingUpdate(
+	ctx context.Context,
+	cmd *cobra.Command,
+	cli client.Client,
+	tc *models.TiDBCluster,
+	h *models.UpgradeHistory,
+) error {
+	if !upgradeCmdFlags.Execute {
+		if !isQuiet(cmd) {
+			cmd.Println("Run the rolling update playbooks to finish the upgrade, or upgrade with --execute to run them:")
+			printPlaybooks(cmd, tc.Path, rollingUpdatePlaybooks)
+		}
+		return nil
 	}
-	cmd.Println("Success!!!")
+
+	if !confirmDestructive(cmd, "Do you want to continue the upgrade?", upgradeCmdFlags.Force) {
+		return nil
+	}
+
+	return executeRollingUpdate(ctx, cmd, cli, tc, h)
+}
+
+// configModeName returns the --config-mode value of the prompt option mode.
+func configModeName(mode string) string {
+	for name, m := range configModes {
+		if m == mode {
+			return name
+		}
+	}
+	return mode
+}
+
+// promptConfigMode asks how to init the target config, it returns the
+// selected option and the confirmed rule files.
+func promptConfigMode() (string, []string, error) {
+	if len(upgradeCmdFlags.RuleFiles) > 0 {
+		label := fmt.Sprintf("Confirm to use %s rule file generate config files?", strings.Join(upgradeCmdFlags.RuleFiles, ", "))
+		if err := prompter.Confirm(label); err == nil {
+			return UseRuleFiles, upgradeCmdFlags.RuleFiles, nil
+		}
+	}
+
+	result, err := prompter.Select("Select to init Config", []string{
+		UseOrigin,
+		InputNew,
+		UseRuleFiles,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return result, nil, nil
 }
 
+// verifyCopy verifies the configs and the inventory copied to the target
+// tidb-ansible files, they are deployed by the rolling update.
+var verifyCopy = &utils.CopyFileOptions{VerifyHash: true}
+
 func copyConfigs(src, dist string, version, target string) error {
 	srcInv := fmt.Sprintf("%s/inventory.ini", src)
 	distInv := fmt.Sprintf("%s/inventory.ini", dist)
 
-	if err := utils.CopyFile(srcInv, distInv); err != nil {
+	if err := utils.CopyFileWithOptions(srcInv, distInv, verifyCopy); err != nil {
 		return err
 	}
 
@@ -245,14 +1170,20 @@ func copyConfigs(src, dist string, version, target string) error {
 
 	srcHost := fmt.Sprintf("%s/hosts.ini", src)
 	distHost := fmt.Sprintf("%s/hosts.ini", dist)
-	if err := utils.CopyFile(srcHost, distHost); err != nil {
+	if err := utils.CopyFileWithOptions(srcHost, distHost, verifyCopy); err != nil {
 		return err
 	}
 
 	srcConf := fmt.Sprintf("%s/conf", src)
 	distConf := fmt.Sprintf("%s/conf", dist)
 
-	if err := os.Rename(distConf, distConf+"bak"); err != nil {
+	// the default conf is kept in confbak, a conf copied by an interrupted
+	// upgrade is copied again
+	if utils.FileExists(distConf + "bak") {
+		if err := os.RemoveAll(distConf); err != nil {
+			return err
+		}
+	} else if err := os.Rename(distConf, distConf+"bak"); err != nil {
 		return err
 	}
 
@@ -263,13 +1194,244 @@ func copyConfigs(src, dist string, version, target string) error {
 	return nil
 }
 
-func generateConfigByRuleFile(
-	cmd *cobra.Command,
-	configFile string,
-	path string,
-	prefix string,
-	ruleFile string,
-) (string, string, error) {
+// printConfChanges prints the files of the final conf changed from the ones
+// of the backup conf for a review before the rolling update, the yaml files
+// are compared by tyaml.Diff. The files of the new version default conf in
+// defaultConf not in the backup are flagged as added by new version, as they
+// are not copied to conf.
+func printConfChanges(cmd *cobra.Command, bakConf, conf, defaultConf string) error {
+	bakFiles, err := listFiles(bakConf)
+	if err != nil {
+		return err
+	}
+	files, err := listFiles(conf)
+	if err != nil {
+		return err
+	}
+	defaultFiles, err := listFiles(defaultConf)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var changes []string
+	for _, name := range files {
+		file := filepath.Join(conf, name)
+		if !containsString(bakFiles, name) {
+			changes = append(changes, fmt.Sprintf("  added %s\n", name))
+			continue
+		}
+
+		bakFile := filepath.Join(bakConf, name)
+		same, err := sameFile(bakFile, file)
+		if err != nil {
+			return err
+		}
+		if same {
+			continue
+		}
+
+		if ext := filepath.Ext(name); ext != ".yml" && ext != ".yaml" {
+			changes = append(changes, fmt.Sprintf("  changed %s\n", name))
+			continue
+		}
+		diffStr, err := tyaml.Diff(bakFile, file, isTerminalFile(os.Stdout))
+		if err != nil {
+			return err
+		}
+		diffStr = "    " + strings.Replace(strings.TrimRight(diffStr, "\n"), "\n", "\n    ", -1)
+		changes = append(changes, fmt.Sprintf("  changed %s:\n%s\n", name, diffStr))
+	}
+	for _, name := range bakFiles {
+		if !containsString(files, name) {
+			changes = append(changes, fmt.Sprintf("  removed %s\n", name))
+		}
+	}
+	for _, name := range defaultFiles {
+		if !containsString(bakFiles, name) {
+			changes = append(changes, fmt.Sprintf("  added by new version %s, it is not in %s but kept in %s\n",
+				name, conf, defaultConf))
+		}
+	}
+
+	if len(changes) == 0 {
+		cmd.Printf("%s is the same as the backup %s\n", conf, bakConf)
+		return nil
+	}
+	cmd.Printf("Changes of %s from the backup %s, review them before the rolling update:\n", conf, bakConf)
+	for _, c := range changes {
+		cmd.Print(c)
+	}
+	return nil
+}
+
+// listFiles returns the paths of the regular files under dir relative to it,
+// sorted.
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// sameFile returns whether the files a and b have the same content.
+func sameFile(a, b string) (bool, error) {
+	hashA, err := utils.FileSHA256(a)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := utils.FileSHA256(b)
+	if err != nil {
+		return false, err
+	}
+	return hashA == hashB, nil
+}
+
+// copyOriginConfigs copies the config files in conf of the tidb-ansible
+// directory to <component>-origin.yml of the work dir, the components without
+// a config file are skipped.
+func copyOriginConfigs(ansiblePath string, path string) (map[string]string, error) {
+	files := make(map[string]string, len(configComponents))
+	for _, component := range configComponents {
+		src := filepath.Join(ansiblePath, "conf", configFilePaths[component])
+		if !utils.FileExists(src) {
+			log.Warnf("%s not found, skip %s config", src, component)
+			continue
+		}
+
+		dist := filepath.Join(path, fmt.Sprintf("%s-origin.yml", component))
+		if err := utils.CopyFile(src, dist); err != nil {
+			return nil, err
+		}
+		files[component] = dist
+	}
+
+	return files, nil
+}
+
+// generateConfigsByRuleFiles generates the target config files from the
+// origin config files of the components by the rule files in order, each one
+// is applied to the configs generated by the former, so the later rules
+// override. A rule file grouped by components has the rules of every
+// component, a plain one only has the tikv rules. It returns the target
+// config files of the components having rules, only the rules of components
+// are used.
+func generateConfigsByRuleFiles(originFiles map[string]string, path string, ruleFiles []string,
+	components []string) (map[string]string, error) {
+	targets := make(map[string]string)
+	for i, ruleFile := range ruleFiles {
+		// the files generated by every rule file are kept apart in the
+		// work dir
+		dir := path
+		if len(ruleFiles) > 1 {
+			dir = filepath.Join(path, fmt.Sprintf("rules-%d", i+1))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, err
+			}
+		}
+
+		all, err := parseRuleFile(ruleFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, component := range components {
+			rules, ok := all[component]
+			if !ok {
+				continue
+			}
+
+			configFile, ok := targets[component]
+			if !ok {
+				configFile, ok = originFiles[component]
+			}
+			if !ok {
+				return nil, fmt.Errorf("%s has %s rules, but the %s config file is not found",
+					ruleFile, component, component)
+			}
+
+			log.Infof("generate the %s config by the rules of %s", component, ruleFile)
+			_, targets[component], err = generateConfigByRuleFile(configFile, dir, component, rules)
+			if err != nil {
+				return nil, fmt.Errorf("generate %s config by %s failed, %v", component, ruleFile, err)
+			}
+		}
+		for component := range all {
+			if !containsString(components, component) {
+				log.Infof("skip the %s rules of %s, the component is not selected", component, ruleFile)
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+// confirmGeneratedConfigs shows the changes the rules made to the origin
+// configs and asks to confirm them before the tidb-ansible files are changed,
+// --yes confirms them. A dry run, a batch upgrade and a stdin which is not a
+// terminal do not ask, the quiet mode neither shows nor asks.
+func confirmGeneratedConfigs(cmd *cobra.Command, originFiles map[string]string, generated map[string]string,
+	batch bool) error {
+	if isQuiet(cmd) {
+		return nil
+	}
+
+	pairs := make([]*configFilePair, 0, len(generated))
+	for _, component := range configComponents {
+		if file, ok := generated[component]; ok {
+			pairs = append(pairs, &configFilePair{Component: component, Old: originFiles[component], Target: file})
+		}
+	}
+
+	if upgradeCmdFlags.DiffFormat == "json" {
+		if err := printConfigDiffJSON(cmd, pairs); err != nil {
+			return err
+		}
+	} else {
+		for _, pair := range pairs {
+			diffStr, err := tyaml.Diff(pair.Old, pair.Target, isTerminalFile(os.Stdout))
+			if err != nil {
+				return fmt.Errorf("compare %s %s failed, %v", pair.Old, pair.Target, err)
+			}
+
+			if len(diffStr) == 0 {
+				cmd.Printf("The rules do not change the %s config\n", pair.Component)
+				continue
+			}
+			cmd.Printf("The rules change the %s config:\n", pair.Component)
+			cmd.Println(diffStr)
+		}
+	}
+
+	if upgradeCmdFlags.DryRun || batch || (!prompter.Interactive() && !assumeYes(cmd)) {
+		return nil
+	}
+
+	if !confirm(cmd, "Confirm to upgrade with the configs generated by the rules?") {
+		return errors.New("the configs generated by the rules are not confirmed")
+	}
+
+	return nil
+}
+
+// confirmRuleFiles returns the rule files to use, it asks for a rule file if
+// none is given and confirms the rules in interactive mode.
+func confirmRuleFiles(cmd *cobra.Command, ruleFiles []string, interactive bool) ([]string, error) {
 	validate := func(input string) error {
 		if exist := utils.FileExists(input); !exist {
 			return fmt.Errorf("file %s not exist", input)
@@ -278,56 +1440,98 @@ func generateConfigByRuleFile(
 		return nil
 	}
 
-	if ruleFile == "" {
-		prompt := promptui.Prompt{
-			Label:    "Rule File",
-			Validate: validate,
+	if len(ruleFiles) == 0 && !interactive {
+		return nil, fmt.Errorf("rule-file flag is required by config-mode rules")
+	}
+
+	if len(ruleFiles) == 0 {
+		result, err := prompter.Input("Rule File", validate)
+		if err != nil {
+			return nil, fmt.Errorf("exit")
+		}
+		ruleFiles = []string{result}
+	}
+
+	for _, ruleFile := range ruleFiles {
+		rules, err := ioutil.ReadFile(ruleFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if isQuiet(cmd) {
+			continue
 		}
+		if len(ruleFiles) > 1 {
+			cmd.Printf("# %s\n", ruleFile)
+		}
+		cmd.Println(string(rules))
+	}
 
-		result, err := prompt.Run()
+	if interactive {
+		err := prompter.Confirm("Confirm whether to generate a configuration file using the above rules?")
 		if err != nil {
-			return "", "", fmt.Errorf("exit")
+			return nil, err
 		}
-		ruleFile = result
 	}
 
-	rules, err := ioutil.ReadFile(ruleFile)
+	return ruleFiles, nil
+}
+
+// parseRuleFile parses the rules of every component of the rule file, the
+// rules of a plain one are the tikv rules.
+func parseRuleFile(ruleFile string) (map[string]*parser.Rules, error) {
+	p := parser.NewParser()
+	multi, err := p.IsMultiComponent(ruleFile, configComponents)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	cmd.Println(string(rules))
-
-	prompC := promptui.Prompt{
-		Label:     "Confirm whether to generate a configuration file using the above rules?",
-		IsConfirm: true,
+	if multi {
+		return p.ParseMulti(ruleFile, configComponents)
 	}
 
-	_, err = prompC.Run()
+	rules, err := p.Parse(ruleFile)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	p := parser.NewParser()
-	newRuleFile, deleteRuleFile, err := p.ParserFile(ruleFile, path, prefix)
+	return map[string]*parser.Rules{"tikv": rules}, nil
+}
+
+// generateConfigByRuleFile renames, deletes and adds the configs of the config
+// file by the rules of a component, it returns the generated config and the
+// <prefix>-target-config.yml it is written to. The rules are written to the
+// rule files of prefix in path too, the new rules are merged from there.
+func generateConfigByRuleFile(
+	configFile string,
+	path string,
+	prefix string,
+	rules *parser.Rules,
+) (string, string, error) {
+	rf, err := rules.WriteFiles(path, prefix)
 	if err != nil {
 		return "", "", err
 	}
 
-	deleteRules := &DeleteRules{}
+	log.Debugf("Rename rule %v", rules.Rename.Rename)
 
-	deleteRuleData, err := ioutil.ReadFile(deleteRuleFile)
+	output, err := tyaml.RenameMultiWithOptions(configFile, renamePaths(rules.Rename), &tyaml.RenameOptions{
+		ExpandAnchors: upgradeCmdFlags.ExpandAnchors,
+	})
 	if err != nil {
 		return "", "", err
 	}
 
-	if err := yaml.Unmarshal(deleteRuleData, deleteRules); err != nil {
+	renamedFile := fmt.Sprintf("%s/%s-renamed.yml", path, prefix)
+	if err := utils.WriteToFile(output, renamedFile); err != nil {
 		return "", "", err
 	}
 
-	log.Debugf("Delete rule %s", deleteRules.Delete)
+	log.Debugf("Delete rule %s", rules.Delete.Delete)
 
-	output, err := tyaml.DeleteMulti(configFile, deleteRules.Delete)
+	output, err = tyaml.DeleteMultiWithOptions(renamedFile, rules.Delete.Delete, &tyaml.DeleteOptions{
+		ExpandAnchors: upgradeCmdFlags.ExpandAnchors,
+	})
 	if err != nil {
 		return "", "", err
 	}
@@ -342,7 +1546,14 @@ func generateConfigByRuleFile(
 		return "", "", err
 	}
 
-	output, err = tyaml.Merge(true, false, waitingForMergeFile, newRuleFile)
+	// the new rules replace the values and the sequences of the config, the
+	// lists of maps are merged by --array-merge-key
+	output, err = tyaml.MergeWithOptions(waitingForMergeFile, &tyaml.MergeOptions{
+		Deep:            true,
+		OverwriteArrays: true,
+		ArrayMergeKey:   upgradeCmdFlags.ArrayMergeKey,
+		ExpandAnchors:   upgradeCmdFlags.ExpandAnchors,
+	}, rf.NewRuleFile)
 	if err != nil {
 		return "", "", err
 	}
@@ -360,26 +1571,237 @@ func generateConfigByRuleFile(
 	return output, targetConfigFile, nil
 }
 
-type DeleteRules struct {
-	Delete []string `yaml:"delete"`
+func validateConfigFile(file string) error {
+	if exist := utils.FileExists(file); !exist {
+		return fmt.Errorf("file %s not exist", file)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var config interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("file %s is not a valid yaml file, %v", file, err)
+	}
+
+	return nil
+}
+
+// checkTiKVConfig checks the tikv config file by tikv-server --config-check of
+// binary, the output of the check is returned verbatim if it fails.
+func checkTiKVConfig(ctx context.Context, binary string, file string) error {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return fmt.Errorf("tikv-binary %s not found, %v, set --tikv-binary or upgrade without --config-check", binary, err)
+	}
+
+	out, err := exec.CommandContext(ctx, path, "--config-check", "--config", file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("tikv config check of %s failed, %v:\n%s", file, err, strings.TrimRight(string(out), "\n"))
+	}
+	log.Infof("tikv config check of %s by %s passed", file, path)
+	return nil
+}
+
+// renamePaths returns the paths of the rename rules in order.
+func renamePaths(r *parser.RenameRules) []tyaml.RenamePath {
+	paths := make([]tyaml.RenamePath, 0, len(r.Rename))
+	for _, item := range r.Rename {
+		paths = append(paths, tyaml.RenamePath{
+			From: fmt.Sprintf("%v", item.Key),
+			To:   fmt.Sprintf("%v", item.Value),
+		})
+	}
+	return paths
+}
+
+// configFilePair holds the default config files of a component
+// for the current version and the target version.
+type configFilePair struct {
+	Component string
+	Old       string
+	Target    string
 }
 
-func prepareConfigFile(tc *models.TiDBCluster, targetVersion string, path string) (string, string, error) {
+// printConfigDiffJSON prints the changes of all the default config files as a
+// json array.
+func printConfigDiffJSON(cmd *cobra.Command, configPairs []*configFilePair) error {
+	entries := make([]*configDiffEntry, 0)
+	for _, pair := range configPairs {
+		diffs, err := tyaml.DiffStructured(pair.Old, pair.Target)
+		if err != nil {
+			return fmt.Errorf("compare %s %s failed, %v", pair.Old, pair.Target, err)
+		}
+
+		for _, d := range diffs {
+			entries = append(entries, &configDiffEntry{Component: pair.Component, DiffEntry: d})
+		}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	cmd.Println(string(data))
+	return nil
+}
+
+// configSource specifies where the default config files are fetched from.
+type configSource struct {
+	RepoURL string
+	NoCache bool
+	// Progress shows the download progress if it is not nil
+	Progress io.Writer
+}
+
+// upgradeArtifactsDir is the directory in the tidb-ansible files of a tidb
+// cluster keeping the work files of its upgrades for audit.
+const upgradeArtifactsDir = ".tim/upgrades"
+
+// saveUpgradeArtifacts copies the work files in workPath of the upgrade h of
+// tc to <path>/.tim/upgrades/<start time> and sets the directory to h, they
+// are for audit and a failure is only logged.
+func saveUpgradeArtifacts(tc *models.TiDBCluster, h *models.UpgradeHistory, workPath string) {
+	dir := filepath.Join(tc.Path, upgradeArtifactsDir, h.StartTime.Format("20060102-150405"))
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		log.Warnf("save the upgrade artifacts of %s failed, %v", tc.Name, err)
+		return
+	}
+	if err := utils.CopyDir(workPath, dir); err != nil {
+		log.Warnf("save the upgrade artifacts of %s failed, %v", tc.Name, err)
+		return
+	}
+
+	h.Artifacts = dir
+	log.Infof("the upgrade artifacts of %s are saved to %s", tc.Name, dir)
+}
+
+// carryUpgradeArtifacts copies the upgrade artifacts of the tidb-ansible
+// directory from to the one of to, the ones to has already are kept.
+func carryUpgradeArtifacts(from, to string) error {
+	src := filepath.Join(from, upgradeArtifactsDir)
+	entries, err := ioutil.ReadDir(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dist := filepath.Join(to, upgradeArtifactsDir)
+	if err := os.MkdirAll(dist, 0755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || utils.FileExists(filepath.Join(dist, entry.Name())) {
+			continue
+		}
+		if err := utils.CopyDir(filepath.Join(src, entry.Name()), filepath.Join(dist, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// makeWorkDir creates the work directory <workDir>/<name>/<id> of an upgrade,
+// it is only accessible by the current user.
+func makeWorkDir(workDir string, name string, id int64) (string, error) {
+	if workDir == "" {
+		return "", fmt.Errorf("work-dir is empty")
+	}
+
+	workDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(workDir, name, strconv.FormatInt(id, 10))
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+func prepareConfigFile(
+	ctx context.Context,
+	tc *models.TiDBCluster,
+	targetVersion string,
+	path string,
+	components []string,
+	src *configSource,
+) ([]*configFilePair, error) {
 	if err := os.MkdirAll(path, os.ModePerm); err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	oldRawTiKVConfigURL := fmt.Sprintf(tikvRawConfigURL, tc.Version)
-	oldTiKVConfigPath := filepath.Join(path, fmt.Sprintf("%s-tikv.yml", tc.Version))
-	if err := utils.DownloadFile(oldRawTiKVConfigURL, oldTiKVConfigPath); err != nil {
-		return "", "", err
+	pairs := make([]*configFilePair, 0, len(components))
+	for _, component := range components {
+		oldConfigPath := filepath.Join(path, fmt.Sprintf("%s-%s.yml", tc.Version, component))
+		if err := fetchConfigFile(ctx, src, tc.Version, component, oldConfigPath); err != nil {
+			return nil, err
+		}
+
+		targetConfigPath := filepath.Join(path, fmt.Sprintf("%s-%s.yml", targetVersion, component))
+		if err := fetchConfigFile(ctx, src, targetVersion, component, targetConfigPath); err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, &configFilePair{
+			Component: component,
+			Old:       oldConfigPath,
+			Target:    targetConfigPath,
+		})
 	}
 
-	targetRawTiKVConfigURL := fmt.Sprintf(tikvRawConfigURL, targetVersion)
-	targetTiKVConfigPath := filepath.Join(path, fmt.Sprintf("%s-tikv.yml", targetVersion))
-	if err := utils.DownloadFile(targetRawTiKVConfigURL, targetTiKVConfigPath); err != nil {
-		return "", "", err
+	return pairs, nil
+}
+
+// fetchConfigFile copies the default config file of component in version to
+// dist, the file is downloaded to ~/.tim/cache/<version>/ first if it is not
+// cached yet or src.NoCache is set.
+func fetchConfigFile(ctx context.Context, src *configSource, version, component, dist string) error {
+	c, ok := getComponent(component)
+	if !ok {
+		return fmt.Errorf("component %s is invalid, support %s", component, supportedComponents())
+	}
+	fileName := c.ConfigFileName
+	url := c.configURL(src.RepoURL, version)
+	opts := &utils.DownloadOptions{ValidateYAML: true}
+	if src.Progress != nil {
+		opts.Progress = utils.NewProgressBar(src.Progress, fmt.Sprintf("%s %s", version, fileName))
+	}
+
+	// only the versions in vX.Y.Z format are cached
+	if _, err := utils.ParseVersion(version); err != nil {
+		return utils.DownloadFileWithOptions(ctx, url, dist, opts)
+	}
+
+	home, err := timHomeDir()
+	if err != nil {
+		return err
+	}
+
+	cacheDir := filepath.Join(home, "cache", version)
+	if src.RepoURL != DefaultAnsibleRepoURL {
+		// keep the files of mirrors and forks apart from the upstream ones
+		sum := sha1.Sum([]byte(src.RepoURL))
+		cacheDir = filepath.Join(home, "cache", hex.EncodeToString(sum[:4]), version)
+	}
+
+	cacheFile := filepath.Join(cacheDir, fileName)
+	if src.NoCache || !utils.FileExists(cacheFile) {
+		if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+			return err
+		}
+		if err := utils.DownloadFileWithOptions(ctx, url, cacheFile, opts); err != nil {
+			return err
+		}
 	}
 
-	return oldTiKVConfigPath, targetTiKVConfigPath, nil
+	return utils.CopyFile(cacheFile, dist)
 }
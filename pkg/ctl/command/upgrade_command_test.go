@@ -0,0 +1,256 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/client/local"
+	"github.com/tidbops/tim/pkg/models"
+)
+
+const (
+	testInventory = `## TiDB Cluster Part
+[tidb_servers]
+172.16.10.1
+
+[tikv_servers]
+172.16.10.4
+172.16.10.5
+
+[pd_servers]
+172.16.10.9
+
+[all:vars]
+deploy_dir = /home/tidb/deploy
+tidb_version = v3.0.4
+`
+	// the origin tikv config is tuned by the operator, the comments and the
+	// layout are kept by an upgrade with it
+	testTiKVConfig = `---
+# tuned for the ssd of the tikv servers
+global:
+
+storage:
+  # shared by all the column families
+  block-cache:
+    capacity: "8GB"   # half of the memory
+
+raftstore:
+  sync-log: true
+`
+)
+
+// upgradeTest is a tidb cluster of v3.0.4 in a temporary directory to
+// upgrade to v3.0.5, the tidb-ansible files of v3.0.5 are cloned from a local
+// git repo and the default configs are served by an httptest.Server.
+type upgradeTest struct {
+	tc  *models.TiDBCluster
+	cli *local.Client
+	cmd *cobra.Command
+	out *bytes.Buffer
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=tim", "-c", "user.email=tim@localhost"}, args...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %s failed, %v, %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// newUpgradeTest prepares an upgradeTest, the returned func restores the
+// globals it changes.
+func newUpgradeTest(t *testing.T, answers ...string) (*upgradeTest, func()) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	root, err := ioutil.TempDir("", "tim-upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"HOME": filepath.Join(root, "home"), "TIM_NOTIFY_URL": ""}
+	saved := make(map[string]string, len(env))
+	for k, v := range env {
+		saved[k] = os.Getenv(k)
+		os.Setenv(k, v)
+	}
+
+	ansible := filepath.Join(root, "tidb-ansible")
+	writeTestFiles(t, ansible, map[string]string{
+		"local_prepare.yml":            "---\n",
+		"excessive_rolling_update.yml": "---\n",
+		"inventory.ini":                strings.Replace(testInventory, "v3.0.4", "v3.0.5", 1),
+		"hosts.ini":                    "[servers]\n",
+		"conf/tikv.yml":                "---\nglobal:\n",
+		"conf/pd.yml":                  "---\nglobal:\n",
+		"conf/tidb.yml":                "---\nglobal:\n",
+	})
+	runGit(t, ansible, "init", "-q")
+	runGit(t, ansible, "add", ".")
+	runGit(t, ansible, "commit", "-q", "-m", "tidb-ansible v3.0.5")
+	runGit(t, ansible, "tag", "v3.0.5")
+
+	path := filepath.Join(root, "tidb")
+	writeTestFiles(t, path, map[string]string{
+		"inventory.ini": testInventory,
+		"hosts.ini":     "[servers]\n172.16.10.1\n",
+		"conf/tikv.yml": testTiKVConfig,
+		"conf/pd.yml":   "---\nglobal:\n",
+		"conf/tidb.yml": "---\nglobal:\n",
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("---\nglobal:\n"))
+	}))
+
+	cli, err := local.NewLocalClientWithConfig(models.SqliteEngineConfig(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &models.TiDBCluster{
+		Name:    "tidb",
+		Version: "v3.0.4",
+		Path:    path,
+		Host:    strings.ToLower(getHostName()),
+		Status:  models.TiDBRunning,
+	}
+	if err := cli.CreateTiDBCluster(context.Background(), tc); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &cobra.Command{Use: "upgrade"}
+	cmd.Flags().String("ansible-repo-url", server.URL, "")
+	out := &bytes.Buffer{}
+	cmd.SetOutput(out)
+
+	savedFlags, savedComponents := *upgradeCmdFlags, upgradeComponents
+	*upgradeCmdFlags = UpgradeCommandFlags{
+		TargetVersion: "v3.0.5",
+		DiffFormat:    "text",
+		AnsibleGitURL: ansible,
+		WorkDir:       filepath.Join(root, "work"),
+	}
+	upgradeComponents = configComponents
+	savedPrompter := SetPrompter(NewScriptedPrompter(answers...))
+
+	return &upgradeTest{tc: tc, cli: cli, cmd: cmd, out: out}, func() {
+		SetPrompter(savedPrompter)
+		*upgradeCmdFlags, upgradeComponents = savedFlags, savedComponents
+		models.CloseEngine()
+		server.Close()
+		for k, v := range saved {
+			os.Setenv(k, v)
+		}
+		os.RemoveAll(root)
+	}
+}
+
+// upgrade runs the upgrade of the tidb cluster and returns it from the store.
+func (u *upgradeTest) upgrade(t *testing.T) *models.TiDBCluster {
+	t.Helper()
+	ctx := context.Background()
+	if err := upgradeTiDBCluster(ctx, u.cmd, u.cli, u.tc, false); err != nil {
+		t.Fatalf("upgrade failed, %v, output:\n%s", err, u.out)
+	}
+	tc, err := u.cli.GetTiDBClusterByName(ctx, u.tc.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tc
+}
+
+func TestUpgradeUseOrigin(t *testing.T) {
+	u, cleanup := newUpgradeTest(t, UseOrigin)
+	defer cleanup()
+
+	tc := u.upgrade(t)
+	if tc.Version != "v3.0.5" || tc.Status != models.TiDBWaitingUpgrade {
+		t.Errorf("%s %s, want v3.0.5 %s", tc.Version, tc.Status, models.TiDBWaitingUpgrade)
+	}
+	if tc.ConfigMode != "origin" || tc.ConfigFile != "" {
+		t.Errorf("config mode %q file %q, want origin without a file", tc.ConfigMode, tc.ConfigFile)
+	}
+	if answers := prompter.(*ScriptedPrompter).Answers; len(answers) != 0 {
+		t.Errorf("answers %v not used", answers)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(tc.Path, "conf", "tikv.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != testTiKVConfig {
+		t.Errorf("conf/tikv.yml is changed by the upgrade with the origin config:\n%s", got)
+	}
+	// the default conf of the target version is kept aside
+	if _, err := os.Stat(filepath.Join(tc.Path, "confbak", "tikv.yml")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpgradeOutputFormatted(t *testing.T) {
+	u, cleanup := newUpgradeTest(t, UseOrigin)
+	defer cleanup()
+
+	tc := u.upgrade(t)
+	out := u.out.String()
+	want := "Success! Init v3.0.5 tidb-ansible files saved to " + tc.Path + "\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("output has no %q:\n%s", want, out)
+	}
+	if strings.Contains(out, "%") {
+		t.Errorf("output has unformatted verbs:\n%s", out)
+	}
+}
+
+func TestUpgradeNoArgs(t *testing.T) {
+	// the flags of the command are bound to the globals
+	savedFlags := *upgradeCmdFlags
+	defer func() { *upgradeCmdFlags = savedFlags }()
+
+	for _, args := range [][]string{{}, {"--target-version", "v3.0.5"}} {
+		cmd := NewUpgradeCommand()
+		out := &bytes.Buffer{}
+		cmd.SetOutput(out)
+		cmd.SetArgs(args)
+
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("upgrade %v panics, %v", args, r)
+				}
+			}()
+			err = cmd.Execute()
+		}()
+		if err == nil || !strings.Contains(err.Error(), "requires at least 1 arg(s), received 0") {
+			t.Errorf("upgrade %v: %v, want the error of no args", args, err)
+		}
+		if !strings.Contains(out.String(), "Usage:\n  upgrade") {
+			t.Errorf("upgrade %v prints no usage:\n%s", args, out)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/schema"
+)
+
+type ValidateCommandFlags struct {
+	Component string
+	Schema    string
+}
+
+var (
+	validateCmdFlags = &ValidateCommandFlags{}
+)
+
+func NewValidateCommand() *cobra.Command {
+	validateCmd := &cobra.Command{
+		Use:   "validate <name>",
+		Short: "check the types of a tidb cluster config against the schema of its version",
+		Args:  exactArgs(1),
+		RunE:  validateCommandFunc,
+	}
+
+	validateCmd.Flags().StringVar(&validateCmdFlags.Component, "component", "tikv",
+		"the component config to validate, support "+supportedComponents())
+	validateCmd.Flags().StringVar(&validateCmdFlags.Schema, "schema", "",
+		"the schema file in yaml or json instead of the builtin schema of the cluster version")
+
+	return validateCmd
+}
+
+func validateCommandFunc(cmd *cobra.Command, args []string) error {
+	fileName, ok := configFilePaths[validateCmdFlags.Component]
+	if !ok {
+		return fmt.Errorf("component %s is invalid, support %s", validateCmdFlags.Component, supportedComponents())
+	}
+
+	name := args[0]
+	cli, err := genClient(cmd)
+	if err != nil {
+		return fmt.Errorf("init client failed, %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	tc, err := cli.GetTiDBClusterByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s tidb cluster not exist", name)
+	}
+
+	var s *schema.Schema
+	if validateCmdFlags.Schema != "" {
+		s, err = schema.LoadFile(validateCmdFlags.Schema)
+	} else {
+		s, err = schema.Builtin(validateCmdFlags.Component, tc.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	configFile := filepath.Join(tc.Path, "conf", fileName)
+	issues, err := schema.ValidateFile(s, configFile)
+	if err != nil {
+		return err
+	}
+
+	errs := 0
+	for _, issue := range issues {
+		if issue.Level == schema.LevelError {
+			errs++
+		}
+		cmd.Println(issue.String())
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%s has %d invalid values", configFile, errs)
+	}
+
+	cmd.Printf("%s is valid, %d warnings\n", configFile, len(issues))
+	return nil
+}
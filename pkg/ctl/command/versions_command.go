@@ -0,0 +1,108 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+type VersionsCommandFlags struct {
+	GitURL string
+	After  string
+}
+
+var (
+	versionsCmdFlags = &VersionsCommandFlags{}
+)
+
+func NewVersionsCommand() *cobra.Command {
+	versionsCmd := &cobra.Command{
+		Use:   "versions",
+		Short: "list the tidb versions released by the tidb-ansible repo",
+		Args:  exactArgs(0),
+		RunE:  versionsCommandFunc,
+	}
+
+	versionsCmd.Flags().StringVar(&versionsCmdFlags.GitURL, "ansible-git-url", TiDBAnsibleURL,
+		"the git repo to list the tidb-ansible tags of")
+	versionsCmd.Flags().StringVar(&versionsCmdFlags.After, "after", "",
+		"only list the versions newer than the version, or the current version of the tidb cluster of the name")
+
+	return versionsCmd
+}
+
+func versionsCommandFunc(cmd *cobra.Command, args []string) error {
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	var after *utils.Version
+	if versionsCmdFlags.After != "" {
+		version := versionsCmdFlags.After
+		if _, err := utils.ParseVersion(version); err != nil {
+			cli, err := genClient(cmd)
+			if err != nil {
+				return fmt.Errorf("init client failed, %v", err)
+			}
+			defer cli.Close()
+			tc, err := cli.GetTiDBClusterByName(ctx, version)
+			if err != nil {
+				return fmt.Errorf("after %s is neither a version in vX.Y.Z format nor a tidb cluster", version)
+			}
+			version = tc.Version
+		}
+
+		v, err := utils.ParseVersion(version)
+		if err != nil {
+			return err
+		}
+		after = v
+	}
+
+	versions, err := listAnsibleVersions(ctx, versionsCmdFlags.GitURL)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		if after != nil && v.Compare(after) <= 0 {
+			break
+		}
+		cmd.Println(v.String())
+	}
+
+	return nil
+}
+
+// listAnsibleVersions returns the release versions of the tags of the git
+// repo in descending order, the tags not in vX.Y.Z format are skipped.
+func listAnsibleVersions(ctx context.Context, gitURL string) ([]*utils.Version, error) {
+	out, err := exec.CommandContext(ctx, "git", "ls-remote", "--tags", "--refs", gitURL).Output()
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("list the tags of %s failed, %s", gitURL, strings.TrimSpace(string(e.Stderr)))
+		}
+		return nil, fmt.Errorf("list the tags of %s failed, %v", gitURL, err)
+	}
+
+	// a line is <sha>\trefs/tags/<tag>
+	var versions []*utils.Version
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := utils.ParseVersion(strings.TrimPrefix(fields[1], "refs/tags/"))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Compare(versions[j]) > 0 })
+	return versions, nil
+}
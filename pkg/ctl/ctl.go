@@ -6,6 +6,7 @@ import (
 	"reflect"
 
 	"github.com/spf13/cobra"
+	"github.com/tidbops/tim/pkg/config"
 	"github.com/tidbops/tim/pkg/ctl/command"
 )
 
@@ -18,31 +19,72 @@ func init() {
 	yaml.DefaultMapType = reflect.TypeOf(yaml.MapSlice{})
 }
 
-func Start(args []string) {
+// Interrupt aborts the running commands, it returns false if none is left to
+// abort.
+func Interrupt() bool {
+	return command.Interrupt()
+}
+
+// Start runs the tim command line with args, the error returned by a
+// command has been printed to stderr already.
+func Start(args []string) error {
 	rootCmd := &cobra.Command{
 		Use:        "tim",
 		Short:      "TiM is a tool for managing multiple tidb clusters",
 		Long:       "A tool to manage multi tidb-ansible and help to upgrade tidb version",
 		SuggestFor: []string{"tim-ctl"},
+		// the global flags shared by the commands
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// the flags of the commands, e.g. --work-dir of upgrade
+			if err := config.ApplyDefaults(cmd.Flags()); err != nil {
+				return err
+			}
+			return command.ApplyConfigPaths(cmd)
+		},
 	}
 
 	rootCmd.Flags().StringVarP(&url, "server", "u", "", "tim-server address")
 
 	rootCmd.AddCommand(
 		command.NewInitCommand(),
+		command.NewCreateCommand(),
+		command.NewImportCommand(),
+		command.NewExportCommand(),
 		command.NewUpgradeCommand(),
 		command.NewListCommand(),
 		command.NewSearchCommand(),
 		command.NewEnvCommand(),
+		command.NewRollbackCommand(),
+		command.NewHistoryCommand(),
+		command.NewStatusCommand(),
+		command.NewDiffCommand(),
+		command.NewValidateCommand(),
+		command.NewGenRulesCommand(),
+		command.NewBackupCommand(),
+		command.NewRestoreCommand(),
+		command.NewScaleCommand(),
+		command.NewVersionsCommand(),
+		command.NewLabelCommand(),
+		command.NewPlaybookCommand(),
+		command.NewLintCommand(),
+		command.NewPruneCommand(),
+		command.NewDoctorCommand(),
+		command.NewConfigCommand(),
+		command.NewCheckRuleCommand(),
+		command.NewReconcileCommand(),
 	)
 
 	rootCmd.SetArgs(args)
 	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
 	rootCmd.ParseFlags(args)
 	rootCmd.SetOut(os.Stdout)
 	rootCmd.SetErr(os.Stderr)
 
 	if err := rootCmd.Execute(); err != nil {
-		rootCmd.Println(err)
+		rootCmd.PrintErrln("Error:", err)
+		return err
 	}
+
+	return nil
 }
@@ -0,0 +1,150 @@
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+// Editor adds and removes the hosts of an inventory file line by line, the
+// other lines, e.g. the comments and the variables, are kept as they are.
+type Editor struct {
+	path  string
+	lines []string
+}
+
+// NewEditor reads the inventory file of path to edit.
+func NewEditor(path string) (*Editor, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Editor{
+		path:  path,
+		lines: strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"),
+	}
+	if _, err := e.Inventory(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Inventory parses the edited inventory.
+func (e *Editor) Inventory() (*Inventory, error) {
+	return parse(strings.NewReader(e.String()), e.path)
+}
+
+// String returns the edited inventory file content.
+func (e *Editor) String() string {
+	return strings.Join(e.lines, "\n") + "\n"
+}
+
+// Save writes the edited inventory back to its file atomically, the file is
+// either the old one or the edited one if the write is interrupted.
+func (e *Editor) Save() error {
+	return utils.WriteToFile(e.String(), e.path)
+}
+
+// HasHost returns whether a host of group has the name or address addr.
+func (e *Editor) HasHost(group string, addr string) bool {
+	start, end := e.groupLines(group)
+	if start < 0 {
+		return false
+	}
+	for i := start + 1; i < end; i++ {
+		if e.isHost(i, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddHost adds addr after the last host of group, a host of the same name or
+// address in group is an error.
+func (e *Editor) AddHost(group string, addr string) error {
+	if addr == "" || strings.ContainsAny(addr, " \t[]") {
+		return fmt.Errorf("invalid host %q", addr)
+	}
+
+	start, end := e.groupLines(group)
+	if start < 0 {
+		return fmt.Errorf("group %s not found in %s", group, e.path)
+	}
+	if e.HasHost(group, addr) {
+		return fmt.Errorf("%s is already in group %s", addr, group)
+	}
+
+	at := start + 1
+	for i := start + 1; i < end; i++ {
+		if isHostLine(e.lines[i]) {
+			at = i + 1
+		}
+	}
+
+	lines := make([]string, 0, len(e.lines)+1)
+	lines = append(lines, e.lines[:at]...)
+	lines = append(lines, addr)
+	e.lines = append(lines, e.lines[at:]...)
+	return nil
+}
+
+// RemoveHost removes the hosts of group with the name or address addr, all
+// the instances on the address are removed.
+func (e *Editor) RemoveHost(group string, addr string) error {
+	start, end := e.groupLines(group)
+	if start < 0 {
+		return fmt.Errorf("group %s not found in %s", group, e.path)
+	}
+
+	removed := 0
+	lines := make([]string, 0, len(e.lines))
+	lines = append(lines, e.lines[:start+1]...)
+	for i := start + 1; i < end; i++ {
+		if e.isHost(i, addr) {
+			removed++
+			continue
+		}
+		lines = append(lines, e.lines[i])
+	}
+	if removed == 0 {
+		return fmt.Errorf("%s not found in group %s", addr, group)
+	}
+	e.lines = append(lines, e.lines[end:]...)
+	return nil
+}
+
+// groupLines returns the line of the [group] header and the line the next
+// section starts or the number of lines, start is -1 if group is not found.
+func (e *Editor) groupLines(group string) (start int, end int) {
+	start = -1
+	for i, line := range e.lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if strings.TrimSpace(strings.Trim(line, "[]")) == group {
+			start = i
+		}
+	}
+	return start, len(e.lines)
+}
+
+func (e *Editor) isHost(i int, addr string) bool {
+	if !isHostLine(e.lines[i]) {
+		return false
+	}
+	host, err := parseHost(strings.TrimSpace(e.lines[i]))
+	return err == nil && (host.Name == addr || host.Address() == addr)
+}
+
+func isHostLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, ";")
+}
@@ -0,0 +1,270 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	TiDBServers = "tidb_servers"
+	PDServers   = "pd_servers"
+	TiKVServers = "tikv_servers"
+	// MonitoredServers are the hosts of node_exporter and blackbox_exporter
+	MonitoredServers = "monitored_servers"
+)
+
+// RequiredGroups are the groups a tidb-ansible inventory.ini must have.
+var RequiredGroups = []string{TiDBServers, PDServers, TiKVServers}
+
+// Host is a host line of a group, e.g.
+//
+//	TiKV1 ansible_host=172.16.10.4 deploy_dir=/data1/deploy
+type Host struct {
+	Name string
+	Vars map[string]string
+}
+
+// Address returns the ansible_host of the host, or the name if it is not set.
+func (h *Host) Address() string {
+	if addr, ok := h.Vars["ansible_host"]; ok && addr != "" {
+		return addr
+	}
+	return h.Name
+}
+
+// Inventory is a parsed ansible inventory file.
+type Inventory struct {
+	// Groups are the hosts of every group in order
+	Groups map[string][]*Host
+	// Children are the child groups of a [group:children] section
+	Children map[string][]string
+	// Vars are the variables of a [group:vars] section
+	Vars map[string]map[string]string
+}
+
+// ParseFile parses the ansible inventory file in ini format.
+func ParseFile(path string) (*Inventory, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parse(file, path)
+}
+
+// parse parses the inventory read from r, name is the file name in errors.
+func parse(r io.Reader, path string) (*Inventory, error) {
+	inv := &Inventory{
+		Groups:   make(map[string][]*Host),
+		Children: make(map[string][]string),
+		Vars:     make(map[string]map[string]string),
+	}
+
+	var (
+		group   = "ungrouped"
+		section = ""
+		lineNum = 0
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s:%d: invalid group %s", path, lineNum, line)
+			}
+
+			group = strings.TrimSpace(line[1 : len(line)-1])
+			section = ""
+			if i := strings.Index(group, ":"); i >= 0 {
+				group, section = group[:i], group[i+1:]
+			}
+			if group == "" {
+				return nil, fmt.Errorf("%s:%d: invalid group %s", path, lineNum, line)
+			}
+
+			switch section {
+			case "":
+				if _, ok := inv.Groups[group]; !ok {
+					inv.Groups[group] = make([]*Host, 0)
+				}
+			case "children":
+			case "vars":
+				if _, ok := inv.Vars[group]; !ok {
+					inv.Vars[group] = make(map[string]string)
+				}
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown section %s", path, lineNum, line)
+			}
+			continue
+		}
+
+		switch section {
+		case "children":
+			inv.Children[group] = append(inv.Children[group], line)
+		case "vars":
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("%s:%d: invalid variable %s", path, lineNum, line)
+			}
+			inv.Vars[group][strings.TrimSpace(kv[0])] = unquote(strings.TrimSpace(kv[1]))
+		default:
+			host, err := parseHost(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+			}
+			inv.Groups[group] = append(inv.Groups[group], host)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// Validate checks the required groups exist and have hosts.
+func (inv *Inventory) Validate() error {
+	var missing []string
+	for _, group := range RequiredGroups {
+		if len(inv.Groups[group]) == 0 {
+			missing = append(missing, group)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("group %s not found or has no hosts", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// HostCounts returns the number of hosts in the required groups.
+func (inv *Inventory) HostCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, group := range RequiredGroups {
+		counts[group] = len(inv.Groups[group])
+	}
+	return counts
+}
+
+// Addresses returns the addresses of the hosts in group.
+func (inv *Inventory) Addresses(group string) []string {
+	addrs := make([]string, 0, len(inv.Groups[group]))
+	for _, h := range inv.Groups[group] {
+		addrs = append(addrs, h.Address())
+	}
+	return addrs
+}
+
+// RoleAddresses returns the addresses of the hosts of every role in
+// RequiredGroups.
+func (inv *Inventory) RoleAddresses() map[string][]string {
+	roles := make(map[string][]string)
+	for _, group := range RequiredGroups {
+		roles[group] = inv.Addresses(group)
+	}
+	return roles
+}
+
+// AllAddresses returns the distinct addresses of the hosts in RequiredGroups
+// in order.
+func (inv *Inventory) AllAddresses() []string {
+	var (
+		addrs []string
+		seen  = make(map[string]bool)
+	)
+	for _, group := range RequiredGroups {
+		for _, addr := range inv.Addresses(group) {
+			if !seen[addr] {
+				seen[addr] = true
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
+
+// Var returns the variable of the [all:vars] section, it is empty if the
+// variable is not set.
+func (inv *Inventory) Var(name string) string {
+	return inv.Vars["all"][name]
+}
+
+func parseHost(line string) (*Host, error) {
+	fields, err := splitFields(line)
+	if err != nil {
+		return nil, err
+	}
+
+	host := &Host{
+		Name: fields[0],
+		Vars: make(map[string]string),
+	}
+
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid host variable %s", f)
+		}
+		host.Vars[kv[0]] = unquote(kv[1])
+	}
+
+	return host, nil
+}
+
+// splitFields splits line by spaces out of quotes.
+func splitFields(line string) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+		quote  rune
+	)
+
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			field.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			field.WriteRune(c)
+		case c == ' ' || c == '\t':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(c)
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote in %s", line)
+	}
+
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+
+	return fields, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
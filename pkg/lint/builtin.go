@@ -0,0 +1,47 @@
+package lint
+
+// builtinList is the deprecated options of the tidb-ansible config files,
+// only the common ones superseded by another option or ignored are listed.
+const builtinList = `
+tikv:
+  v2.1.0:
+    - key: server.end-point-concurrency
+      replacement: readpool.coprocessor.normal-concurrency
+      message: "the coprocessor requests are handled by the readpool"
+    - key: raftstore.region-split-size
+      replacement: coprocessor.region-split-size
+    - key: raftstore.region-max-size
+      replacement: coprocessor.region-max-size
+  v4.0.0:
+    - key: raftstore.sync-log
+      message: "the raft log is always synced, it is ignored"
+    - key: rocksdb.defaultcf.block-cache-size
+      replacement: storage.block-cache.capacity
+      message: "the column families share the block cache"
+    - key: rocksdb.writecf.block-cache-size
+      replacement: storage.block-cache.capacity
+      message: "the column families share the block cache"
+    - key: rocksdb.lockcf.block-cache-size
+      replacement: storage.block-cache.capacity
+      message: "the column families share the block cache"
+    - key: raftdb.defaultcf.block-cache-size
+      replacement: storage.block-cache.capacity
+      message: "the column families share the block cache"
+pd:
+  v4.0.0:
+    - key: schedule.disable-remove-down-replica
+      replacement: schedule.enable-remove-down-replica
+    - key: schedule.disable-replace-offline-replica
+      replacement: schedule.enable-replace-offline-replica
+    - key: schedule.disable-make-up-replica
+      replacement: schedule.enable-make-up-replica
+    - key: schedule.disable-remove-extra-replica
+      replacement: schedule.enable-remove-extra-replica
+    - key: schedule.disable-location-replacement
+      replacement: schedule.enable-location-replacement
+`
+
+// Builtin returns the builtin deprecation list.
+func Builtin() (List, error) {
+	return Parse([]byte(builtinList))
+}
@@ -0,0 +1,158 @@
+package lint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/tidbops/tim/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// List is the deprecated options of the component configs, keyed by the
+// component and the version they are deprecated since, e.g.
+//
+//	tikv:
+//	  v4.0.0:
+//	    - key: raftstore.sync-log
+//	      message: ...
+type List map[string]map[string][]*Deprecation
+
+// Deprecation is an option which still works but is deprecated, it may be
+// removed by a future release.
+type Deprecation struct {
+	// Key is the dotted path of the option, e.g. raftstore.region-split-size
+	Key string `yaml:"key"`
+	// Replacement is the dotted path of the option superseding it, empty if
+	// there is none
+	Replacement string `yaml:"replacement"`
+	// Message tells more about it
+	Message string `yaml:"message"`
+}
+
+// Issue is a deprecated option set in a config.
+type Issue struct {
+	Path        string
+	Since       string
+	Replacement string
+	Message     string
+}
+
+func (i *Issue) String() string {
+	msg := fmt.Sprintf("warning: %s: deprecated since %s", i.Path, i.Since)
+	if i.Replacement != "" {
+		msg += ", use " + i.Replacement + " instead"
+	}
+	if i.Message != "" {
+		msg += ", " + i.Message
+	}
+	return msg
+}
+
+// Parse parses a deprecation list in yaml or json.
+func Parse(data []byte) (List, error) {
+	l := List{}
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+
+	for component, versions := range l {
+		for version, ds := range versions {
+			if _, err := utils.ParseVersion(version); err != nil {
+				return nil, fmt.Errorf("the version %s of %s is invalid, %v", version, component, err)
+			}
+			for i, d := range ds {
+				if d == nil || d.Key == "" {
+					return nil, fmt.Errorf("the key of deprecation %d of %s %s is empty", i, component, version)
+				}
+			}
+		}
+	}
+
+	return l, nil
+}
+
+// LoadFile loads a deprecation list file in yaml or json.
+func LoadFile(file string) (List, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse deprecation list %s failed, %v", file, err)
+	}
+	return l, nil
+}
+
+// CheckFile returns the options of the yaml config file of the component
+// deprecated in version or before, an option with a null value is not set. A
+// version not in vX.Y.Z format has all of them deprecated. The file is not
+// changed.
+func (l List) CheckFile(component, version, file string) ([]*Issue, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse %s failed, %v", file, err)
+	}
+
+	return l.Check(component, version, config), nil
+}
+
+// Check is like CheckFile with the config parsed.
+func (l List) Check(component, version string, config map[string]interface{}) []*Issue {
+	v, _ := utils.ParseVersion(version)
+
+	var since []string
+	for s := range l[component] {
+		sv, err := utils.ParseVersion(s)
+		if err != nil {
+			continue
+		}
+		if v == nil || sv.Compare(v) <= 0 {
+			since = append(since, s)
+		}
+	}
+	sort.Slice(since, func(i, j int) bool {
+		a, _ := utils.ParseVersion(since[i])
+		b, _ := utils.ParseVersion(since[j])
+		return a.Compare(b) < 0
+	})
+
+	issues := make([]*Issue, 0)
+	for _, s := range since {
+		for _, d := range l[component][s] {
+			if lookup(config, d.Key) == nil {
+				continue
+			}
+			issues = append(issues, &Issue{
+				Path:        d.Key,
+				Since:       s,
+				Replacement: d.Replacement,
+				Message:     d.Message,
+			})
+		}
+	}
+
+	return issues
+}
+
+// lookup returns the value of the dotted path key in config, it is nil if the
+// option is not set.
+func lookup(config map[string]interface{}, key string) interface{} {
+	var value interface{} = config
+	for _, k := range strings.Split(key, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[k]
+	}
+	return value
+}
@@ -0,0 +1,110 @@
+package logutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ngaut/log"
+)
+
+// Log formats supported by InitLogger.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var levels = []string{"debug", "info", "warn", "warning", "error", "fatal"}
+
+// InitLogger sets the level and the format of the logs, the logs are written
+// to stderr, the json format writes a json object per line.
+func InitLogger(level, format string) error {
+	if !isLevel(level) {
+		return fmt.Errorf("log level %s is invalid, support %s", level, strings.Join(levels, " / "))
+	}
+	log.SetLevelByString(level)
+
+	switch format {
+	case FormatText, "":
+		// keep the color codes out of the files and pipes
+		log.SetHighlighting(isTerminal(os.Stderr))
+	case FormatJSON:
+		log.SetHighlighting(false)
+		log.SetFlags(log.Lshortfile)
+		log.SetOutput(&jsonWriter{out: os.Stderr})
+	default:
+		return fmt.Errorf("log format %s is invalid, support %s / %s", format, FormatText, FormatJSON)
+	}
+
+	return nil
+}
+
+func isLevel(level string) bool {
+	for _, l := range levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// jsonEntry is a log line in json format.
+type jsonEntry struct {
+	Time   string `json:"time"`
+	Level  string `json:"level"`
+	Caller string `json:"caller,omitempty"`
+	Msg    string `json:"msg"`
+}
+
+// jsonWriter converts the log lines in "file:line: [level] msg" format to
+// json.
+type jsonWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	entry := parseLine(string(bytes.TrimRight(p, "\n")))
+	entry.Time = time.Now().Format(time.RFC3339Nano)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.out.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func parseLine(line string) *jsonEntry {
+	entry := &jsonEntry{Level: "info"}
+
+	if i := strings.Index(line, ": ["); i >= 0 {
+		entry.Caller = line[:i]
+		line = line[i+2:]
+	}
+
+	if strings.HasPrefix(line, "[") {
+		if i := strings.Index(line, "]"); i > 0 {
+			entry.Level = line[1:i]
+			line = line[i+1:]
+		}
+	}
+
+	entry.Msg = strings.TrimSpace(line)
+	return entry
+}
@@ -0,0 +1,358 @@
+// Package metrics keeps the counters and histograms of the tim operations and
+// exposes them in the prometheus text format, by an http /metrics endpoint or
+// by pushing them to a prometheus pushgateway.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are the default histogram buckets in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// Collector is a metric family written in the prometheus text format.
+type Collector interface {
+	Name() string
+	Write(w io.Writer) error
+}
+
+// Registry is a set of collectors.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// DefaultRegistry is the registry of the metrics created by NewCounterVec and
+// NewHistogramVec.
+var DefaultRegistry = NewRegistry()
+
+// Register adds c to the registry, a name registered twice panics as it is an
+// error of the metric definitions.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.Name()]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", c.Name()))
+	}
+	r.collectors[c.Name()] = c
+}
+
+// WriteText writes the metrics ordered by name in the prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := make([]Collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].Name() < collectors[j].Name() })
+	for _, c := range collectors {
+		if err := c.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns the http handler of the /metrics endpoint.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		var buf bytes.Buffer
+		if err := r.WriteText(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(buf.Bytes())
+	})
+}
+
+// Serve serves the metrics of the default registry on /metrics of addr in
+// the background, the error of listening is returned by the channel.
+func Serve(addr string) <-chan error {
+	errCh := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", DefaultRegistry.Handler())
+	go func() {
+		errCh <- http.ListenAndServe(addr, mux)
+	}()
+	return errCh
+}
+
+// pushTimeout is the time limit of pushing the metrics to a pushgateway.
+const pushTimeout = 10 * time.Second
+
+// Push replaces the metrics of job and instance in the pushgateway of url with
+// the ones of the registry.
+func (r *Registry) Push(url string, job string, instance string) error {
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+
+	target := fmt.Sprintf("%s/metrics/job/%s/instance/%s",
+		strings.TrimSuffix(url, "/"), neturl.PathEscape(job), neturl.PathEscape(instance))
+	req, err := http.NewRequest(http.MethodPut, target, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("push to %s failed, %s, %s", target, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// metricVec is the labeled series of a metric family.
+type metricVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string][]string
+}
+
+func newMetricVec(name, help string, labelNames []string) metricVec {
+	return metricVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string][]string),
+	}
+}
+
+func (v *metricVec) Name() string {
+	return v.name
+}
+
+// key returns the key of the series of labelValues, the number of the values
+// must be the number of the label names.
+func (v *metricVec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", v.name, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	if _, ok := v.series[key]; !ok {
+		v.series[key] = append([]string(nil), labelValues...)
+	}
+	return key
+}
+
+// sortedKeys returns the keys of the series in order.
+func (v *metricVec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *metricVec) writeHeader(w io.Writer, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, typ)
+	return err
+}
+
+// labels formats the labels of the series key with the extra name value
+// pairs, e.g. {result="success",le="0.5"}.
+func (v *metricVec) labels(key string, extra ...string) string {
+	var pairs []string
+	for i, value := range v.series[key] {
+		pairs = append(pairs, v.labelNames[i]+`="`+escapeLabel(value)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	metricVec
+	values map[string]float64
+}
+
+// NewCounterVec creates a counter registered to DefaultRegistry.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		metricVec: newMetricVec(name, help, labelNames),
+		values:    make(map[string]float64),
+	}
+	// a counter without labels is exposed as 0 before it is increased
+	if len(labelNames) == 0 {
+		c.values[c.key(nil)] = 0
+	}
+	DefaultRegistry.Register(c)
+	return c
+}
+
+// Inc adds 1 to the counter of labelValues.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta to the counter of labelValues, a negative delta panics as a
+// counter only goes up.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s can not decrease", c.name))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[c.key(labelValues)] += delta
+}
+
+// Value returns the counter of labelValues.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+func (c *CounterVec) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+	for _, key := range c.sortedKeys() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(key), formatFloat(c.values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	metricVec
+	buckets []float64
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a histogram of the upper bounds buckets registered
+// to DefaultRegistry, DefBuckets are used if buckets is empty.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		metricVec: newMetricVec(name, help, labelNames),
+		buckets:   buckets,
+		values:    make(map[string]*histogram),
+	}
+	DefaultRegistry.Register(h)
+	return h
+}
+
+// Observe adds v to the histogram of labelValues.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := h.key(labelValues)
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveSince adds the seconds since start to the histogram of labelValues.
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) Write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	for _, key := range h.sortedKeys() {
+		s := h.values[key]
+		for i, bound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", formatFloat(bound)), s.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", "+Inf"), s.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n",
+			h.name, h.labels(key), formatFloat(s.sum), h.name, h.labels(key), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
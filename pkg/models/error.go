@@ -0,0 +1,20 @@
+package models
+
+import (
+	"fmt"
+)
+
+// ErrTiDBClusterNotExist represents a "TiDBClusterNotExist" kind of error.
+type ErrTiDBClusterNotExist struct {
+	Name string
+}
+
+// IsErrTiDBClusterNotExist checks if an error is a ErrTiDBClusterNotExist.
+func IsErrTiDBClusterNotExist(err error) bool {
+	_, ok := err.(ErrTiDBClusterNotExist)
+	return ok
+}
+
+func (err ErrTiDBClusterNotExist) Error() string {
+	return fmt.Sprintf("tidb cluster %s not exist", err.Name)
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"path/filepath"
+	"sync"
 
 	"xorm.io/core"
 	"xorm.io/xorm"
@@ -36,34 +38,118 @@ var (
 	tables []interface{}
 	// HasEngine specifies if we have a xorm.Engine
 	// HasEngine bool
+
+	engineMu     sync.Mutex
+	engineInited bool
+	engineErr    error
 )
 
+// DefaultDataFile is the sqlite database file in the data dir.
+const DefaultDataFile = "tim.db"
+
+// sqliteParams are the params of the sqlite database file, tim commands
+// running at the same time share it. WAL lets reads go on during a write, a
+// write waits up to _busy_timeout ms for the lock instead of failing with
+// database is locked, and transactions take the write lock at begin so two of
+// them do not deadlock upgrading their read locks.
+const sqliteParams = "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
+// EngineConfig is the database the models are stored in.
+type EngineConfig struct {
+	// Driver is the database/sql driver name, only sqlite3 is built in
+	Driver string
+	// DataSource is the data source name of the driver, e.g. the sqlite
+	// database file, "file::memory:?cache=shared" for an in-memory one
+	DataSource string
+}
+
+// SqliteEngineConfig returns the config of the sqlite database file in dir.
+func SqliteEngineConfig(dir string) EngineConfig {
+	return EngineConfig{
+		Driver:     "sqlite3",
+		DataSource: filepath.Join(dir, DefaultDataFile) + sqliteParams,
+	}
+}
+
+// DefaultEngineConfig returns the config of tim.db in the current directory.
+func DefaultEngineConfig() EngineConfig {
+	return SqliteEngineConfig(".")
+}
+
+// syncRetries is the times to sync the database struct
+const syncRetries = 3
+
 func init() {
 	tables = append(tables,
 		new(TiDBCluster))
 }
 
-func getEngine() (*xorm.Engine, error) {
-	return xorm.NewEngine("sqlite3", "./tim.db")
+func getEngine(cfg EngineConfig) (*xorm.Engine, error) {
+	return xorm.NewEngine(cfg.Driver, cfg.DataSource)
+}
+
+// SetEngine sets the xorm.Engine with the default config
+func SetEngine() error {
+	return setEngine(DefaultEngineConfig())
 }
 
-// SetEngine sets the xorm.Engine
-func SetEngine() (err error) {
-	x, err = getEngine()
+func setEngine(cfg EngineConfig) (err error) {
+	x, err = getEngine(cfg)
 	if err != nil {
 		return fmt.Errorf("Failed to connect to database: %v", err)
 	}
 
 	x.ShowExecTime(true)
 	x.SetMapper(core.GonicMapper{})
-	x.SetMaxOpenConns(32)
-	x.SetMaxIdleConns(8)
+	if cfg.Driver == "sqlite3" {
+		// sqlite allows only one writer, the writes of goroutines are
+		// serialized by the single connection
+		x.SetMaxOpenConns(1)
+		x.SetMaxIdleConns(1)
+	}
 	return nil
 }
 
-// NewEngine initializes a new xorm.Engine
-func NewEngine() (err error) {
-	if err = SetEngine(); err != nil {
+// NewEngine initializes the xorm.Engine with the default config.
+func NewEngine() error {
+	return NewEngineWithConfig(DefaultEngineConfig())
+}
+
+// NewEngineWithConfig initializes the xorm.Engine once, it is safe to call it
+// many times and from goroutines, the later calls are ignored and return the
+// error of the first one until CloseEngine. The model functions are safe for
+// concurrent use after it.
+func NewEngineWithConfig(cfg EngineConfig) error {
+	engineMu.Lock()
+	defer engineMu.Unlock()
+
+	if !engineInited {
+		engineErr = newEngine(cfg)
+		engineInited = true
+	}
+	return engineErr
+}
+
+// CloseEngine closes the xorm.Engine and the database handles of it, a later
+// NewEngineWithConfig initializes a new one. It is a no-op if the engine is
+// not initialized.
+func CloseEngine() error {
+	engineMu.Lock()
+	defer engineMu.Unlock()
+
+	engineInited = false
+	engineErr = nil
+	if x == nil {
+		return nil
+	}
+
+	err := x.Close()
+	x = nil
+	return err
+}
+
+func newEngine(cfg EngineConfig) (err error) {
+	if err = setEngine(cfg); err != nil {
 		return err
 	}
 
@@ -71,9 +157,13 @@ func NewEngine() (err error) {
 	// 	return err
 	// }
 
-	if err = x.StoreEngine("InnoDB").Sync2(tables...); err != nil {
-		return fmt.Errorf("sync database struct error: %v", err)
+	// another tim process may be creating the same tables and indexes, sync
+	// again to see them
+	for i := 0; i < syncRetries; i++ {
+		if err = x.StoreEngine("InnoDB").Sync2(tables...); err == nil {
+			return nil
+		}
 	}
 
-	return nil
+	return fmt.Errorf("sync database struct error: %v", err)
 }
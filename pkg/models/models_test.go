@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tim-models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the engine is initialized once by the goroutines racing to do it
+	cfg := SqliteEngineConfig(dir)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := NewEngineWithConfig(cfg); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	defer CloseEngine()
+
+	const (
+		workers = 8
+		rounds  = 20
+	)
+	ctx := context.Background()
+	errCh := make(chan error, workers*rounds)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			tc := &TiDBCluster{
+				Name:    fmt.Sprintf("tc-%d", w),
+				Version: "v3.0.0",
+				Path:    fmt.Sprintf("/data/tc-%d", w),
+				Status:  string(TiDBInited),
+			}
+			if err := CreateTiDBCluster(ctx, tc); err != nil {
+				errCh <- err
+				return
+			}
+			for r := 0; r < rounds; r++ {
+				tc.Version = fmt.Sprintf("v3.0.%d", r+1)
+				if err := UpdateTiDBCluster(ctx, tc); err != nil {
+					errCh <- err
+					return
+				}
+				if _, err := LoadTiDBClusters(ctx); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Error(err)
+	}
+
+	tcs, err := LoadTiDBClusters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tcs) != workers {
+		t.Fatalf("%d tidb clusters, want %d", len(tcs), workers)
+	}
+	want := fmt.Sprintf("v3.0.%d", rounds)
+	for _, tc := range tcs {
+		if tc.Version != want {
+			t.Errorf("version of %s = %s, want %s", tc.Name, tc.Version, want)
+		}
+	}
+}
+
+func TestUpdateClearsConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tim-models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := NewEngineWithConfig(SqliteEngineConfig(dir)); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseEngine()
+
+	ctx := context.Background()
+	tc := &TiDBCluster{
+		Name:         "tidb",
+		Version:      "v3.0.4",
+		Path:         "/data/tidb",
+		Status:       string(TiDBInited),
+		ConfigMode:   "rule",
+		ConfigFile:   "/rules.yml",
+		ConfigHashes: map[string]string{"tikv": "abc"},
+		Labels:       map[string]string{"env": "test"},
+	}
+	if err := CreateTiDBCluster(ctx, tc); err != nil {
+		t.Fatal(err)
+	}
+
+	// an upgrade with the origin configs has no rule file or hashes
+	tc.Version = "v3.0.5"
+	tc.ConfigMode = ""
+	tc.ConfigFile = ""
+	tc.ConfigHashes = nil
+	tc.Labels = nil
+	if err := UpdateTiDBCluster(ctx, tc); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetTiDBClusterByName(ctx, tc.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "v3.0.5" {
+		t.Errorf("version %s, want v3.0.5", got.Version)
+	}
+	if got.ConfigMode != "" || got.ConfigFile != "" || len(got.ConfigHashes) != 0 || len(got.Labels) != 0 {
+		t.Errorf("mode %q file %q hashes %v labels %v, want them cleared",
+			got.ConfigMode, got.ConfigFile, got.ConfigHashes, got.Labels)
+	}
+	if got.Path != tc.Path || got.Status != tc.Status {
+		t.Errorf("path %s status %s, want %s %s", got.Path, got.Status, tc.Path, tc.Status)
+	}
+}
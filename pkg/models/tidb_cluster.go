@@ -1,10 +1,13 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/tidbops/tim/pkg/utils"
 )
 
 type TiDBStatus string
@@ -15,8 +18,68 @@ const (
 	TiDBStoped                    = "Stoped"
 	TiDBUpgrading                 = "Upgrading"
 	TiDBWaitingUpgrade            = "WaitingUpgrade"
+	// TiDBUpgradeBackedUp means the tidb-ansible directory has been moved
+	// to the backup directory by upgrade.
+	TiDBUpgradeBackedUp = "UpgradeBackedUp"
+	// TiDBAnsibleReinited means the tidb-ansible files of the target version
+	// have been initialized by upgrade.
+	TiDBAnsibleReinited = "AnsibleReinited"
+	// TiDBUpgraded means the rolling update to the target version is done.
+	TiDBUpgraded = "Upgraded"
 )
 
+// tidbStatusTransitions lists the statuses a tidb cluster can change to,
+// every upgrade step can go back to running by rollback.
+var tidbStatusTransitions = map[TiDBStatus][]TiDBStatus{
+	TiDBInited:          {TiDBRunning, TiDBStoped, TiDBUpgradeBackedUp},
+	TiDBRunning:         {TiDBStoped, TiDBUpgradeBackedUp},
+	TiDBStoped:          {TiDBRunning, TiDBUpgradeBackedUp},
+	TiDBUpgradeBackedUp: {TiDBAnsibleReinited, TiDBRunning},
+	TiDBAnsibleReinited: {TiDBWaitingUpgrade, TiDBRunning},
+	TiDBWaitingUpgrade:  {TiDBUpgrading, TiDBRunning},
+	TiDBUpgrading:       {TiDBUpgraded, TiDBWaitingUpgrade, TiDBRunning},
+	TiDBUpgraded:        {TiDBRunning, TiDBStoped, TiDBUpgradeBackedUp},
+}
+
+// CheckTiDBStatusTransition returns an error if a tidb cluster is not allowed
+// to change from status from to status to.
+func CheckTiDBStatusTransition(from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	for _, s := range tidbStatusTransitions[TiDBStatus(from)] {
+		if s == TiDBStatus(to) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("tidb cluster status can not change from %s to %s", from, to)
+}
+
+// CheckTiDBStatus returns an error if status is not one of the TiDBStatus
+// constants.
+func CheckTiDBStatus(status string) error {
+	if _, ok := tidbStatusTransitions[TiDBStatus(status)]; !ok {
+		return fmt.Errorf("unknown tidb cluster status %s", status)
+	}
+	return nil
+}
+
+// TiDBStatuses returns the TiDBStatus constants in the order of an upgrade.
+func TiDBStatuses() []string {
+	return []string{
+		string(TiDBInited),
+		TiDBRunning,
+		TiDBStoped,
+		TiDBUpgradeBackedUp,
+		TiDBAnsibleReinited,
+		TiDBWaitingUpgrade,
+		TiDBUpgrading,
+		TiDBUpgraded,
+	}
+}
+
 func JudgeTiDBStatusType(this string) (TiDBStatus, error) {
 	switch this {
 	case "Inited":
@@ -29,26 +92,48 @@ func JudgeTiDBStatusType(this string) (TiDBStatus, error) {
 		return TiDBUpgrading, nil
 	case "WaitingUpgrade":
 		return TiDBWaitingUpgrade, nil
+	case "UpgradeBackedUp":
+		return TiDBUpgradeBackedUp, nil
+	case "AnsibleReinited":
+		return TiDBAnsibleReinited, nil
+	case "Upgraded":
+		return TiDBUpgraded, nil
 	default:
 		return "", fmt.Errorf("Unknow TiDBStatus")
 	}
 }
 
 type TiDBCluster struct {
-	ID          int64     `json:"id" xorm:"pk autoincr"`
-	Name        string    `json:"name" xorm:"VARCHAR(200) UNIQUE NOT NULL"`
-	Version     string    `json:"version" xorm:"VARCHAR(200)"`
-	Path        string    `json:"path" xorm:"VARCHAR(200)"`
-	Host        string    `json:"host" xorm:"VARCHAR(200)"`
+	ID      int64  `json:"id" xorm:"pk autoincr"`
+	Name    string `json:"name" xorm:"VARCHAR(200) UNIQUE NOT NULL"`
+	Version string `json:"version" xorm:"VARCHAR(200)"`
+	Path    string `json:"path" xorm:"VARCHAR(200)"`
+	Host    string `json:"host" xorm:"VARCHAR(200)"`
+	// Hosts are the addresses of the servers in inventory.ini
+	Hosts       []string  `json:"hosts" xorm:"TEXT JSON"`
 	Status      string    `json:"status" xorm:"VARCHAR(200)"`
 	Description string    `json:"description" xorm:"VARCHAR(512)"`
 	InitTime    time.Time `json:"init_time" xorm:"init_time"`
+	// ConfigMode, ConfigFile and ConfigHashes record how the configs were
+	// generated by the last upgrade, ConfigFile is the rule file or the
+	// target config file used, ConfigHashes are the sha256 checksums of the
+	// applied config files by component
+	ConfigMode   string            `json:"config_mode,omitempty" xorm:"VARCHAR(200)"`
+	ConfigFile   string            `json:"config_file,omitempty" xorm:"VARCHAR(512)"`
+	ConfigHashes map[string]string `json:"config_hashes,omitempty" xorm:"TEXT JSON"`
+	// Labels group the tidb clusters, e.g. by environment, team or region
+	Labels map[string]string `json:"labels,omitempty" xorm:"TEXT JSON"`
+	// SSHAddress is the [user@]host[:port] of the remote host the tidb-ansible
+	// files in Path are read from over ssh, empty if they are on Host, SSHKey
+	// is the identity file to login with
+	SSHAddress string `json:"ssh_address,omitempty" xorm:"VARCHAR(200)"`
+	SSHKey     string `json:"ssh_key,omitempty" xorm:"VARCHAR(512)"`
 }
 
-func CreateTiDBCluster(tc *TiDBCluster) error {
+func CreateTiDBCluster(ctx context.Context, tc *TiDBCluster) error {
 	sess := x.NewSession()
 	defer sess.Close()
-	if err := sess.Begin(); err != nil {
+	if err := sess.Context(ctx).Begin(); err != nil {
 		return err
 	}
 
@@ -79,12 +164,55 @@ func CreateTiDBCluster(tc *TiDBCluster) error {
 	return sess.Commit()
 }
 
-func GetTiDBCluster(tc *TiDBCluster) (bool, error) {
-	return x.Get(tc)
+// UpsertTiDBCluster creates tc, or replaces the tidb cluster of the same name
+// if it exists. The replaced one keeps its id, init time and labels, the other
+// fields are the ones of tc, so the configs recorded by the last upgrade are
+// reset with the registration.
+func UpsertTiDBCluster(ctx context.Context, tc *TiDBCluster) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Context(ctx).Begin(); err != nil {
+		return err
+	}
+
+	old, err := getTiDBClusterByName(sess, tc.Name)
+	if IsErrTiDBClusterNotExist(err) {
+		sess.Rollback()
+		return CreateTiDBCluster(ctx, tc)
+	}
+	if err != nil {
+		return err
+	}
+
+	tc.ID = old.ID
+	tc.InitTime = old.InitTime
+	tc.Labels = old.Labels
+	tc.Host = strings.ToLower(tc.Host)
+	tc.Path = strings.ToLower(tc.Path)
+	isExist, err := sess.
+		Where("host=? and path=? and id!=?", tc.Host, tc.Path, tc.ID).
+		Get(new(TiDBCluster))
+	if err != nil {
+		return err
+	}
+	if isExist {
+		return fmt.Errorf("%s:%s tidb cluster already exists", tc.Host, tc.Path)
+	}
+
+	// the zero values replace the old ones too
+	if _, err := sess.ID(tc.ID).AllCols().Update(tc); err != nil {
+		return err
+	}
+
+	return sess.Commit()
+}
+
+func GetTiDBCluster(ctx context.Context, tc *TiDBCluster) (bool, error) {
+	return x.Context(ctx).Get(tc)
 }
 
-func GetTiDBClusterByName(name string) (*TiDBCluster, error) {
-	return getTiDBClusterByName(x, name)
+func GetTiDBClusterByName(ctx context.Context, name string) (*TiDBCluster, error) {
+	return getTiDBClusterByName(x.Context(ctx), name)
 }
 
 func getTiDBClusterByName(e Engine, name string) (*TiDBCluster, error) {
@@ -99,14 +227,14 @@ func getTiDBClusterByName(e Engine, name string) (*TiDBCluster, error) {
 	}
 
 	if !has {
-		return nil, fmt.Errorf("tidb cluster %s not exist", name)
+		return nil, ErrTiDBClusterNotExist{Name: name}
 	}
 
 	return tc, nil
 }
 
-func LoadTiDBClusters() ([]*TiDBCluster, error) {
-	return loadTiDBClusters(x)
+func LoadTiDBClusters(ctx context.Context) ([]*TiDBCluster, error) {
+	return loadTiDBClusters(x.Context(ctx))
 }
 
 func loadTiDBClusters(e Engine) ([]*TiDBCluster, error) {
@@ -121,15 +249,106 @@ func loadTiDBClusters(e Engine) ([]*TiDBCluster, error) {
 	return tcs, nil
 }
 
-func GetTiDBClusterByHost(host string) ([]*TiDBCluster, error) {
-	return getTiDBClusterByHost(x, host)
+// LoadTiDBClustersPaged returns the tidb clusters ordered by name from offset,
+// at most limit of them, and the number of all the tidb clusters. A limit <= 0
+// returns all the ones from offset.
+func LoadTiDBClustersPaged(ctx context.Context, offset, limit int) ([]*TiDBCluster, int, error) {
+	return loadTiDBClustersPaged(x.Context(ctx), offset, limit)
+}
+
+func loadTiDBClustersPaged(e Engine, offset, limit int) ([]*TiDBCluster, int, error) {
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("offset %d is negative", offset)
+	}
+
+	total, err := e.Count(new(TiDBCluster))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tcs := make([]*TiDBCluster, 0, 10)
+	sess := e.Where("1=1").OrderBy("name")
+	if limit > 0 {
+		sess = sess.Limit(limit, offset)
+	} else if offset > 0 {
+		// sqlite requires a limit for an offset, -1 is no limit
+		sess = sess.Limit(-1, offset)
+	}
+	if err := sess.Find(&tcs); err != nil {
+		return nil, 0, err
+	}
+
+	return tcs, int(total), nil
+}
+
+// GetTiDBClusterByHost returns the tidb clusters managed on host or having
+// servers on host.
+func GetTiDBClusterByHost(ctx context.Context, host string) ([]*TiDBCluster, error) {
+	return getTiDBClusterByHost(x.Context(ctx), host)
 }
 
 func getTiDBClusterByHost(e Engine, host string) ([]*TiDBCluster, error) {
 	tcs := make([]*TiDBCluster, 0, 10)
 
-	if err := x.
-		Where("host=?", host).
+	if err := e.
+		Where("host=? or hosts like ?", host, fmt.Sprintf("%%%q%%", host)).
+		OrderBy("init_time").
+		Find(&tcs); err != nil {
+		return nil, err
+	}
+
+	return tcs, nil
+}
+
+// GetTiDBClustersByVersion returns the tidb clusters whose version satisfies
+// the version constraint, e.g. v3.0.4 or <v4.0.0. The clusters with a version
+// not in vX.Y.Z format only match the constraints of != .
+func GetTiDBClustersByVersion(ctx context.Context, version string) ([]*TiDBCluster, error) {
+	return getTiDBClustersByVersion(x.Context(ctx), version)
+}
+
+func getTiDBClustersByVersion(e Engine, version string) ([]*TiDBCluster, error) {
+	c, err := utils.ParseVersionConstraint(version)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := loadTiDBClusters(e)
+	if err != nil {
+		return nil, err
+	}
+
+	tcs := make([]*TiDBCluster, 0, len(all))
+	for _, tc := range all {
+		v, err := utils.ParseVersion(tc.Version)
+		if err != nil {
+			if c.Op == "!=" {
+				tcs = append(tcs, tc)
+			}
+			continue
+		}
+		if c.Match(v) {
+			tcs = append(tcs, tc)
+		}
+	}
+
+	return tcs, nil
+}
+
+// GetTiDBClustersByStatus returns the tidb clusters in status, status must be
+// one of the TiDBStatus constants.
+func GetTiDBClustersByStatus(ctx context.Context, status string) ([]*TiDBCluster, error) {
+	return getTiDBClustersByStatus(x.Context(ctx), status)
+}
+
+func getTiDBClustersByStatus(e Engine, status string) ([]*TiDBCluster, error) {
+	if err := CheckTiDBStatus(status); err != nil {
+		return nil, err
+	}
+
+	tcs := make([]*TiDBCluster, 0, 10)
+	if err := e.
+		Where("status=?", status).
 		OrderBy("init_time").
 		Find(&tcs); err != nil {
 		return nil, err
@@ -147,16 +366,35 @@ func isTiDBClusterExist(e Engine, uid int64, name string) (bool, error) {
 		Get(&TiDBCluster{Name: strings.ToLower(name)})
 }
 
-func UpdateTiDBCluster(tc *TiDBCluster) error {
-	return updateUser(x, tc)
+func UpdateTiDBCluster(ctx context.Context, tc *TiDBCluster) error {
+	return updateUser(x.Context(ctx), tc)
 }
 
 func updateUser(e Engine, tc *TiDBCluster) error {
-	_, err := e.ID(tc.ID).Update(tc)
+	// the zero values are not updated, the labels and the configs of the last
+	// upgrade are always, so the last label can be removed and an upgrade
+	// without rules clears the rule file of the previous one
+	_, err := e.ID(tc.ID).MustCols("labels", "config_mode", "config_file", "config_hashes").Update(tc)
+	return err
+}
+
+func DeleteTiDBCluster(ctx context.Context, name string) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	return deleteTiDBCluster(sess.Context(ctx), name)
+}
+
+func deleteTiDBCluster(e Engine, name string) error {
+	tc, err := getTiDBClusterByName(e, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.ID(tc.ID).Delete(new(TiDBCluster))
 	return err
 }
 
-func SearchTiDBClusters(s map[string]interface{}) ([]*TiDBCluster, error) {
+func SearchTiDBClusters(ctx context.Context, s map[string]interface{}) ([]*TiDBCluster, error) {
 	tcs := make([]*TiDBCluster, 0, 10)
 	where := map[string]interface{}{}
 	for k, v := range s {
@@ -164,7 +402,7 @@ func SearchTiDBClusters(s map[string]interface{}) ([]*TiDBCluster, error) {
 			where[k] = v
 		}
 	}
-	if err := x.
+	if err := x.Context(ctx).
 		Where(where).
 		OrderBy("init_time").
 		Find(&tcs); err != nil {
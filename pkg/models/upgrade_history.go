@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// The operations recorded in the upgrade history.
+const (
+	OperationUpgrade  = "upgrade"
+	OperationRollback = "rollback"
+)
+
+// The results of an upgrade operation.
+const (
+	// UpgradeGenerated means the target version tidb-ansible files are
+	// generated, but the rolling update playbooks are not run.
+	UpgradeGenerated = "Generated"
+	// UpgradeSucceeded means the rolling update to the target version is done.
+	UpgradeSucceeded = "Succeeded"
+	UpgradeFailed    = "Failed"
+)
+
+// UpgradeHistory is an entry of the audit trail of the operations changing
+// the version of a tidb cluster, it is appended when an operation ends.
+type UpgradeHistory struct {
+	ID            int64  `json:"id" xorm:"pk autoincr"`
+	Name          string `json:"name" xorm:"VARCHAR(200) INDEX NOT NULL"`
+	Operation     string `json:"operation" xorm:"VARCHAR(32)"`
+	FromVersion   string `json:"from_version" xorm:"VARCHAR(200)"`
+	TargetVersion string `json:"target_version" xorm:"VARCHAR(200)"`
+	// ConfigMode is how the target config was initialized, origin / new /
+	// rules, ConfigFile is the rule file or the target config of it
+	ConfigMode string `json:"config_mode" xorm:"VARCHAR(32)"`
+	ConfigFile string `json:"config_file" xorm:"VARCHAR(512)"`
+	Result     string `json:"result" xorm:"VARCHAR(32)"`
+	Error      string `json:"error" xorm:"TEXT"`
+	Operator   string `json:"operator" xorm:"VARCHAR(200)"`
+	Host       string `json:"host" xorm:"VARCHAR(200)"`
+	// Artifacts is the directory keeping the work files of the upgrade,
+	// e.g. the origin, merged and target configs
+	Artifacts string    `json:"artifacts,omitempty" xorm:"VARCHAR(512)"`
+	StartTime time.Time `json:"start_time" xorm:"start_time"`
+	EndTime   time.Time `json:"end_time" xorm:"end_time"`
+}
+
+func init() {
+	tables = append(tables,
+		new(UpgradeHistory))
+}
+
+// CreateUpgradeHistory appends h to the upgrade history.
+func CreateUpgradeHistory(ctx context.Context, h *UpgradeHistory) error {
+	return createUpgradeHistory(x.Context(ctx), h)
+}
+
+func createUpgradeHistory(e Engine, h *UpgradeHistory) error {
+	_, err := e.Insert(h)
+	return err
+}
+
+// GetUpgradeHistoryByName returns the upgrade history of the tidb cluster
+// name, the oldest entry first.
+func GetUpgradeHistoryByName(ctx context.Context, name string) ([]*UpgradeHistory, error) {
+	return getUpgradeHistoryByName(x.Context(ctx), name)
+}
+
+func getUpgradeHistoryByName(e Engine, name string) ([]*UpgradeHistory, error) {
+	hs := make([]*UpgradeHistory, 0, 10)
+	if err := e.
+		Where("name=?", name).
+		Asc("start_time", "id").
+		Find(&hs); err != nil {
+		return nil, err
+	}
+
+	return hs, nil
+}
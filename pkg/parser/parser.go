@@ -1,17 +1,65 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/tidbops/tim/pkg/utils"
+	yaml "gopkg.in/mikefarah/yaml.v2"
+	"io"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 )
 
 const (
 	NewConfigStart    = "@new"
 	DeleteConfigStart = "@delete"
+	RenameConfigStart = "@rename"
+	// ComponentsMark marks a rule file whose sections are grouped by the
+	// components, e.g. a "# @components" line
+	ComponentsMark = "@components"
 )
 
+// RuleFiles are the rule files generated for a component.
+type RuleFiles struct {
+	NewRuleFile    string
+	DeleteRuleFile string
+	// RenameRuleFile maps the old paths to the new paths, e.g.
+	//
+	//	rename:
+	//	  rocksdb.max-background-jobs: rocksdb.max-background-compactions
+	RenameRuleFile string
+}
+
+// NewRules are the configs of the @new section, they are merged into the
+// config in the order of the rule file.
+type NewRules struct {
+	Config yaml.MapSlice
+	// Source is the @new section of a plain rule file, WriteFiles writes it
+	// instead of Config to keep the comments and the style of the rules
+	Source string
+}
+
+// DeleteRules are the paths of the @delete section deleted from the config.
+type DeleteRules struct {
+	Delete []string `yaml:"delete"`
+}
+
+// RenameRules of the @rename section map the old paths to the new paths in
+// order.
+type RenameRules struct {
+	Rename yaml.MapSlice `yaml:"rename"`
+}
+
+// Rules are the rules of a component parsed from a rule file.
+type Rules struct {
+	New    *NewRules
+	Delete *DeleteRules
+	Rename *RenameRules
+}
+
 type Parser struct {
 }
 
@@ -19,60 +67,502 @@ func NewParser() *Parser {
 	return &Parser{}
 }
 
+// ParserFile writes the sections of a plain rule file to the rule files of
+// prefix in path and returns the new rule file and the delete rule file, use
+// ParseFileToRuleFiles for the rename rule file too.
 func (p *Parser) ParserFile(
 	srcPath string,
 	path string,
 	prefix string,
 ) (string, string, error) {
-	data, err := ioutil.ReadFile(srcPath)
+	rf, err := p.ParseFileToRuleFiles(srcPath, path, prefix)
 	if err != nil {
 		return "", "", err
 	}
 
-	lines := strings.Split(string(data), "\n")
+	return rf.NewRuleFile, rf.DeleteRuleFile, nil
+}
+
+// ParseFileToRuleFiles writes the sections of a plain rule file to the rule
+// files of prefix in path, the lines of the sections are kept, e.g. the
+// comments. The rules of a json rule file are written in yaml.
+func (p *Parser) ParseFileToRuleFiles(
+	srcPath string,
+	path string,
+	prefix string,
+) (*RuleFiles, error) {
+	data, err := ioutil.ReadFile(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if isJSON(srcPath, data) {
+		r, err := p.Parse(srcPath)
+		if err != nil {
+			return nil, err
+		}
+		return r.WriteFiles(path, prefix)
+	}
+
+	sections := splitSections(string(data))
+
+	rf := newRuleFiles(path, prefix)
+	if err := utils.WriteLines(sections[NewConfigStart], rf.NewRuleFile); err != nil {
+		return nil, err
+	}
+
+	if err := utils.WriteLines(sections[DeleteConfigStart], rf.DeleteRuleFile); err != nil {
+		return nil, err
+	}
+
+	if err := utils.WriteLines(sections[RenameConfigStart], rf.RenameRuleFile); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+// IsMultiComponent returns whether the rule file is grouped by components, that
+// is it has the "# @components" line, or the "components": true key of a json
+// one. The groups of such a rule file must be components, e.g.
+//
+//	# @components
+//
+//	# @new
+//	---
+//	tikv:
+//	  pessimistic_txn:
+//	pd:
+//	  replication:
+//
+//	# @delete
+//	---
+//	delete:
+//	  tikv:
+//	    - "storage"
+//
+//	# @rename
+//	---
+//	rename:
+//	  tikv:
+//	    rocksdb.max-background-jobs: rocksdb.max-background-compactions
+func (p *Parser) IsMultiComponent(srcPath string, components []string) (bool, error) {
+	rules, _, err := readSections(srcPath)
+	if err != nil {
+		return false, err
+	}
+
+	if !rules.multi {
+		return false, nil
+	}
+	if err := checkComponentGroups(rules, components); err != nil {
+		return false, fmt.Errorf("%s is grouped by components, %v", srcPath, err)
+	}
+	return true, nil
+}
+
+// Parse parses a plain rule file, the rules are the ones of a component.
+func (p *Parser) Parse(srcPath string) (*Rules, error) {
+	rules, sections, err := readSections(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := rules.deleteRules.(yaml.MapSlice); ok && !rules.multi {
+		return nil, fmt.Errorf("invalid delete rules, delete should be a list of paths, " +
+			"add a # @components line to group the rules by components")
+	}
+	r, err := newRules(rules.newRules, rules.deleteRules, rules.renameRules)
+	if err != nil {
+		return nil, err
+	}
+	r.New.Source = strings.Join(sections[NewConfigStart], "\n")
+	return r, nil
+}
+
+// ParseMulti parses a rule file grouped by components, it returns the rules
+// of every component found in it.
+func (p *Parser) ParseMulti(srcPath string, components []string) (map[string]*Rules, error) {
+	rules, _, err := readSections(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rules.multi {
+		return nil, fmt.Errorf("%s is not grouped by components, it has no # %s line", srcPath, ComponentsMark)
+	}
+	if err := checkComponentGroups(rules, components); err != nil {
+		return nil, fmt.Errorf("%s is grouped by components, %v", srcPath, err)
+	}
 
+	deleteGroups, _ := rules.deleteRules.(yaml.MapSlice)
+
+	all := make(map[string]*Rules)
+	for _, component := range components {
+		newRule, hasNew := lookup(rules.newRules, component)
+		deleteRule, hasDelete := lookup(deleteGroups, component)
+		renameRule, hasRename := lookup(rules.renameRules, component)
+		if !hasNew && !hasDelete && !hasRename {
+			continue
+		}
+
+		newMap, ok := newRule.(yaml.MapSlice)
+		if newRule != nil && !ok {
+			return nil, fmt.Errorf("invalid new rules of %s, they should be a map", component)
+		}
+		renameMap, ok := renameRule.(yaml.MapSlice)
+		if renameRule != nil && !ok {
+			return nil, fmt.Errorf("invalid rename rules of %s, rename should be a map of paths", component)
+		}
+
+		r, err := newRules(newMap, deleteRule, renameMap)
+		if err != nil {
+			return nil, fmt.Errorf("%v of %s", err, component)
+		}
+		all[component] = r
+	}
+
+	return all, nil
+}
+
+// ParserMultiFile parses a rule file grouped by components and generates the
+// rule files of every component found in it.
+func (p *Parser) ParserMultiFile(
+	srcPath string,
+	path string,
+	components []string,
+) (map[string]*RuleFiles, error) {
+	all, err := p.ParseMulti(srcPath, components)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*RuleFiles, len(all))
+	for component, r := range all {
+		rf, err := r.WriteFiles(path, component)
+		if err != nil {
+			return nil, err
+		}
+		files[component] = rf
+	}
+
+	return files, nil
+}
+
+// WriteFiles writes the rules to the rule files of prefix in path, e.g. for
+// the merge of the new rules, a new rule without a value is null.
+func (r *Rules) WriteFiles(path string, prefix string) (*RuleFiles, error) {
+	newData := []byte("---\n")
+	if len(r.New.Config) > 0 {
+		data, err := yaml.Marshal(r.New.Config)
+		if err != nil {
+			return nil, err
+		}
+		newData = append(newData, data...)
+	}
+	if r.New.Source != "" {
+		newData = []byte(r.New.Source + "\n")
+	}
+
+	deleteData, err := yaml.Marshal(r.Delete)
+	if err != nil {
+		return nil, err
+	}
+
+	renameData, err := yaml.Marshal(r.Rename)
+	if err != nil {
+		return nil, err
+	}
+
+	rf := newRuleFiles(path, prefix)
+	if err := utils.WriteToFile(string(newData), rf.NewRuleFile); err != nil {
+		return nil, err
+	}
+	if err := utils.WriteToFile("---\n"+string(deleteData), rf.DeleteRuleFile); err != nil {
+		return nil, err
+	}
+	if err := utils.WriteToFile("---\n"+string(renameData), rf.RenameRuleFile); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+// newRules returns the rules of the unmarshaled sections, the delete rules
+// should be a list of paths.
+func newRules(newRules yaml.MapSlice, deleteRules interface{}, renameRules yaml.MapSlice) (*Rules, error) {
+	r := &Rules{
+		New:    &NewRules{Config: newRules},
+		Delete: &DeleteRules{},
+		Rename: &RenameRules{Rename: renameRules},
+	}
+
+	if deleteRules == nil {
+		return r, nil
+	}
+	paths, ok := deleteRules.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid delete rules, delete should be a list of paths")
+	}
+	for _, path := range paths {
+		r.Delete.Delete = append(r.Delete.Delete, fmt.Sprintf("%v", path))
+	}
+	return r, nil
+}
+
+func newRuleFiles(path string, prefix string) *RuleFiles {
+	return &RuleFiles{
+		NewRuleFile:    fmt.Sprintf("%s/%s-newrule.yml", path, prefix),
+		DeleteRuleFile: fmt.Sprintf("%s/%s-deleterule.yml", path, prefix),
+		RenameRuleFile: fmt.Sprintf("%s/%s-renamerule.yml", path, prefix),
+	}
+}
+
+// splitSections splits the lines of a rule file by the section start marks.
+func splitSections(data string) map[string][]string {
 	var (
-		newConfigLines    []string
-		deleteConfigLines []string
-		newStart          bool
-		newEnd            bool
-		deleteStart       bool
-		deleteEnd         bool
+		section  string
+		sections = make(map[string][]string)
 	)
 
-	for _, line := range lines {
+	for _, line := range strings.Split(data, "\n") {
 		switch {
+		case strings.Contains(line, ComponentsMark):
+			sections[ComponentsMark] = append(sections[ComponentsMark], line)
+			continue
 		case strings.Contains(line, NewConfigStart):
-			newStart = true
-			if deleteEnd {
-				deleteEnd = false
-			}
+			section = NewConfigStart
 		case strings.Contains(line, DeleteConfigStart):
-			deleteStart = true
-			if newStart {
-				newStart = false
+			section = DeleteConfigStart
+		case strings.Contains(line, RenameConfigStart):
+			section = RenameConfigStart
+		default:
+		}
+
+		if section != "" {
+			sections[section] = append(sections[section], line)
+		}
+	}
+
+	return sections
+}
+
+// sectionRules are the rules unmarshaled from the sections of a rule file,
+// multi is whether they are grouped by components.
+type sectionRules struct {
+	newRules    yaml.MapSlice
+	deleteRules interface{}
+	renameRules yaml.MapSlice
+	multi       bool
+}
+
+// readSections reads the rules of a rule file in yaml or json, the lines of
+// the sections of a yaml one are returned too, they are nil for json.
+func readSections(srcPath string) (*sectionRules, map[string][]string, error) {
+	data, err := ioutil.ReadFile(srcPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if isJSON(srcPath, data) {
+		rules, err := unmarshalJSON(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rules, nil, nil
+	}
+
+	sections := splitSections(string(data))
+	rules, err := unmarshalSections(sections)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rules, sections, nil
+}
+
+// isJSON returns whether a rule file is json by the .json extension, or the
+// content starting with {.
+func isJSON(srcPath string, data []byte) bool {
+	if strings.EqualFold(filepath.Ext(srcPath), ".json") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// unmarshalJSON unmarshals a json rule file, the sections are the keys new,
+// delete and rename of the same schema as the yaml ones, and "components":
+// true groups them by components, e.g.
+//
+//	{
+//	  "new": {"storage": {"block-cache": {"capacity": "4GB"}}},
+//	  "delete": ["raftstore.sync-log"],
+//	  "rename": {"rocksdb.max-background-jobs": "rocksdb.max-background-compactions"}
+//	}
+func unmarshalJSON(data []byte) (*sectionRules, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeJSON(dec)
+	if err == nil {
+		if _, e := dec.Token(); e != io.EOF {
+			err = errors.New("invalid data after the top-level object")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid json rules, %v", err)
+	}
+	doc, ok := v.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("invalid json rules, they should be an object")
+	}
+
+	rules := &sectionRules{}
+	for _, item := range doc {
+		key := fmt.Sprintf("%v", item.Key)
+		switch key {
+		case "new":
+			if item.Value == nil {
+				continue
+			}
+			m, ok := item.Value.(yaml.MapSlice)
+			if !ok {
+				return nil, fmt.Errorf("invalid new rules, new should be a map")
+			}
+			rules.newRules = m
+		case "delete":
+			rules.deleteRules = item.Value
+		case "rename":
+			if item.Value == nil {
+				continue
+			}
+			m, ok := item.Value.(yaml.MapSlice)
+			if !ok {
+				return nil, fmt.Errorf("invalid rename rules, rename should be a map of paths")
 			}
+			rules.renameRules = m
+		case "components":
+			multi, ok := item.Value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid json rules, components should be true or false")
+			}
+			rules.multi = multi
 		default:
+			return nil, fmt.Errorf("invalid json rules, unknown key %s, support new / delete / rename / components", key)
 		}
+	}
+
+	return rules, nil
+}
+
+// decodeJSON decodes the next json value of dec into the values yaml
+// unmarshals, the objects are yaml.MapSlice to keep the order of the keys.
+func decodeJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
 
-		if newStart && !newEnd {
-			newConfigLines = append(newConfigLines, line)
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := yaml.MapSlice{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				m = append(m, yaml.MapItem{Key: key, Value: value})
+			}
+			_, err := dec.Token()
+			return m, err
+		case '[':
+			items := []interface{}{}
+			for dec.More() {
+				item, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			_, err := dec.Token()
+			return items, err
+		}
+		return nil, fmt.Errorf("unexpected %v", t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return int(i), nil
 		}
+		return t.Float64()
+	default:
+		return t, nil
+	}
+}
+
+func unmarshalSections(sections map[string][]string) (*sectionRules, error) {
+	rules := &sectionRules{}
+	if err := yaml.Unmarshal([]byte(strings.Join(sections[NewConfigStart], "\n")), &rules.newRules); err != nil {
+		return nil, fmt.Errorf("invalid new rules, %v", err)
+	}
+
+	deleteRules := yaml.MapSlice{}
+	if err := yaml.Unmarshal([]byte(strings.Join(sections[DeleteConfigStart], "\n")), &deleteRules); err != nil {
+		return nil, fmt.Errorf("invalid delete rules, %v", err)
+	}
+	rules.deleteRules, _ = lookup(deleteRules, "delete")
 
-		if deleteStart && !deleteEnd {
-			deleteConfigLines = append(deleteConfigLines, line)
+	renameRules := yaml.MapSlice{}
+	if err := yaml.Unmarshal([]byte(strings.Join(sections[RenameConfigStart], "\n")), &renameRules); err != nil {
+		return nil, fmt.Errorf("invalid rename rules, %v", err)
+	}
+	if r, ok := lookup(renameRules, "rename"); ok && r != nil {
+		m, ok := r.(yaml.MapSlice)
+		if !ok {
+			return nil, fmt.Errorf("invalid rename rules, rename should be a map of paths")
 		}
+		rules.renameRules = m
 	}
+	rules.multi = len(sections[ComponentsMark]) > 0
 
-	newRuleFile := fmt.Sprintf("%s/%s-newrule.yml", path, prefix)
-	if err := utils.WriteLines(newConfigLines, newRuleFile); err != nil {
-		return "", "", err
+	return rules, nil
+}
+
+// checkComponentGroups checks the groups of the rules grouped by components
+// are components.
+func checkComponentGroups(rules *sectionRules, components []string) error {
+	deleteGroups, ok := rules.deleteRules.(yaml.MapSlice)
+	if rules.deleteRules != nil && !ok {
+		return fmt.Errorf("delete should be a map of components")
 	}
 
-	deleteRuleFile := fmt.Sprintf("%s/%s-deleterule.yml", path, prefix)
-	if err := utils.WriteLines(deleteConfigLines, deleteRuleFile); err != nil {
-		return "", "", err
+	for _, group := range []yaml.MapSlice{rules.newRules, deleteGroups, rules.renameRules} {
+		for _, item := range group {
+			component := fmt.Sprintf("%v", item.Key)
+			if !contains(components, component) {
+				return fmt.Errorf("%s is not a component, support %s", component, strings.Join(components, " / "))
+			}
+		}
+	}
+	return nil
+}
+
+func lookup(m yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range m {
+		if fmt.Sprintf("%v", item.Key) == key {
+			return item.Value, true
+		}
 	}
+	return nil, false
+}
 
-	return newRuleFile, deleteRuleFile, nil
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testComponents = []string{"tikv", "pd", "tidb"}
+
+func writeRuleFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tim-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestIsMultiComponent(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		multi   bool
+		err     bool
+	}{
+		{
+			// the [pd] of tikv.yml, not the pd rules
+			name:    "plain with component keys",
+			file:    "rules.yml",
+			content: "# @new\n---\npd:\n  endpoints:\n",
+		},
+		{
+			name:    "plain",
+			file:    "rules.yml",
+			content: "# @new\n---\nstorage:\n  block-cache:\n\n# @delete\n---\ndelete:\n  - raftstore.sync-log\n",
+		},
+		{
+			name:    "marked",
+			file:    "rules.yml",
+			content: "# @components\n# @new\n---\npd:\n  replication:\n\n# @delete\n---\ndelete:\n  tikv:\n    - storage\n",
+			multi:   true,
+		},
+		{
+			name:    "marked with an unknown group",
+			file:    "rules.yml",
+			content: "# @components\n# @new\n---\nstorage:\n  block-cache:\n",
+			err:     true,
+		},
+		{
+			name:    "marked with a delete list",
+			file:    "rules.yml",
+			content: "# @components\n# @delete\n---\ndelete:\n  - storage\n",
+			err:     true,
+		},
+		{
+			name:    "json plain with component keys",
+			file:    "rules.json",
+			content: `{"new": {"pd": {"endpoints": null}}}`,
+		},
+		{
+			name:    "json marked",
+			file:    "rules.json",
+			content: `{"components": true, "new": {"pd": {"replication": null}}}`,
+			multi:   true,
+		},
+	}
+
+	p := NewParser()
+	for _, c := range cases {
+		file := writeRuleFile(t, c.file, c.content)
+		multi, err := p.IsMultiComponent(file, testComponents)
+		os.RemoveAll(filepath.Dir(file))
+		if (err != nil) != c.err {
+			t.Errorf("%s: err %v, want error %v", c.name, err, c.err)
+			continue
+		}
+		if multi != c.multi {
+			t.Errorf("%s: multi %v, want %v", c.name, multi, c.multi)
+		}
+	}
+}
+
+func TestParseComponentKeysOfPlainFile(t *testing.T) {
+	file := writeRuleFile(t, "rules.yml", "# @new\n---\npd:\n  endpoints:\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p := NewParser()
+	r, err := p.Parse(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.New.Config) != 1 || r.New.Config[0].Key != "pd" {
+		t.Fatalf("new rules %v, want the pd key of tikv.yml", r.New.Config)
+	}
+	if _, err := p.ParseMulti(file, testComponents); err == nil {
+		t.Fatal("ParseMulti of a plain rule file succeeded, want an error")
+	}
+}
+
+func TestParseMulti(t *testing.T) {
+	file := writeRuleFile(t, "rules.yml", `# @components
+
+# @new
+---
+tikv:
+  pessimistic_txn:
+pd:
+  pd-server:
+
+# @delete
+---
+delete:
+  tikv:
+    - "storage"
+
+# @rename
+---
+rename:
+  pd:
+    replication.max-replicas: replication.replicas
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	all, err := NewParser().ParseMulti(file, testComponents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("rules of %d components, want tikv and pd", len(all))
+	}
+	if d := all["tikv"].Delete.Delete; len(d) != 1 || d[0] != "storage" {
+		t.Errorf("tikv delete rules %v, want [storage]", d)
+	}
+	if r := all["pd"].Rename.Rename; len(r) != 1 || r[0].Key != "replication.max-replicas" {
+		t.Errorf("pd rename rules %v, want replication.max-replicas", r)
+	}
+}
@@ -0,0 +1,345 @@
+// Package query compiles the filter expressions of tidb clusters, e.g.
+// `version<v4.0.0 && status=waiting-upgrade`.
+//
+// An expression is conditions of field op value joined by && and ||, && binds
+// tighter and parentheses group them. The fields are name, version, status and
+// path, the operators are =, !=, <, <=, > and >=. A value with spaces or
+// operator characters can be double quoted.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidbops/tim/pkg/models"
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+// Fields are the tidb cluster fields a query can filter by.
+var Fields = []string{"name", "version", "status", "path"}
+
+// Query is a compiled filter expression.
+type Query struct {
+	expr string
+	root node
+}
+
+// Parse compiles the filter expression s.
+func Parse(s string) (*Query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, fmt.Errorf("unexpected %s at %d", t.text, t.pos)
+	}
+
+	return &Query{expr: s, root: root}, nil
+}
+
+// Match returns true if tc satisfies the query.
+func (q *Query) Match(tc *models.TiDBCluster) bool {
+	return q.root.match(tc)
+}
+
+// Filter returns the tidb clusters of tcs satisfying the query in order.
+func (q *Query) Filter(tcs []*models.TiDBCluster) []*models.TiDBCluster {
+	matched := make([]*models.TiDBCluster, 0, len(tcs))
+	for _, tc := range tcs {
+		if q.Match(tc) {
+			matched = append(matched, tc)
+		}
+	}
+	return matched
+}
+
+func (q *Query) String() string {
+	return q.expr
+}
+
+type node interface {
+	match(tc *models.TiDBCluster) bool
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) match(tc *models.TiDBCluster) bool {
+	return n.left.match(tc) && n.right.match(tc)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) match(tc *models.TiDBCluster) bool {
+	return n.left.match(tc) || n.right.match(tc)
+}
+
+// condition is a field op value comparison, the versions are compared by
+// semver and the statuses ignoring case, - and _.
+type condition struct {
+	field string
+	op    string
+	value string
+	// version is the parsed value of a version condition, nil if the value
+	// is not in vX.Y.Z format
+	version *utils.Version
+}
+
+func newCondition(field, op, value string, pos int) (*condition, error) {
+	c := &condition{field: field, op: op, value: value}
+	ordered := op != "=" && op != "!="
+
+	switch field {
+	case "name", "path":
+	case "version":
+		if v, err := utils.ParseVersion(value); err == nil {
+			c.version = v
+		} else if ordered {
+			return nil, fmt.Errorf("version %s at %d is not in vX.Y.Z format, it only supports = and !=", value, pos)
+		}
+	case "status":
+		if ordered {
+			return nil, fmt.Errorf("status at %d only supports = and !=", pos)
+		}
+		status, ok := lookupStatus(value)
+		if !ok {
+			return nil, fmt.Errorf("unknown tidb cluster status %s at %d, support %s",
+				value, pos, strings.Join(models.TiDBStatuses(), " / "))
+		}
+		c.value = status
+	default:
+		return nil, fmt.Errorf("unknown field %s at %d, support %s", field, pos, strings.Join(Fields, " / "))
+	}
+
+	return c, nil
+}
+
+func (c *condition) match(tc *models.TiDBCluster) bool {
+	switch c.field {
+	case "name":
+		return compare(strings.Compare(tc.Name, c.value), c.op)
+	case "path":
+		return compare(strings.Compare(tc.Path, c.value), c.op)
+	case "status":
+		return compare(strings.Compare(tc.Status, c.value), c.op)
+	}
+
+	// like GetTiDBClustersByVersion, a version not in vX.Y.Z format only
+	// matches the conditions of != unless it is the value itself
+	if c.version == nil {
+		return compare(strings.Compare(tc.Version, c.value), c.op)
+	}
+	v, err := utils.ParseVersion(tc.Version)
+	if err != nil {
+		return c.op == "!="
+	}
+	return compare(v.Compare(c.version), c.op)
+}
+
+// compare returns whether the result n of a comparison satisfies op.
+func compare(n int, op string) bool {
+	switch op {
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "!=":
+		return n != 0
+	default:
+		return n == 0
+	}
+}
+
+// lookupStatus returns the TiDBStatus constant of s ignoring case, - and _,
+// e.g. waiting-upgrade is WaitingUpgrade.
+func lookupStatus(s string) (string, bool) {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s))
+	}
+	for _, status := range models.TiDBStatuses() {
+		if normalize(status) == normalize(s) {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+type parser struct {
+	tokens []*token
+	pos    int
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() *token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokenOp && t.text == "||"; t = p.peek() {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokenOp && t.text == "&&"; t = p.peek() {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (node, error) {
+	t := p.next()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	if t.kind == tokenOp && t.text == "(" {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c == nil || c.kind != tokenOp || c.text != ")" {
+			return nil, fmt.Errorf("missing ) of the ( at %d", t.pos)
+		}
+		return n, nil
+	}
+
+	if t.kind != tokenWord {
+		return nil, fmt.Errorf("expected a field at %d, got %s", t.pos, t.text)
+	}
+	op := p.next()
+	if op == nil || op.kind != tokenOp || !isComparison(op.text) {
+		return nil, fmt.Errorf("expected an operator after %s at %d", t.text, t.pos)
+	}
+	value := p.next()
+	if value == nil || value.kind != tokenWord {
+		return nil, fmt.Errorf("expected a value after %s%s at %d", t.text, op.text, op.pos)
+	}
+
+	return newCondition(strings.ToLower(t.text), op.text, value.text, t.pos)
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+const (
+	tokenWord = iota
+	tokenOp
+)
+
+type token struct {
+	kind int
+	text string
+	// pos is the byte offset of the token in the query
+	pos int
+}
+
+// operators are the operator tokens, the longer ones are matched first.
+var operators = []string{"&&", "||", "<=", ">=", "!=", "<", ">", "=", "(", ")"}
+
+func tokenize(s string) ([]*token, error) {
+	var tokens []*token
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == ' ' || s[i] == '\t':
+			i++
+			continue
+		case s[i] == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d, %v", i, err)
+			}
+			tokens = append(tokens, &token{kind: tokenWord, text: text, pos: i})
+			i = end + 1
+			continue
+		}
+
+		if op := operatorAt(s, i); op != "" {
+			tokens = append(tokens, &token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+			continue
+		}
+
+		start := i
+		for i < len(s) && s[i] != ' ' && s[i] != '\t' && s[i] != '"' && operatorAt(s, i) == "" {
+			i++
+		}
+		tokens = append(tokens, &token{kind: tokenWord, text: s[start:i], pos: start})
+	}
+	return tokens, nil
+}
+
+func operatorAt(s string, i int) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s[i:], op) {
+			return op
+		}
+	}
+	// a single & or | is not an operator, report it instead of using it
+	// as a part of a value
+	if s[i] == '&' || s[i] == '|' {
+		return s[i : i+1]
+	}
+	return ""
+}
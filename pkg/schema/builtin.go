@@ -0,0 +1,357 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tidbops/tim/pkg/utils"
+)
+
+// builtinSchemas are the schemas of the tidb-ansible config files, keyed by
+// <component>/<major.minor version>. Only the common options are described,
+// the sections without properties accept any keys.
+var builtinSchemas = map[string]string{
+	"tikv/v2.1": tikvSchema,
+	"tikv/v3.0": tikvSchema + tikvSchemaV30,
+	"pd/v2.1":   pdSchema,
+	"pd/v3.0":   pdSchema + pdSchemaV30,
+	"tidb/v2.1": tidbSchema,
+	"tidb/v3.0": tidbSchema + tidbSchemaV30,
+}
+
+// Builtin returns the builtin schema of the component config in version, the
+// schema of the major and minor version is used for every patch version.
+func Builtin(component, version string) (*Schema, error) {
+	v, err := utils.ParseVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("no builtin %s schema for %s, %v", component, version, err)
+	}
+
+	key := fmt.Sprintf("%s/v%d.%d", component, v.Major, v.Minor)
+	data, ok := builtinSchemas[key]
+	if !ok {
+		return nil, fmt.Errorf("no builtin %s schema for %s, support %v", component, version, BuiltinVersions(component))
+	}
+
+	return Parse([]byte(data))
+}
+
+// BuiltinVersions returns the major and minor versions having a builtin
+// schema of the component.
+func BuiltinVersions(component string) []string {
+	var versions []string
+	prefix := component + "/"
+	for key := range builtinSchemas {
+		if strings.HasPrefix(key, prefix) {
+			versions = append(versions, strings.TrimPrefix(key, prefix))
+		}
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+const tikvSchema = `
+type: object
+properties:
+  global:
+    type: object
+    properties:
+      log-level: {type: string}
+      log-file: {type: string}
+      log-rotation-timespan: {type: string}
+  readpool:
+    type: object
+    properties:
+      storage:
+        type: object
+        properties:
+          high-concurrency: {type: integer}
+          normal-concurrency: {type: integer}
+          low-concurrency: {type: integer}
+          max-tasks-per-worker-high: {type: integer}
+          max-tasks-per-worker-normal: {type: integer}
+          max-tasks-per-worker-low: {type: integer}
+          stack-size: {type: string}
+      coprocessor:
+        type: object
+        properties:
+          high-concurrency: {type: integer}
+          normal-concurrency: {type: integer}
+          low-concurrency: {type: integer}
+          max-tasks-per-worker-high: {type: integer}
+          max-tasks-per-worker-normal: {type: integer}
+          max-tasks-per-worker-low: {type: integer}
+          stack-size: {type: string}
+  server:
+    type: object
+    properties:
+      addr: {type: string}
+      advertise-addr: {type: string}
+      status-addr: {type: string}
+      grpc-compression-type: {type: string}
+      grpc-concurrency: {type: integer}
+      grpc-concurrent-stream: {type: integer}
+      grpc-raft-conn-num: {type: integer}
+      grpc-stream-initial-window-size: {type: string}
+      grpc-keepalive-time: {type: string}
+      grpc-keepalive-timeout: {type: string}
+      concurrent-send-snap-limit: {type: integer}
+      concurrent-recv-snap-limit: {type: integer}
+      end-point-recursion-limit: {type: integer}
+      end-point-request-max-handle-duration: {type: string}
+      snap-max-write-bytes-per-sec: {type: string}
+      labels: {type: object}
+  storage:
+    type: object
+    properties:
+      data-dir: {type: string}
+      max-key-size: {type: integer}
+      scheduler-notify-capacity: {type: integer}
+      scheduler-concurrency: {type: integer}
+      scheduler-worker-pool-size: {type: integer}
+      scheduler-pending-write-threshold: {type: string}
+  pd:
+    type: object
+    properties:
+      endpoints: {type: array, items: {type: string}}
+  metric:
+    type: object
+    properties:
+      interval: {type: string}
+      address: {type: string}
+      job: {type: string}
+  raftstore:
+    type: object
+    properties:
+      raftdb-path: {type: string}
+      sync-log: {type: boolean}
+      prevote: {type: boolean}
+      capacity: {type: string}
+      region-max-size: {type: string}
+      region-split-size: {type: string}
+      region-split-check-diff: {type: string}
+      raft-base-tick-interval: {type: string}
+      raft-heartbeat-ticks: {type: integer}
+      raft-election-timeout-ticks: {type: integer}
+      raft-entry-max-size: {type: string}
+      raft-log-gc-tick-interval: {type: string}
+      raft-log-gc-threshold: {type: integer}
+      raft-log-gc-count-limit: {type: integer}
+      raft-log-gc-size-limit: {type: string}
+      split-region-check-tick-interval: {type: string}
+      pd-heartbeat-tick-interval: {type: string}
+      pd-store-heartbeat-tick-interval: {type: string}
+      snap-mgr-gc-tick-interval: {type: string}
+      snap-gc-timeout: {type: string}
+      lock-cf-compact-interval: {type: string}
+      lock-cf-compact-bytes-threshold: {type: string}
+      notify-capacity: {type: integer}
+      messages-per-tick: {type: integer}
+      max-peer-down-duration: {type: string}
+      max-leader-missing-duration: {type: string}
+      abnormal-leader-missing-duration: {type: string}
+      peer-stale-state-check-interval: {type: string}
+      snap-apply-batch-size: {type: string}
+      consistency-check-interval: {type: string}
+      report-region-flow-interval: {type: string}
+      raft-store-max-leader-lease: {type: string}
+      right-derive-when-split: {type: boolean}
+      allow-remove-leader: {type: boolean}
+      merge-max-log-gap: {type: integer}
+      merge-check-tick-interval: {type: string}
+      use-delete-range: {type: boolean}
+      cleanup-import-sst-interval: {type: string}
+      apply-pool-size: {type: integer}
+      store-pool-size: {type: integer}
+  coprocessor:
+    type: object
+    properties:
+      split-region-on-table: {type: boolean}
+      batch-split-limit: {type: integer}
+      region-max-size: {type: string}
+      region-split-size: {type: string}
+      region-max-keys: {type: integer}
+      region-split-keys: {type: integer}
+  rocksdb:
+    type: object
+  raftdb:
+    type: object
+  security:
+    type: object
+    properties:
+      ca-path: {type: string}
+      cert-path: {type: string}
+      key-path: {type: string}
+  import:
+    type: object
+    properties:
+      import-dir: {type: string}
+      num-threads: {type: integer}
+      num-import-jobs: {type: integer}
+      num-import-sst-jobs: {type: integer}
+      max-prepare-duration: {type: string}
+      region-split-size: {type: string}
+      stream-channel-window: {type: integer}
+      max-open-engines: {type: integer}
+      upload-speed-limit: {type: string}
+`
+
+const tikvSchemaV30 = `
+  pessimistic_txn:
+    type: object
+    properties:
+      enabled: {type: boolean}
+      wait-for-lock-timeout: {type: integer}
+      wake-up-delay-duration: {type: integer}
+`
+
+const pdSchema = `
+type: object
+properties:
+  global:
+    type: object
+    properties:
+      lease: {type: integer}
+      tso-save-interval: {type: string}
+      namespace-classifier: {type: string}
+      enable-prevote: {type: boolean}
+  security:
+    type: object
+    properties:
+      cacert-path: {type: string}
+      cert-path: {type: string}
+      key-path: {type: string}
+  log:
+    type: object
+    properties:
+      level: {type: string}
+      format: {type: string}
+      disable-timestamp: {type: boolean}
+      file: {type: object}
+  metric:
+    type: object
+  schedule:
+    type: object
+    properties:
+      max-merge-region-size: {type: integer}
+      max-merge-region-keys: {type: integer}
+      split-merge-interval: {type: string}
+      max-snapshot-count: {type: integer}
+      max-pending-peer-count: {type: integer}
+      max-store-down-time: {type: string}
+      leader-schedule-limit: {type: integer}
+      region-schedule-limit: {type: integer}
+      replica-schedule-limit: {type: integer}
+      merge-schedule-limit: {type: integer}
+      tolerant-size-ratio: {type: number}
+      low-space-ratio: {type: number}
+      high-space-ratio: {type: number}
+      disable-raft-learner: {type: boolean}
+      disable-remove-down-replica: {type: boolean}
+      disable-replace-offline-replica: {type: boolean}
+      disable-make-up-replica: {type: boolean}
+      disable-remove-extra-replica: {type: boolean}
+      disable-location-replacement: {type: boolean}
+      disable-namespace-relocation: {type: boolean}
+      schedulers-v2: {type: array, items: {type: object}}
+  replication:
+    type: object
+    properties:
+      max-replicas: {type: integer}
+      location-labels: {type: array, items: {type: string}}
+  label-property:
+    type: object
+`
+
+const pdSchemaV30 = `
+  pd-server:
+    type: object
+    properties:
+      use-region-storage: {type: boolean}
+`
+
+const tidbSchema = `
+type: object
+properties:
+  global:
+    type: object
+    properties:
+      lease: {type: string}
+      split-table: {type: boolean}
+      token-limit: {type: integer}
+      oom-action: {type: string}
+      mem-quota-query: {type: integer}
+      enable-streaming: {type: boolean}
+      lower-case-table-names: {type: integer}
+      compatible-kill-query: {type: boolean}
+      check-mb4-value-in-utf8: {type: boolean}
+      treat-old-version-utf8-as-utf8mb4: {type: boolean}
+  log:
+    type: object
+    properties:
+      level: {type: string}
+      format: {type: string}
+      disable-timestamp: {type: boolean}
+      slow-query-file: {type: string}
+      slow-threshold: {type: integer}
+      expensive-threshold: {type: integer}
+      query-log-max-len: {type: integer}
+      file: {type: object}
+  security:
+    type: object
+  status:
+    type: object
+    properties:
+      report-status: {type: boolean}
+      metrics-interval: {type: integer}
+  performance:
+    type: object
+    properties:
+      max-procs: {type: integer}
+      stmt-count-limit: {type: integer}
+      tcp-keep-alive: {type: boolean}
+      cross-join: {type: boolean}
+      stats-lease: {type: string}
+      run-auto-analyze: {type: boolean}
+      feedback-probability: {type: number}
+      query-feedback-limit: {type: integer}
+      pseudo-estimate-ratio: {type: number}
+      force-priority: {type: string}
+  proxy_protocol:
+    type: object
+  prepared_plan_cache:
+    type: object
+    properties:
+      enabled: {type: boolean}
+      capacity: {type: integer}
+  opentracing:
+    type: object
+  tikv_client:
+    type: object
+    properties:
+      grpc-connection-count: {type: integer}
+      grpc-keepalive-time: {type: integer}
+      grpc-keepalive-timeout: {type: integer}
+      commit-timeout: {type: string}
+      max-txn-time-use: {type: integer}
+  txn_local_latches:
+    type: object
+    properties:
+      enabled: {type: boolean}
+      capacity: {type: integer}
+  binlog:
+    type: object
+    properties:
+      write-timeout: {type: string}
+      ignore-error: {type: boolean}
+`
+
+const tidbSchemaV30 = `
+  pessimistic_txn:
+    type: object
+    properties:
+      enable: {type: boolean}
+      max-retry-count: {type: integer}
+      ttl: {type: string}
+`
@@ -0,0 +1,203 @@
+package schema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Types of a Schema, the same as the json schema ones.
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+// Schema describes the type of a config value, it is a subset of json schema.
+// An object without properties accepts any keys, an object with properties
+// warns the keys not in them.
+type Schema struct {
+	Type       string             `yaml:"type"`
+	Properties map[string]*Schema `yaml:"properties"`
+	Items      *Schema            `yaml:"items"`
+}
+
+// Level is the severity of an Issue.
+type Level string
+
+const (
+	// LevelWarning is an unknown key, it may be an option the schema does not
+	// know yet.
+	LevelWarning Level = "warning"
+	// LevelError is a value of a wrong type.
+	LevelError Level = "error"
+)
+
+// Issue is a problem found in a config.
+type Issue struct {
+	Path    string
+	Level   Level
+	Message string
+}
+
+func (i *Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Level, i.Path, i.Message)
+}
+
+// Parse parses a schema in yaml or json.
+func Parse(data []byte) (*Schema, error) {
+	s := &Schema{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Type == "" {
+		return nil, fmt.Errorf("the type of the schema is empty")
+	}
+	return s, nil
+}
+
+// LoadFile loads a schema file in yaml or json.
+func LoadFile(file string) (*Schema, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse schema %s failed, %v", file, err)
+	}
+	return s, nil
+}
+
+// ValidateFile validates the yaml config file against s.
+func ValidateFile(s *Schema, file string) ([]*Issue, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var config interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("file %s is not a valid yaml file, %v", file, err)
+	}
+
+	return Validate(s, config), nil
+}
+
+// Validate validates the config decoded from yaml against s, the issues are
+// sorted by path. A null value is the default value of any type.
+func Validate(s *Schema, config interface{}) []*Issue {
+	issues := make([]*Issue, 0)
+	validate(s, "", config, &issues)
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues
+}
+
+func validate(s *Schema, path string, value interface{}, issues *[]*Issue) {
+	if value == nil || s == nil || s.Type == "" {
+		return
+	}
+
+	if !matchType(s.Type, value) {
+		*issues = append(*issues, &Issue{
+			Path:    displayPath(path),
+			Level:   LevelError,
+			Message: fmt.Sprintf("expected %s, got %s %v", s.Type, typeName(value), value),
+		})
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(s.Properties) == 0 {
+			return
+		}
+		for key, item := range v {
+			child, ok := s.Properties[key]
+			if !ok {
+				*issues = append(*issues, &Issue{
+					Path:    displayPath(joinPath(path, key)),
+					Level:   LevelWarning,
+					Message: "unknown key",
+				})
+				continue
+			}
+			validate(child, joinPath(path, key), item, issues)
+		}
+	case []interface{}:
+		for i, item := range v {
+			validate(s.Items, fmt.Sprintf("%s[%d]", path, i), item, issues)
+		}
+	}
+}
+
+func matchType(t string, value interface{}) bool {
+	switch t {
+	case TypeObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case TypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeInteger:
+		_, ok := value.(int)
+		return ok
+	case TypeNumber:
+		switch value.(type) {
+		case int, float64:
+			return true
+		}
+		return false
+	case TypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	default:
+		return true
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return TypeObject
+	case []interface{}:
+		return TypeArray
+	case string:
+		return TypeString
+	case int:
+		return TypeInteger
+	case float64:
+		return TypeNumber
+	case bool:
+		return TypeBoolean
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func joinPath(path, key string) string {
+	if strings.Contains(key, ".") {
+		key = fmt.Sprintf("%q", key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
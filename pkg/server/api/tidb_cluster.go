@@ -1,11 +1,14 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/tidbops/tim/pkg/models"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,10 +16,12 @@ type Response struct {
 	Code int64                 `json:"code"`
 	Msg  string                `json:"msg"`
 	Data []*models.TiDBCluster `json:"data"`
+	// Total is the number of all the tidb clusters of a paged response
+	Total int `json:"total,omitempty"`
 }
 
 func LoadTiDBClusters(c *gin.Context) {
-	tc, err := models.LoadTiDBClusters()
+	tc, err := models.LoadTiDBClusters(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("Get failed, %v", err)})
 		return
@@ -24,13 +29,33 @@ func LoadTiDBClusters(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": tc})
 }
 
+func LoadTiDBClustersPaged(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("offset invalid, %v", c.Query("offset"))})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("limit invalid, %v", c.Query("limit"))})
+		return
+	}
+
+	tc, total, err := models.LoadTiDBClustersPaged(c.Request.Context(), offset, limit)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("Get failed, %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": tc, "total": total})
+}
+
 func GetTiDBClustersByHost(c *gin.Context) {
 	host := c.Query("host")
 	if host == "" {
 		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": "host is empty"})
 		return
 	}
-	tc, err := models.GetTiDBClusterByHost(host)
+	tc, err := models.GetTiDBClusterByHost(c.Request.Context(), host)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("Get failed, %v", err)})
 		return
@@ -44,19 +69,59 @@ func GetTiDBClustersByName(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": "name is empty"})
 		return
 	}
-	tc, err := models.GetTiDBClusterByName(name)
+	tc, err := models.GetTiDBClusterByName(c.Request.Context(), name)
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("Get failed, %v", err)})
+		c.JSON(errorStatus(err), gin.H{"code": 10, "msg": fmt.Sprintf("Get failed, %v", err)})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": []*models.TiDBCluster{tc}})
 }
 
+func GetTiDBClustersByVersion(c *gin.Context) {
+	version := c.Query("version")
+	if version == "" {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": "version is empty"})
+		return
+	}
+	tc, err := models.GetTiDBClustersByVersion(c.Request.Context(), version)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("Get failed, %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": tc})
+}
+
+func GetTiDBClustersByStatus(c *gin.Context) {
+	status := c.Query("status")
+	if status == "" {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": "status is empty"})
+		return
+	}
+	tc, err := models.GetTiDBClustersByStatus(c.Request.Context(), status)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("Get failed, %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": tc})
+}
+
 func CreateTiDBCluster(c *gin.Context) {
+	createTiDBCluster(c, models.CreateTiDBCluster)
+}
+
+// UpsertTiDBCluster creates the tidb cluster or replaces the one of the same
+// name, see models.UpsertTiDBCluster.
+func UpsertTiDBCluster(c *gin.Context) {
+	createTiDBCluster(c, models.UpsertTiDBCluster)
+}
+
+// createTiDBCluster stores the tidb cluster of the form by store.
+func createTiDBCluster(c *gin.Context, store func(ctx context.Context, tc *models.TiDBCluster) error) {
 	name := c.PostForm("name")
 	version := c.PostForm("version")
 	path := c.PostForm("path")
 	host := c.PostForm("host")
+	hosts := splitHosts(c.PostForm("hosts"))
 	status := c.PostForm("status")
 	dateTime := c.DefaultPostForm("time", time.Now().Format("2006-01-02 15:04:05"))
 	if _, err := models.JudgeTiDBStatusType(status); err != nil {
@@ -64,17 +129,34 @@ func CreateTiDBCluster(c *gin.Context) {
 		return
 	}
 	desc := c.PostForm("description")
+	configHashes, err := parseStringMap(c.PostForm("config_hashes"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("config_hashes invaild, %v", err)})
+		return
+	}
+	labels, err := parseStringMap(c.PostForm("labels"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("labels invalid, %v", err)})
+		return
+	}
 	t, _ := time.Parse("2006-01-02 15:04:05", dateTime)
 	tc := &models.TiDBCluster{
-		Name:        name,
-		Version:     version,
-		Path:        path,
-		Host:        host,
-		Status:      status,
-		Description: desc,
-		InitTime:    t,
-	}
-	if err := models.CreateTiDBCluster(tc); err != nil {
+		Name:         name,
+		Version:      version,
+		Path:         path,
+		Host:         host,
+		Hosts:        hosts,
+		Status:       status,
+		Description:  desc,
+		InitTime:     t,
+		ConfigMode:   c.PostForm("config_mode"),
+		ConfigFile:   c.PostForm("config_file"),
+		ConfigHashes: configHashes,
+		Labels:       labels,
+		SSHAddress:   c.PostForm("ssh_address"),
+		SSHKey:       c.PostForm("ssh_key"),
+	}
+	if err := store(c.Request.Context(), tc); err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("store tidb cluster information failed, %v", err)})
 		return
 	}
@@ -95,7 +177,7 @@ func SearchTiDBClusters(c *gin.Context) {
 		"host":    host,
 		"status":  status,
 	}
-	tc, err := models.SearchTiDBClusters(params)
+	tc, err := models.SearchTiDBClusters(c.Request.Context(), params)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("Search failed, %v", err)})
 		return
@@ -109,6 +191,7 @@ func UpdateTiDBClusters(c *gin.Context) {
 	version := c.PostForm("version")
 	path := c.PostForm("path")
 	host := c.PostForm("host")
+	hosts := splitHosts(c.PostForm("hosts"))
 	status := c.PostForm("status")
 	dateTime := c.PostForm("time")
 	desc := c.PostForm("description")
@@ -122,20 +205,81 @@ func UpdateTiDBClusters(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("TiDBStatus invaild, %v", status)})
 		return
 	}
+	configHashes, err := parseStringMap(c.PostForm("config_hashes"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("config_hashes invaild, %v", err)})
+		return
+	}
+	labels, err := parseStringMap(c.PostForm("labels"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("labels invalid, %v", err)})
+		return
+	}
 	t, _ := time.Parse("2006-01-02 15:04:05", dateTime)
 	tc := &models.TiDBCluster{
-		ID:          idInt64,
-		Name:        name,
-		Version:     version,
-		Path:        path,
-		Host:        host,
-		Status:      status,
-		Description: desc,
-		InitTime:    t,
-	}
-	if err := models.UpdateTiDBCluster(tc); err != nil {
+		ID:           idInt64,
+		Name:         name,
+		Version:      version,
+		Path:         path,
+		Host:         host,
+		Hosts:        hosts,
+		Status:       status,
+		Description:  desc,
+		InitTime:     t,
+		ConfigMode:   c.PostForm("config_mode"),
+		ConfigFile:   c.PostForm("config_file"),
+		ConfigHashes: configHashes,
+		Labels:       labels,
+		SSHAddress:   c.PostForm("ssh_address"),
+		SSHKey:       c.PostForm("ssh_key"),
+	}
+	if err := models.UpdateTiDBCluster(c.Request.Context(), tc); err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("update tidb cluster information failed, %v", err)})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": []*models.TiDBCluster{tc}})
 }
+
+func DeleteTiDBCluster(c *gin.Context) {
+	name := c.PostForm("name")
+	if name == "" {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": "name is empty"})
+		return
+	}
+	if err := models.DeleteTiDBCluster(c.Request.Context(), name); err != nil {
+		c.JSON(errorStatus(err), gin.H{"code": 10, "msg": fmt.Sprintf("delete tidb cluster information failed, %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success"})
+}
+
+// parseStringMap parses a json map form value, e.g. config_hashes or labels,
+// an empty value is a nil map.
+func parseStringMap(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// splitHosts splits the comma separated hosts form value.
+func splitHosts(s string) []string {
+	var hosts []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+func errorStatus(err error) int {
+	if models.IsErrTiDBClusterNotExist(err) {
+		return http.StatusNotFound
+	}
+	return http.StatusOK
+}
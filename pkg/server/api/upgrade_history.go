@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/tidbops/tim/pkg/models"
+	"net/http"
+	"time"
+)
+
+type HistoryResponse struct {
+	Code int64                    `json:"code"`
+	Msg  string                   `json:"msg"`
+	Data []*models.UpgradeHistory `json:"data"`
+}
+
+func CreateUpgradeHistory(c *gin.Context) {
+	name := c.PostForm("name")
+	if name == "" {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": "name is empty"})
+		return
+	}
+	startTime, _ := time.Parse(time.RFC3339, c.PostForm("startTime"))
+	endTime, _ := time.Parse(time.RFC3339, c.PostForm("endTime"))
+	h := &models.UpgradeHistory{
+		Name:          name,
+		Operation:     c.PostForm("operation"),
+		FromVersion:   c.PostForm("fromVersion"),
+		TargetVersion: c.PostForm("targetVersion"),
+		ConfigMode:    c.PostForm("configMode"),
+		ConfigFile:    c.PostForm("configFile"),
+		Result:        c.PostForm("result"),
+		Error:         c.PostForm("error"),
+		Operator:      c.PostForm("operator"),
+		Host:          c.PostForm("host"),
+		Artifacts:     c.PostForm("artifacts"),
+		StartTime:     startTime,
+		EndTime:       endTime,
+	}
+	if err := models.CreateUpgradeHistory(c.Request.Context(), h); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("store upgrade history failed, %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": []*models.UpgradeHistory{h}})
+}
+
+func GetUpgradeHistoryByName(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": "name is empty"})
+		return
+	}
+	hs, err := models.GetUpgradeHistoryByName(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 10, "msg": fmt.Sprintf("Get failed, %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": hs})
+}
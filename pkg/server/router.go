@@ -18,11 +18,18 @@ func Router(r *gin.Engine) {
 	r.SetHTMLTemplate(t)
 	r.GET("api/status", api.Status)
 	r.GET("api/loadtidbclusters", api.LoadTiDBClusters)
+	r.GET("api/loadtidbclusterspaged", api.LoadTiDBClustersPaged)
 	r.POST("api/createtidbcluster", api.CreateTiDBCluster)
+	r.POST("api/upserttidbcluster", api.UpsertTiDBCluster)
 	r.GET("api/gettidbclustersbyname", api.GetTiDBClustersByName)
 	r.GET("api/gettidbclustersbyhost", api.GetTiDBClustersByHost)
+	r.GET("api/gettidbclustersbyversion", api.GetTiDBClustersByVersion)
+	r.GET("api/gettidbclustersbystatus", api.GetTiDBClustersByStatus)
 	r.GET("api/searchtidbclusters", api.SearchTiDBClusters)
 	r.POST("api/updatetidbcluster", api.UpdateTiDBClusters)
+	r.POST("api/deletetidbcluster", api.DeleteTiDBCluster)
+	r.POST("api/createupgradehistory", api.CreateUpgradeHistory)
+	r.GET("api/getupgradehistorybyname", api.GetUpgradeHistoryByName)
 
 	r.GET("index", web.Index)
 }
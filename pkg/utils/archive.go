@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TarGz archives the files in directory src to the tar.gz file dist, the
+// paths in the archive are relative to src.
+func TarGz(src string, dist string) (err error) {
+	src = filepath.Clean(src)
+
+	out, err := fs.Create(dist)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := out.Close(); e != nil && err == nil {
+			err = e
+		}
+		if err != nil {
+			fs.Remove(dist)
+		}
+	}()
+
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+
+	err = walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip symlinks.
+		if info.Mode()&os.ModeSymlink != 0 || path == src {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := fs.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// UntarGz extracts the tar.gz file src to directory dist.
+func UntarGz(src string, dist string) error {
+	f, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return untarGz(f, src, dist)
+}
+
+// untarGz extracts the tar.gz stream r of src to directory dist.
+func untarGz(r io.Reader, src string, dist string) error {
+	return walkTarGzReader(r, func(header *tar.Header, r io.Reader) (bool, error) {
+		path := filepath.Join(dist, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dist)+string(os.PathSeparator)) {
+			return false, fmt.Errorf("invalid file %s in %s", header.Name, src)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return true, fs.MkdirAll(path, os.FileMode(header.Mode))
+		case tar.TypeReg:
+			if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return false, err
+			}
+			f, err := fs.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return false, err
+			}
+			defer f.Close()
+
+			_, err = io.Copy(f, r)
+			return true, err
+		}
+		return true, nil
+	})
+}
+
+// ReadTarGzFile reads the file name from the tar.gz file src.
+func ReadTarGzFile(src string, name string) ([]byte, error) {
+	var data []byte
+	found := false
+	err := walkTarGz(src, func(header *tar.Header, r io.Reader) (bool, error) {
+		if header.Name != name {
+			return true, nil
+		}
+		found = true
+
+		var err error
+		data, err = ioutil.ReadAll(r)
+		return false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found in %s", name, src)
+	}
+	return data, nil
+}
+
+func walkTarGz(src string, fn func(header *tar.Header, r io.Reader) (bool, error)) error {
+	f, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return walkTarGzReader(f, fn)
+}
+
+func walkTarGzReader(r io.Reader, fn func(header *tar.Header, r io.Reader) (bool, error)) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		next, err := fn(header, tr)
+		if err != nil || !next {
+			return err
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ngaut/log"
+	"github.com/tidbops/tim/pkg/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// DownloadRetries is the number of retries after the first failed attempt
+	// of DownloadFile, set it to 0 to disable retrying.
+	DownloadRetries = 2
+	// DownloadRetryDelay is the delay before the first retry, it doubles
+	// after every retry.
+	DownloadRetryDelay = time.Second
+	// DownloadTimeout is the time limit of a download attempt, including
+	// reading the response body, 0 means no limit.
+	DownloadTimeout = 30 * time.Second
+)
+
+var downloadDuration = metrics.NewHistogramVec("tim_download_duration_seconds",
+	"The time of the file downloads including the retries, by result success / error.", nil, "result")
+
+// DownloadOptions specifies the verification of a downloaded file.
+type DownloadOptions struct {
+	// ValidateYAML checks the downloaded file is a yaml mapping.
+	ValidateYAML bool
+	// SHA256 is the expected hex encoded sha256 checksum of the file,
+	// empty means not to check.
+	SHA256 string
+	// Progress is called with the downloaded bytes, nil means not to report
+	// the progress.
+	Progress ProgressFunc
+}
+
+// DownloadFile downloads url to filepath, network errors and 5xx responses
+// are retried with exponential backoff, other responses fail immediately. The
+// download and the retries are aborted when ctx is done.
+func DownloadFile(ctx context.Context, url string, filepath string) error {
+	return DownloadFileWithOptions(ctx, url, filepath, nil)
+}
+
+// DownloadFileWithOptions is like DownloadFile, it also verifies the
+// downloaded file with opts. The file is downloaded to a temporary file beside
+// filepath and renamed to it when verified, a failed download or verification
+// leaves no partial file at filepath.
+func DownloadFileWithOptions(ctx context.Context, url string, filepath string, opts *DownloadOptions) (err error) {
+	defer func(start time.Time) {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		downloadDuration.ObserveSince(start, result)
+	}(time.Now())
+
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+
+	delay := DownloadRetryDelay
+	for attempt := 0; ; attempt++ {
+		tmpFile, retryable, err := downloadFile(ctx, url, filepath, opts.Progress)
+		if err == nil {
+			if err = verifyFile(tmpFile, opts); err != nil {
+				fs.Remove(tmpFile)
+				return fmt.Errorf("verify %s downloaded from %s failed, %v", filepath, url, err)
+			}
+			if err = fs.Rename(tmpFile, filepath); err != nil {
+				fs.Remove(tmpFile)
+				return err
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("download %s aborted, %v", url, ctx.Err())
+		}
+		if !retryable || attempt >= DownloadRetries {
+			return err
+		}
+
+		log.Warnf("download %s failed, retry in %s, %v", url, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("download %s aborted, %v", url, ctx.Err())
+		}
+		delay *= 2
+	}
+}
+
+// downloadFile downloads url to a temporary file in the directory of dist and
+// returns it, the temporary file is removed if the download fails.
+func downloadFile(ctx context.Context, url string, dist string, progress ProgressFunc) (string, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	client, err := downloadClient()
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", true, proxyError(client, req, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", resp.StatusCode >= http.StatusInternalServerError,
+			fmt.Errorf("download %s failed, %s", url, resp.Status)
+	}
+
+	out, err := fs.TempFile(filepath.Dir(dist), "."+filepath.Base(dist)+".tmp-")
+	if err != nil {
+		return "", false, err
+	}
+	tmpFile := out.Name()
+
+	var body io.Reader = resp.Body
+	if progress != nil {
+		pw := &progressWriter{total: resp.ContentLength, progress: progress}
+		defer func() { progress(pw.written, pw.total, true) }()
+		body = io.TeeReader(resp.Body, pw)
+	}
+
+	_, err = io.Copy(out, body)
+	if e := out.Close(); err == nil && e != nil {
+		err = e
+	}
+	if err == nil {
+		// TempFile creates the file only readable by the owner
+		err = fs.Chmod(tmpFile, 0644)
+	}
+	if err != nil {
+		fs.Remove(tmpFile)
+		return "", true, err
+	}
+
+	return tmpFile, false, nil
+}
+
+func verifyFile(filepath string, opts *DownloadOptions) error {
+	data, err := ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	if opts.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, opts.SHA256) {
+			return fmt.Errorf("sha256 mismatch, expected %s, got %s", opts.SHA256, actual)
+		}
+	}
+
+	if opts.ValidateYAML {
+		var content map[interface{}]interface{}
+		if err := yaml.Unmarshal(data, &content); err != nil {
+			return fmt.Errorf("invalid yaml, %v", err)
+		}
+	}
+
+	return nil
+}
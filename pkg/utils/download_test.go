@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadFileLeavesNoPartialFile(t *testing.T) {
+	retries := DownloadRetries
+	DownloadRetries = 0
+	defer func() { DownloadRetries = retries }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/truncated":
+			// the connection is closed before the announced length
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("a: 1\n"))
+		case "/invalid":
+			w.Write([]byte("a: [1\n"))
+		default:
+			w.Write([]byte("a: 1\n"))
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "tim-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	opts := &DownloadOptions{ValidateYAML: true}
+	for _, p := range []string{"/truncated", "/invalid"} {
+		file := filepath.Join(dir, "tikv.yml")
+		if err := DownloadFileWithOptions(ctx, srv.URL+p, file, opts); err == nil {
+			t.Errorf("download %s succeeded, want an error", p)
+		}
+		if FileExists(file) {
+			t.Errorf("download %s left %s", p, file)
+		}
+	}
+
+	file := filepath.Join(dir, "tikv.yml")
+	if err := DownloadFileWithOptions(ctx, srv.URL+"/tikv.yml", file, opts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil || string(data) != "a: 1\n" {
+		t.Fatalf("%s = %q, %v, want %q", file, data, err, "a: 1\n")
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d files in %s, want only tikv.yml", len(entries), dir)
+	}
+	if mode := entries[0].Mode().Perm(); mode != 0644 {
+		t.Errorf("mode of %s = %o, want 644", file, mode)
+	}
+}
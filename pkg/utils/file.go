@@ -4,22 +4,20 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
 func FileExists(name string) bool {
-	if _, err := os.Stat(name); os.IsNotExist(err) {
+	if _, err := fs.Stat(name); os.IsNotExist(err) {
 		return false
 	}
 	return true
 }
 
 func WriteLines(lines []string, path string) error {
-	file, err := os.Create(path)
+	file, err := fs.Create(path)
 	if err != nil {
 		return err
 	}
@@ -32,37 +30,96 @@ func WriteLines(lines []string, path string) error {
 	return w.Flush()
 }
 
-func WriteToFile(content string, path string) error {
-	file, err := os.Create(path)
+// WriteToFile writes content to path atomically, it is written to a temp
+// file in the same directory first and renamed to path, so path is either
+// the old file or the complete new one. The mode of an existing path is kept,
+// a new file is 0644. A symlink is written through, and a path which is not a
+// regular file, e.g. /dev/stdout, is written directly.
+func WriteToFile(content string, path string) (err error) {
+	mode := os.FileMode(0644)
+	if fi, err := fs.Stat(path); err == nil {
+		if !fi.Mode().IsRegular() {
+			return writeDirectly(content, path)
+		}
+		mode = fi.Mode().Perm()
+		if resolved, err := fs.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+	}
+
+	file, err := fs.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			fs.Remove(file.Name())
+		}
+	}()
 
-	defer file.Close()
+	if _, err = io.WriteString(file, content); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	if err = fs.Chmod(file.Name(), mode); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
 
-	_, err = file.WriteString(content)
+	return fs.Rename(file.Name(), path)
+}
 
+func writeDirectly(content string, path string) error {
+	file, err := fs.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.WriteString(file, content)
 	return err
 }
 
-func CopyFile(src, dst string) (err error) {
-	in, err := os.Open(src)
+// CopyFileOptions are the options of CopyFileWithOptions.
+type CopyFileOptions struct {
+	// VerifyHash compares the sha256 checksums of src and dst after the copy
+	VerifyHash bool
+}
+
+// CopyFile copies src to dst with the mode of src, dst is synced to disk and
+// its size is checked before it returns.
+func CopyFile(src, dst string) error {
+	return CopyFileWithOptions(src, dst, nil)
+}
+
+// CopyFileWithOptions is like CopyFile, it also verifies dst by opts.
+func CopyFileWithOptions(src, dst string, opts *CopyFileOptions) (err error) {
+	if opts == nil {
+		opts = &CopyFileOptions{}
+	}
+
+	in, err := fs.Open(src)
 	if err != nil {
 		return
 	}
 	defer in.Close()
 
-	out, err := os.Create(dst)
+	out, err := fs.Create(dst)
 	if err != nil {
 		return
 	}
 	defer func() {
-		if e := out.Close(); e != nil {
+		if e := out.Close(); e != nil && err == nil {
 			err = e
 		}
 	}()
 
-	_, err = io.Copy(out, in)
+	n, err := io.Copy(out, in)
 	if err != nil {
 		return
 	}
@@ -72,23 +129,66 @@ func CopyFile(src, dst string) (err error) {
 		return
 	}
 
-	si, err := os.Stat(src)
+	si, err := in.Stat()
 	if err != nil {
 		return
 	}
-	err = os.Chmod(dst, si.Mode())
+	if n != si.Size() {
+		return fmt.Errorf("copy %s to %s is incomplete, %d of %d bytes copied", src, dst, n, si.Size())
+	}
+	di, err := out.Stat()
 	if err != nil {
 		return
 	}
+	if di.Size() != si.Size() {
+		return fmt.Errorf("the size of %s is %d after copy, expected %d", dst, di.Size(), si.Size())
+	}
+
+	err = fs.Chmod(dst, si.Mode())
+	if err != nil {
+		return
+	}
+
+	if opts.VerifyHash {
+		var srcHash, dstHash string
+		if srcHash, err = FileSHA256(src); err != nil {
+			return
+		}
+		if dstHash, err = FileSHA256(dst); err != nil {
+			return
+		}
+		if srcHash != dstHash {
+			return fmt.Errorf("%s is not the same as %s after copy, sha256 %s, expected %s", dst, src, dstHash, srcHash)
+		}
+	}
 
 	return
 }
 
-func CopyDir(src string, dst string) (err error) {
+// CopyDirOptions are the options of CopyDirWithOptions.
+type CopyDirOptions struct {
+	// FollowSymlinks copies the files and directories the symlinks refer to
+	// instead of recreating the symlinks
+	FollowSymlinks bool
+}
+
+// CopyDir copies the directory tree of src to dst, dst must not exist. The
+// modes of the files and directories are kept and the symlinks are recreated
+// as symlinks with the same targets.
+func CopyDir(src string, dst string) error {
+	return CopyDirWithOptions(src, dst, nil)
+}
+
+// CopyDirWithOptions is like CopyDir, the symlinks are copied by opts.
+func CopyDirWithOptions(src string, dst string, opts *CopyDirOptions) (err error) {
+	if opts == nil {
+		opts = &CopyDirOptions{}
+	}
+
 	src = filepath.Clean(src)
 	dst = filepath.Clean(dst)
 
-	si, err := os.Stat(src)
+	si, err := fs.Stat(src)
 	if err != nil {
 		return err
 	}
@@ -96,7 +196,7 @@ func CopyDir(src string, dst string) (err error) {
 		return fmt.Errorf("source is not a directory")
 	}
 
-	_, err = os.Stat(dst)
+	_, err = fs.Lstat(dst)
 	if err != nil && !os.IsNotExist(err) {
 		return
 	}
@@ -104,12 +204,12 @@ func CopyDir(src string, dst string) (err error) {
 		return fmt.Errorf("%s destination already exists", dst)
 	}
 
-	err = os.MkdirAll(dst, si.Mode())
+	err = fs.MkdirAll(dst, si.Mode())
 	if err != nil {
 		return
 	}
 
-	entries, err := ioutil.ReadDir(src)
+	entries, err := fs.ReadDir(src)
 	if err != nil {
 		return
 	}
@@ -118,59 +218,71 @@ func CopyDir(src string, dst string) (err error) {
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
 
-		if entry.IsDir() {
-			err = CopyDir(srcPath, dstPath)
-			if err != nil {
-				return
-			}
-		} else {
-			// Skip symlinks.
-			if entry.Mode()&os.ModeSymlink != 0 {
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if !opts.FollowSymlinks {
+				var target string
+				target, err = fs.Readlink(srcPath)
+				if err != nil {
+					return
+				}
+				err = fs.Symlink(target, dstPath)
+				if err != nil {
+					return
+				}
 				continue
 			}
 
-			err = CopyFile(srcPath, dstPath)
+			entry, err = fs.Stat(srcPath)
 			if err != nil {
-				return
+				return fmt.Errorf("follow symlink %s failed, %v", srcPath, err)
 			}
 		}
-	}
 
-	return
-}
-
-func ReplaceStrInFile(file string, old, new string) error {
-	input, err := ioutil.ReadFile(file)
-	if err != nil {
-		return err
+		if entry.IsDir() {
+			err = CopyDirWithOptions(srcPath, dstPath, opts)
+		} else {
+			err = CopyFile(srcPath, dstPath)
+		}
+		if err != nil {
+			return
+		}
 	}
 
-	output := strings.Replace(string(input), old, new, -1)
-	err = ioutil.WriteFile(file, []byte(output), 0644)
-	if err != nil {
-		return err
-	}
+	// the mode of the directory is changed by umask when it is created
+	return fs.Chmod(dst, si.Mode())
+}
 
-	return nil
+// DirSize returns the total size of the regular files in the directory tree of
+// path, the symlinks are not followed.
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
 }
 
-func DownloadFile(url string, filepath string) error {
-	out, err := os.Create(filepath)
+func ReplaceStrInFile(file string, old, new string) error {
+	input, err := ReadFile(file)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
-	resp, err := http.Get(url)
+	output := strings.Replace(string(input), old, new, -1)
+	f, err := fs.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
+	if _, err := io.WriteString(f, output); err != nil {
+		f.Close()
 		return err
 	}
 
-	return nil
+	return f.Close()
 }
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tim-utils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// makeConfTree creates a conf tree with an executable script, a relative
+// symlink to a file and one to a directory in root.
+func makeConfTree(t *testing.T, root string) string {
+	t.Helper()
+	conf := filepath.Join(root, "conf")
+	if err := os.MkdirAll(filepath.Join(conf, "scripts"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(conf, "scripts"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]os.FileMode{
+		"tikv.yml":         0644,
+		"secret.yml":       0600,
+		"scripts/run_tikv": 0755,
+	}
+	for name, mode := range files {
+		file := filepath.Join(conf, name)
+		if err := ioutil.WriteFile(file, []byte(name+"\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(file, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("tikv.yml", filepath.Join(conf, "tikv-main.yml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("scripts", filepath.Join(conf, "bin")); err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func TestCopyDirKeepsModesAndSymlinks(t *testing.T) {
+	root := tempDir(t)
+	defer os.RemoveAll(root)
+	src := makeConfTree(t, root)
+	dst := filepath.Join(root, "conf-copy")
+
+	if err := CopyDir(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mode := range map[string]os.FileMode{
+		"tikv.yml":         0644,
+		"secret.yml":       0600,
+		"scripts":          0750 | os.ModeDir,
+		"scripts/run_tikv": 0755,
+	} {
+		fi, err := os.Lstat(filepath.Join(dst, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := fi.Mode() & (os.ModePerm | os.ModeDir); got != mode {
+			t.Errorf("mode of %s = %v, want %v", name, got, mode)
+		}
+	}
+
+	for name, target := range map[string]string{"tikv-main.yml": "tikv.yml", "bin": "scripts"} {
+		got, err := os.Readlink(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("%s is not a symlink, %v", name, err)
+			continue
+		}
+		if got != target {
+			t.Errorf("%s links to %s, want %s", name, got, target)
+		}
+	}
+
+	if err := CopyDir(src, dst); err == nil {
+		t.Error("copy to the existing destination succeeded, want an error")
+	}
+}
+
+func TestCopyDirFollowSymlinks(t *testing.T) {
+	root := tempDir(t)
+	defer os.RemoveAll(root)
+	src := makeConfTree(t, root)
+	dst := filepath.Join(root, "conf-copy")
+
+	if err := CopyDirWithOptions(src, dst, &CopyDirOptions{FollowSymlinks: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Lstat(filepath.Join(dst, "tikv-main.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.Mode().IsRegular() {
+		t.Errorf("tikv-main.yml is %v, want a regular file", fi.Mode())
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "tikv-main.yml")); string(data) != "tikv.yml\n" {
+		t.Errorf("tikv-main.yml = %q, want the content of tikv.yml", data)
+	}
+
+	fi, err = os.Lstat(filepath.Join(dst, "bin", "run_tikv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Errorf("mode of bin/run_tikv = %v, want 0755", fi.Mode().Perm())
+	}
+}
+
+func TestCopyFileLarge(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// larger than the buffers of io.Copy, not a multiple of them
+	data := make([]byte, 8<<20+13)
+	rand.New(rand.NewSource(1)).Read(data)
+	src := filepath.Join(dir, "src.bin")
+	if err := ioutil.WriteFile(src, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "dst.bin")
+	if err := CopyFileWithOptions(src, dst, &CopyFileOptions{VerifyHash: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("%s differs from %s, %d of %d bytes", dst, src, len(got), len(data))
+	}
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("mode of %s = %v, want 0640", dst, fi.Mode().Perm())
+	}
+
+	// an existing dst is replaced
+	if err := ioutil.WriteFile(dst, []byte("old content longer than nothing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Fatalf("%s differs from %s after copying over it", dst, src)
+	}
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// File is an open file of an FS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// FS is the filesystem the file utils operate on, in the manner of afero.Fs,
+// e.g. an in-memory one for tests or a remote one. The methods are the ones of
+// the os package of the same names.
+type FS interface {
+	Open(name string) (File, error)
+	Create(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	// TempFile is ioutil.TempFile
+	TempFile(dir, pattern string) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	// ReadDir is ioutil.ReadDir, the entries are sorted by name
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+	// EvalSymlinks is filepath.EvalSymlinks
+	EvalSymlinks(path string) (string, error)
+}
+
+// OsFS is the FS of the local disk.
+type OsFS struct{}
+
+func (OsFS) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (OsFS) Create(name string) (File, error) {
+	return os.Create(name)
+}
+
+func (OsFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (OsFS) TempFile(dir, pattern string) (File, error) {
+	return ioutil.TempFile(dir, pattern)
+}
+
+func (OsFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OsFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (OsFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
+func (OsFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OsFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (OsFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (OsFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OsFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (OsFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (OsFS) EvalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
+// fs is the FS of the file utils, the local disk by default.
+var fs FS = OsFS{}
+
+// SetFS replaces the FS of the file utils and returns the previous one, e.g.
+// to restore it after a test.
+func SetFS(f FS) FS {
+	prev := fs
+	fs = f
+	return prev
+}
+
+// ReadFile reads the file name of the FS.
+func ReadFile(name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
+
+// walk is filepath.Walk on the FS, the symlinks are not followed.
+func walk(root string, fn filepath.WalkFunc) error {
+	info, err := fs.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkPath(root, info, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkPath(path string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	entries, err := fs.ReadDir(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		name := filepath.Join(path, entry.Name())
+		if err := walkPath(name, entry, fn); err != nil {
+			if !entry.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
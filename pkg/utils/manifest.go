@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestEntry is the expected sha256 checksum of a file in a directory.
+type ManifestEntry struct {
+	// Path is the slash separated path relative to the directory
+	Path   string
+	SHA256 string
+}
+
+// ParseManifest parses a manifest file in the format of sha256sum, a line is
+// the hex encoded checksum and the path separated by spaces, a path may be
+// prefixed with "*" for binary mode. Empty lines and lines starting with "#"
+// are ignored.
+func ParseManifest(file string) ([]*ManifestEntry, error) {
+	f, err := fs.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*ManifestEntry
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the path may contain spaces
+		i := strings.IndexAny(line, " \t")
+		if i != sha256.Size*2 {
+			return nil, fmt.Errorf("%s:%d is invalid, it should be <sha256> <path>", file, n)
+		}
+		sum, path := line[:i], strings.TrimPrefix(strings.TrimSpace(line[i:]), "*")
+		if _, err := hex.DecodeString(sum); err != nil || path == "" {
+			return nil, fmt.Errorf("%s:%d is invalid, it should be <sha256> <path>", file, n)
+		}
+		entries = append(entries, &ManifestEntry{
+			Path:   path,
+			SHA256: strings.ToLower(sum),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// VerifyManifest checks the files in dir have the checksums of the manifest
+// file, a missing file is an error as well. The files not listed are not
+// checked.
+func VerifyManifest(dir string, manifest string) error {
+	entries, err := ParseManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	var mismatched []string
+	for _, e := range entries {
+		actual, err := FileSHA256(filepath.Join(dir, filepath.FromSlash(e.Path)))
+		if err != nil {
+			mismatched = append(mismatched, fmt.Sprintf("%s: %v", e.Path, err))
+			continue
+		}
+		if actual != e.SHA256 {
+			mismatched = append(mismatched, fmt.Sprintf("%s: sha256 mismatch, expected %s, got %s",
+				e.Path, e.SHA256, actual))
+		}
+	}
+
+	if len(mismatched) > 0 {
+		return fmt.Errorf("%d of %d files in %s do not match %s:\n  %s",
+			len(mismatched), len(entries), dir, manifest, strings.Join(mismatched, "\n  "))
+	}
+
+	return nil
+}
+
+// FileSHA256 returns the hex encoded sha256 checksum of file.
+func FileSHA256(file string) (string, error) {
+	f, err := fs.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// ProgressFunc is called while a file is being downloaded, total is -1 if the
+// server does not send the Content-Length, done is true after the last call of
+// an attempt.
+type ProgressFunc func(downloaded, total int64, done bool)
+
+// progressInterval is the min interval between two renderings of a progress
+// bar.
+const progressInterval = 200 * time.Millisecond
+
+// NewProgressBar returns a ProgressFunc rendering the progress of name in a
+// line of out, it is meant for a terminal.
+func NewProgressBar(out io.Writer, name string) ProgressFunc {
+	var last time.Time
+	return func(downloaded, total int64, done bool) {
+		if !done && time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+
+		if total > 0 {
+			fmt.Fprintf(out, "\r%s %s / %s %3d%%", name, FormatBytes(downloaded),
+				FormatBytes(total), downloaded*100/total)
+		} else {
+			fmt.Fprintf(out, "\r%s %s", name, FormatBytes(downloaded))
+		}
+		if done {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+// FormatBytes formats n bytes in the binary units, e.g. 1.5MB.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// progressWriter reports the bytes written to it.
+type progressWriter struct {
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	w.progress(w.written, w.total, false)
+	return len(p), nil
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DownloadProxy is the proxy url of DownloadFile, e.g. http://10.0.0.1:3128,
+// it overrides the HTTP_PROXY, HTTPS_PROXY and NO_PROXY env which are used
+// when it is empty. Check it with ParseProxyURL before setting it.
+var DownloadProxy string
+
+// ParseProxyURL parses a proxy url of the scheme http, https or socks5.
+func ParseProxyURL(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s is invalid, %v", proxy, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy %s is invalid, the scheme must be http / https / socks5", proxy)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy %s is invalid, the host is empty", proxy)
+	}
+	return u, nil
+}
+
+// downloadClient returns the http client of DownloadFile, the transport is
+// the one of http.DefaultTransport but the proxy of DownloadProxy.
+func downloadClient() (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if DownloadProxy != "" {
+		u, err := ParseProxyURL(DownloadProxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{Timeout: DownloadTimeout, Transport: transport}, nil
+}
+
+// proxyError returns err of the request req by client with the proxy it went
+// through if the proxy failed the connection, or err itself.
+func proxyError(client *http.Client, req *http.Request, err error) error {
+	opErr, ok := unwrapOpError(err)
+	if !ok || opErr.Op != "proxyconnect" {
+		return err
+	}
+
+	proxy := "the proxy"
+	if t, ok := client.Transport.(*http.Transport); ok && t.Proxy != nil {
+		if u, e := t.Proxy(req); e == nil && u != nil {
+			proxy = "proxy " + redactURL(u)
+		}
+	}
+	return fmt.Errorf("download %s failed, %s refused the connection, check --proxy or the HTTP_PROXY / HTTPS_PROXY env, %v",
+		req.URL, proxy, opErr.Err)
+}
+
+func unwrapOpError(err error) (*net.OpError, bool) {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return opErr, ok
+}
+
+// redactURL returns u without the password.
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	r := *u
+	r.User = url.User(u.User.Username())
+	return r.String()
+}
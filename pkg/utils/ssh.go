@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// SSHTarget is a remote host the files are read from by the ssh binary, the
+// keys, known hosts and options of ~/.ssh/config apply as usual.
+type SSHTarget struct {
+	User string
+	Host string
+	Port string
+	// IdentityFile is the private key to login with, empty for the default ones
+	IdentityFile string
+}
+
+// ParseSSHAddress parses an ssh address of [user@]host[:port].
+func ParseSSHAddress(address string, identityFile string) (*SSHTarget, error) {
+	t := &SSHTarget{IdentityFile: identityFile}
+	host := address
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		t.User, host = host[:i], host[i+1:]
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		host, t.Port = h, port
+	}
+	if host == "" || strings.ContainsAny(host, " /") {
+		return nil, fmt.Errorf("ssh address %s is invalid, the format is [user@]host[:port]", address)
+	}
+	t.Host = host
+	return t, nil
+}
+
+func (t *SSHTarget) String() string {
+	s := t.Host
+	if t.User != "" {
+		s = t.User + "@" + s
+	}
+	if t.Port != "" {
+		s += ":" + t.Port
+	}
+	return s
+}
+
+// Output runs the shell command on the host and returns its output.
+func (t *SSHTarget) Output(ctx context.Context, command string) ([]byte, error) {
+	var stdout bytes.Buffer
+	if err := t.run(ctx, command, &stdout); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// FetchFiles copies the files and directories names in dir of the host into
+// the local directory dist, the missing ones are skipped. They are archived by
+// tar on the host, which is read-only there.
+func (t *SSHTarget) FetchFiles(ctx context.Context, dir string, names []string, dist string) error {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, ShellQuote(name))
+	}
+	command := fmt.Sprintf(`cd %s || exit 1; set --; for f in %s; do [ -e "$f" ] && set -- "$@" "$f"; done; [ $# -eq 0 ] || tar -czf - "$@"`,
+		ShellQuote(dir), strings.Join(quoted, " "))
+
+	out, err := t.Output(ctx, command)
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return untarGz(bytes.NewReader(out), t.String()+":"+dir, dist)
+}
+
+func (t *SSHTarget) run(ctx context.Context, command string, stdout io.Writer) error {
+	// BatchMode fails instead of asking for a password or a host key
+	args := []string{"-o", "BatchMode=yes"}
+	if t.Port != "" {
+		args = append(args, "-p", t.Port)
+	}
+	if t.IdentityFile != "" {
+		args = append(args, "-i", t.IdentityFile)
+	}
+	dest := t.Host
+	if t.User != "" {
+		dest = t.User + "@" + dest
+	}
+	args = append(args, dest, command)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ssh %s failed, %v: %s", t, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// ShellQuote quotes s as a single word of a posix shell.
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionRegexp = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+
+// Version is a tidb release version, e.g. v3.0.4, or a pre-release version
+// like v4.0.0-rc.1.
+type Version struct {
+	Major int64
+	Minor int64
+	Patch int64
+	// Prerelease is the dot separated identifiers after "-", e.g. rc.1
+	Prerelease string
+}
+
+func ParseVersion(version string) (*Version, error) {
+	matches := versionRegexp.FindStringSubmatch(version)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid version %s, the version should be in vX.Y.Z format, e.g. v3.0.4", version)
+	}
+
+	v := &Version{Prerelease: matches[4]}
+	for i, p := range []*int64{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.ParseInt(matches[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		*p = n
+	}
+
+	return v, nil
+}
+
+// CompareVersions returns -1 if a < b, 0 if a == b and 1 if a > b.
+func CompareVersions(a, b string) (int, error) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return va.Compare(vb), nil
+}
+
+// IsMajorUpgrade returns true if the major version of to is higher than the
+// one of from, it is false if any of them is not a valid version.
+func IsMajorUpgrade(from, to string) bool {
+	vf, err := ParseVersion(from)
+	if err != nil {
+		return false
+	}
+	vt, err := ParseVersion(to)
+	if err != nil {
+		return false
+	}
+
+	return vt.Major > vf.Major
+}
+
+// Compare compares the versions by the precedence of semantic versioning, a
+// pre-release version is lower than its release version.
+func (v *Version) Compare(o *Version) int {
+	switch {
+	case v.Major != o.Major:
+		return compareInt(v.Major, o.Major)
+	case v.Minor != o.Minor:
+		return compareInt(v.Minor, o.Minor)
+	case v.Patch != o.Patch:
+		return compareInt(v.Patch, o.Patch)
+	default:
+		return comparePrerelease(v.Prerelease, o.Prerelease)
+	}
+}
+
+func (v *Version) String() string {
+	if v.Prerelease != "" {
+		return fmt.Sprintf("v%d.%d.%d-%s", v.Major, v.Minor, v.Patch, v.Prerelease)
+	}
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// comparePrerelease compares the pre-release identifiers one by one, numeric
+// identifiers are compared numerically and are lower than the others, a
+// version without pre-release is higher than the one with.
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.ParseInt(as[i], 10, 64)
+		bn, bErr := strconv.ParseInt(bs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return compareInt(an, bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+
+	return compareInt(int64(len(as)), int64(len(bs)))
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// versionOperators are the operators of a version constraint, the longer ones
+// are matched first.
+var versionOperators = []string{"<=", ">=", "!=", "<", ">", "="}
+
+// VersionConstraint is a version with a comparison operator, e.g. <v4.0.0.
+type VersionConstraint struct {
+	Op      string
+	Version *Version
+}
+
+// ParseVersionConstraint parses a version with an optional operator of <, <=,
+// >, >=, = and !=, a version without operator means =.
+func ParseVersionConstraint(constraint string) (*VersionConstraint, error) {
+	constraint = strings.TrimSpace(constraint)
+	op := "="
+	for _, o := range versionOperators {
+		if strings.HasPrefix(constraint, o) {
+			op = o
+			constraint = strings.TrimSpace(strings.TrimPrefix(constraint, o))
+			break
+		}
+	}
+
+	v, err := ParseVersion(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VersionConstraint{Op: op, Version: v}, nil
+}
+
+// Match returns true if v satisfies the constraint.
+func (c *VersionConstraint) Match(v *Version) bool {
+	n := v.Compare(c.Version)
+	switch c.Op {
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "!=":
+		return n != 0
+	default:
+		return n == 0
+	}
+}
+
+func (c *VersionConstraint) String() string {
+	return c.Op + c.Version.String()
+}
@@ -0,0 +1,157 @@
+package utils
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		version string
+		want    *Version
+	}{
+		{"v3.0.4", &Version{Major: 3, Minor: 0, Patch: 4}},
+		{"v4.0.0-rc.1", &Version{Major: 4, Prerelease: "rc.1"}},
+		{"v4.0.0-beta.2.1", &Version{Major: 4, Prerelease: "beta.2.1"}},
+		{"v10.20.30", &Version{Major: 10, Minor: 20, Patch: 30}},
+		{"3.0.4", nil},
+		{"V3.0.4", nil},
+		{"v3.0", nil},
+		{"v3.0.4.1", nil},
+		{"v3.0.x", nil},
+		{"v3.0.4-", nil},
+		{"v3.0.4-rc..1", nil},
+		{" v3.0.4", nil},
+		{"master", nil},
+		{"", nil},
+	}
+	for _, c := range cases {
+		v, err := ParseVersion(c.version)
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("ParseVersion(%q) = %v, want an error", c.version, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVersion(%q) failed, %v", c.version, err)
+			continue
+		}
+		if *v != *c.want {
+			t.Errorf("ParseVersion(%q) = %+v, want %+v", c.version, *v, *c.want)
+		}
+		if v.String() != c.version {
+			t.Errorf("ParseVersion(%q).String() = %s", c.version, v)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"v3.0.4", "v3.0.4", 0},
+		{"v3.0.4", "v3.0.5", -1},
+		{"v3.1.0", "v3.0.9", 1},
+		{"v4.0.0", "v3.9.9", 1},
+		{"v3.0.10", "v3.0.9", 1},
+		// the pre-release versions are lower than the release
+		{"v4.0.0-rc", "v4.0.0", -1},
+		{"v4.0.0", "v4.0.0-rc.1", 1},
+		{"v4.0.0-rc.1", "v3.1.0", 1},
+		// the pre-release identifiers by the precedence of semver
+		{"v4.0.0-alpha", "v4.0.0-alpha.1", -1},
+		{"v4.0.0-alpha.1", "v4.0.0-alpha.beta", -1},
+		{"v4.0.0-alpha.beta", "v4.0.0-beta", -1},
+		{"v4.0.0-beta", "v4.0.0-beta.2", -1},
+		{"v4.0.0-beta.2", "v4.0.0-beta.11", -1},
+		{"v4.0.0-beta.11", "v4.0.0-rc.1", -1},
+		{"v4.0.0-rc.1", "v4.0.0-rc.1", 0},
+	}
+	for _, c := range cases {
+		n, err := CompareVersions(c.a, c.b)
+		if err != nil {
+			t.Errorf("CompareVersions(%s, %s) failed, %v", c.a, c.b, err)
+			continue
+		}
+		if n != c.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", c.a, c.b, n, c.want)
+		}
+		if n, _ := CompareVersions(c.b, c.a); n != -c.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", c.b, c.a, n, -c.want)
+		}
+	}
+
+	for _, pair := range [][2]string{{"3.0.4", "v3.0.4"}, {"v3.0.4", "master"}, {"", ""}} {
+		if _, err := CompareVersions(pair[0], pair[1]); err == nil {
+			t.Errorf("CompareVersions(%q, %q) succeeded, want an error", pair[0], pair[1])
+		}
+	}
+}
+
+func TestIsMajorUpgrade(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{"v3.0.4", "v4.0.0", true},
+		{"v3.0.4", "v4.0.0-rc.1", true},
+		{"v2.1.17", "v3.0.4", true},
+		{"v3.0.4", "v3.1.0", false},
+		{"v3.0.4", "v3.0.8", false},
+		{"v4.0.0", "v3.0.4", false},
+		{"v4.0.0-rc", "v4.0.0", false},
+		{"3.0.4", "v4.0.0", false},
+		{"v3.0.4", "4.0.0", false},
+	}
+	for _, c := range cases {
+		if got := IsMajorUpgrade(c.from, c.to); got != c.want {
+			t.Errorf("IsMajorUpgrade(%s, %s) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"v3.0.4", "v3.0.4", true},
+		{"v3.0.4", "v3.0.5", false},
+		{"=v3.0.4", "v3.0.4", true},
+		{"!=v3.0.4", "v3.0.4", false},
+		{"!=v3.0.4", "v3.0.5", true},
+		{"<v4.0.0", "v3.9.9", true},
+		{"<v4.0.0", "v4.0.0", false},
+		{"<v4.0.0", "v4.0.0-rc.1", true},
+		{"<=v4.0.0", "v4.0.0", true},
+		{">v3.0.4", "v3.0.4", false},
+		{">v3.0.4", "v3.0.5", true},
+		{">=v3.0.4", "v3.0.4", true},
+		{">=v4.0.0", "v4.0.0-rc.1", false},
+		// the spaces around the operator and the version are trimmed
+		{" >= v3.0.4 ", "v3.1.0", true},
+	}
+	for _, c := range cases {
+		vc, err := ParseVersionConstraint(c.constraint)
+		if err != nil {
+			t.Errorf("ParseVersionConstraint(%q) failed, %v", c.constraint, err)
+			continue
+		}
+		v, err := ParseVersion(c.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := vc.Match(v); got != c.want {
+			t.Errorf("%q.Match(%s) = %v, want %v", c.constraint, c.version, got, c.want)
+		}
+	}
+
+	if vc, _ := ParseVersionConstraint("v3.0.4"); vc.String() != "=v3.0.4" {
+		t.Errorf("String() of v3.0.4 = %s, want =v3.0.4", vc)
+	}
+	for _, constraint := range []string{"", "<", "<=3.0.4", "=>v3.0.4", "~v3.0.4", "<v3.0", "master"} {
+		if _, err := ParseVersionConstraint(constraint); err == nil {
+			t.Errorf("ParseVersionConstraint(%q) succeeded, want an error", constraint)
+		}
+	}
+}
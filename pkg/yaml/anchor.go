@@ -0,0 +1,265 @@
+package yaml
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// The anchors of the documents are kept by Merge, DeleteMulti, RenameMulti and
+// ThreeWayMerge unless the ExpandAnchors of their options is set, which expands
+// the aliases and the merge keys (<<) so the outputs have no anchors.
+//
+// With the anchors kept, a change to a path of the anchored node changes every
+// alias of it, like editing a shared block, while a change to a path through
+// an alias or a merge key only changes that path, the shared node is copied
+// there first. An alias left before its anchor or without it by a change is
+// replaced by a copy of the node, so the outputs are always valid. Diff always
+// compares the expanded values.
+
+const mergeKeyTag = "!!merge"
+
+// resolveAlias returns the node an alias refers to, or node itself.
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// unaliased returns a copy of the node an alias refers to, or node itself if
+// it is not an alias, so node can be changed without changing the others
+// sharing it.
+func unaliased(node *yaml.Node) *yaml.Node {
+	if node == nil || node.Kind != yaml.AliasNode {
+		return node
+	}
+	return copyNode(resolveAlias(node))
+}
+
+// copyNode returns a deep copy of node without anchors, the aliases in it
+// still refer to the origin nodes.
+func copyNode(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+
+	c := *node
+	c.Anchor = ""
+	if node.Kind == yaml.AliasNode {
+		return &c
+	}
+	c.Content = make([]*yaml.Node, 0, len(node.Content))
+	for _, child := range node.Content {
+		c.Content = append(c.Content, copyNode(child))
+	}
+	return &c
+}
+
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.Value == "<<" &&
+		(key.Tag == mergeKeyTag || (key.Tag == "" && key.Style == 0))
+}
+
+func hasMergeKeys(node *yaml.Node) bool {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if isMergeKey(node.Content[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedMaps returns the maps merged by the merge key value, the first one
+// takes precedence.
+func mergedMaps(value *yaml.Node) []*yaml.Node {
+	value = resolveAlias(value)
+	if value == nil {
+		return nil
+	}
+
+	switch value.Kind {
+	case yaml.MappingNode:
+		return []*yaml.Node{value}
+	case yaml.SequenceNode:
+		maps := make([]*yaml.Node, 0, len(value.Content))
+		for _, item := range value.Content {
+			if m := resolveAlias(item); m != nil && m.Kind == yaml.MappingNode {
+				maps = append(maps, m)
+			}
+		}
+		return maps
+	}
+
+	return nil
+}
+
+// mapEntries returns the keys and values of a map in pairs, the keys of its
+// merge keys included. An explicit key takes precedence over a merged one.
+func mapEntries(node *yaml.Node) []*yaml.Node {
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if !isMergeKey(node.Content[i]) {
+			seen[node.Content[i].Value] = true
+		}
+	}
+
+	entries := make([]*yaml.Node, 0, len(node.Content))
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if !isMergeKey(key) {
+			entries = append(entries, key, value)
+			continue
+		}
+
+		for _, m := range mergedMaps(value) {
+			merged := mapEntries(m)
+			for j := 0; j+1 < len(merged); j += 2 {
+				if seen[merged[j].Value] {
+					continue
+				}
+				seen[merged[j].Value] = true
+				entries = append(entries, merged[j], merged[j+1])
+			}
+		}
+	}
+
+	return entries
+}
+
+// lookupKey returns the key node and the value node of key in a map, the
+// merge keys are looked up if the key is not set explicitly.
+func lookupKey(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	if idx := mappingIndex(node, key); idx >= 0 {
+		return node.Content[idx], node.Content[idx+1]
+	}
+
+	if !hasMergeKeys(node) {
+		return nil, nil
+	}
+
+	entries := mapEntries(node)
+	for i := 0; i+1 < len(entries); i += 2 {
+		if entries[i].Value == key {
+			return entries[i], entries[i+1]
+		}
+	}
+
+	return nil, nil
+}
+
+// inlineMergeKeys replaces the merge keys of a map with copies of the keys
+// they merge.
+func inlineMergeKeys(node *yaml.Node) {
+	if !hasMergeKeys(node) {
+		return
+	}
+
+	explicit := make(map[*yaml.Node]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		explicit[node.Content[i]] = true
+	}
+
+	entries := mapEntries(node)
+	content := make([]*yaml.Node, 0, len(entries))
+	for i := 0; i+1 < len(entries); i += 2 {
+		if explicit[entries[i]] {
+			content = append(content, entries[i], entries[i+1])
+			continue
+		}
+		content = append(content, copyNode(entries[i]), copyNode(entries[i+1]))
+	}
+	node.Content = content
+}
+
+// writableIndex is like mappingIndex, but a key only set by a merge key is
+// set explicitly and a value which is an alias is copied, so the value can
+// be changed without changing the others sharing it.
+func writableIndex(node *yaml.Node, key string) int {
+	idx := mappingIndex(node, key)
+	if idx < 0 && hasMergeKeys(node) {
+		if k, _ := lookupKey(node, key); k != nil {
+			inlineMergeKeys(node)
+			idx = mappingIndex(node, key)
+		}
+	}
+
+	if idx >= 0 {
+		node.Content[idx+1] = unaliased(node.Content[idx+1])
+	}
+	return idx
+}
+
+// expandNode replaces the aliases in node with copies of the nodes they refer
+// to and the merge keys with the keys they merge, the anchors are removed.
+func expandNode(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+
+	if node.Kind == yaml.AliasNode {
+		return expandNode(copyNode(resolveAlias(node)))
+	}
+
+	inlineMergeKeys(node)
+	for i, child := range node.Content {
+		node.Content[i] = expandNode(child)
+	}
+	node.Anchor = ""
+	return node
+}
+
+// fixAliases makes the aliases of a changed document valid, an alias must
+// follow the anchor it refers to and an anchor name must refer to one node.
+// An alias without its anchor before it is replaced by a copy of the node,
+// and the anchors of different nodes with the same name are renamed.
+func fixAliases(node *yaml.Node) {
+	anchors := make(map[string]*yaml.Node)
+
+	var walk func(n *yaml.Node) *yaml.Node
+	walk = func(n *yaml.Node) *yaml.Node {
+		if n == nil {
+			return nil
+		}
+
+		if n.Kind == yaml.AliasNode {
+			if target := n.Alias; target != nil && target.Anchor != "" && anchors[target.Anchor] == target {
+				n.Value = target.Anchor
+				return n
+			}
+			return walk(copyNode(resolveAlias(n)))
+		}
+
+		if n.Anchor != "" {
+			if other, ok := anchors[n.Anchor]; ok && other != n {
+				name := n.Anchor
+				for i := 2; ; i++ {
+					n.Anchor = fmt.Sprintf("%s_%d", name, i)
+					if _, ok := anchors[n.Anchor]; !ok {
+						break
+					}
+				}
+			}
+			anchors[n.Anchor] = n
+		}
+
+		// the merge keys are encoded as !!merge << by yaml.v3 if tagged
+		if isMergeKey(n) {
+			n.Tag = ""
+		}
+
+		for i, child := range n.Content {
+			n.Content[i] = walk(child)
+		}
+		return n
+	}
+
+	walk(node)
+}
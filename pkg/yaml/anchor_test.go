@@ -0,0 +1,234 @@
+package yaml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const anchoredConfig = `base: &base
+  block-size: 64KB
+  compression: lz4
+defaultcf:
+  <<: *base
+  block-cache-size: 1GB
+writecf: *base
+`
+
+// writeFiles writes the contents to the files of the names in a temporary
+// directory, it returns the directory and the files.
+func writeFiles(t *testing.T, contents map[string]string) (string, map[string]string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tim-yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string, len(contents))
+	for name, content := range contents {
+		files[name] = filepath.Join(dir, name)
+		if err := ioutil.WriteFile(files[name], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, files
+}
+
+// decoded returns the values of the yaml output with the aliases resolved.
+func decoded(t *testing.T, output string) map[string]interface{} {
+	t.Helper()
+	m := make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte(output), &m); err != nil {
+		t.Fatalf("invalid output, %v:\n%s", err, output)
+	}
+	return m
+}
+
+func valueOf(m map[string]interface{}, path ...string) interface{} {
+	var v interface{} = m
+	for _, key := range path {
+		mm, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = mm[key]
+	}
+	return v
+}
+
+func hasAnchors(output string) bool {
+	return strings.Contains(output, "&base") || strings.Contains(output, "*base")
+}
+
+func TestDeleteAnchors(t *testing.T) {
+	dir, files := writeFiles(t, map[string]string{"tikv.yml": anchoredConfig})
+	defer os.RemoveAll(dir)
+
+	// a path of the anchored node changes every alias of it
+	out, err := DeleteMulti(files["tikv.yml"], []string{"base.compression"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasAnchors(out) {
+		t.Errorf("anchors lost:\n%s", out)
+	}
+	m := decoded(t, out)
+	for _, cf := range []string{"base", "defaultcf", "writecf"} {
+		if v := valueOf(m, cf, "compression"); v != nil {
+			t.Errorf("%s.compression = %v, want it deleted:\n%s", cf, v, out)
+		}
+	}
+
+	// a path through an alias only changes that path
+	out, err = DeleteMulti(files["tikv.yml"], []string{"writecf.block-size"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = decoded(t, out)
+	if v := valueOf(m, "writecf", "block-size"); v != nil {
+		t.Errorf("writecf.block-size = %v, want it deleted:\n%s", v, out)
+	}
+	if v := valueOf(m, "base", "block-size"); v != "64KB" {
+		t.Errorf("base.block-size = %v, want 64KB:\n%s", v, out)
+	}
+	if v := valueOf(m, "defaultcf", "block-size"); v != "64KB" {
+		t.Errorf("defaultcf.block-size = %v, want 64KB:\n%s", v, out)
+	}
+
+	out, err = DeleteMultiWithOptions(files["tikv.yml"], []string{"base.compression"}, &DeleteOptions{ExpandAnchors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasAnchors(out) || strings.Contains(out, "<<") {
+		t.Errorf("anchors not expanded:\n%s", out)
+	}
+	m = decoded(t, out)
+	if v := valueOf(m, "writecf", "compression"); v != "lz4" {
+		t.Errorf("writecf.compression = %v, want lz4 of the expanded copy:\n%s", v, out)
+	}
+}
+
+func TestMergeAnchors(t *testing.T) {
+	dir, files := writeFiles(t, map[string]string{
+		"tikv.yml": anchoredConfig,
+		"new.yml":  "base:\n  block-size: 32KB\nwritecf:\n  compression: zstd\n",
+	})
+	defer os.RemoveAll(dir)
+
+	for _, expand := range []bool{false, true} {
+		out, err := MergeWithOptions(files["tikv.yml"], &MergeOptions{
+			Deep:            true,
+			OverwriteArrays: true,
+			ExpandAnchors:   expand,
+		}, files["new.yml"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasAnchors(out) == expand {
+			t.Errorf("expand %v, output:\n%s", expand, out)
+		}
+
+		m := decoded(t, out)
+		want := map[string]interface{}{
+			"base":      map[string]interface{}{"block-size": "32KB", "compression": "lz4"},
+			"writecf":   map[string]interface{}{"block-size": "32KB", "compression": "zstd"},
+			"defaultcf": map[string]interface{}{"block-size": "32KB", "compression": "lz4", "block-cache-size": "1GB"},
+		}
+		if expand {
+			// the expanded copies do not share the changes of base
+			want["writecf"] = map[string]interface{}{"block-size": "64KB", "compression": "zstd"}
+			want["defaultcf"] = map[string]interface{}{"block-size": "64KB", "compression": "lz4", "block-cache-size": "1GB"}
+		}
+		if !reflect.DeepEqual(m, want) {
+			t.Errorf("expand %v, merged %v, want %v:\n%s", expand, m, want, out)
+		}
+	}
+}
+
+func TestRenameAnchors(t *testing.T) {
+	dir, files := writeFiles(t, map[string]string{"tikv.yml": anchoredConfig})
+	defer os.RemoveAll(dir)
+
+	out, err := RenameMulti(files["tikv.yml"], []RenamePath{{From: "writecf.block-size", To: "writecf.size"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "&base") {
+		t.Errorf("anchor lost:\n%s", out)
+	}
+	m := decoded(t, out)
+	if v := valueOf(m, "writecf", "size"); v != "64KB" {
+		t.Errorf("writecf.size = %v, want 64KB:\n%s", v, out)
+	}
+	if v := valueOf(m, "base", "block-size"); v != "64KB" {
+		t.Errorf("base.block-size = %v, want 64KB:\n%s", v, out)
+	}
+
+	out, err = RenameMultiWithOptions(files["tikv.yml"], []RenamePath{{From: "base", To: "shared"}}, &RenameOptions{ExpandAnchors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasAnchors(out) {
+		t.Errorf("anchors not expanded:\n%s", out)
+	}
+	m = decoded(t, out)
+	if v := valueOf(m, "writecf", "compression"); v != "lz4" {
+		t.Errorf("writecf.compression = %v, want lz4:\n%s", v, out)
+	}
+}
+
+func TestThreeWayMergeAnchors(t *testing.T) {
+	dir, files := writeFiles(t, map[string]string{
+		"base.yml":   "base:\n  block-size: 64KB\n  compression: lz4\n",
+		"ours.yml":   anchoredConfig,
+		"theirs.yml": "base:\n  block-size: 64KB\n  compression: zstd\n",
+	})
+	defer os.RemoveAll(dir)
+
+	for _, expand := range []bool{false, true} {
+		out, err := ThreeWayMergeWithOptions(files["base.yml"], files["ours.yml"], files["theirs.yml"],
+			&ThreeWayMergeOptions{ExpandAnchors: expand})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expand && hasAnchors(out) {
+			t.Errorf("anchors not expanded:\n%s", out)
+		}
+		m := decoded(t, out)
+		if v := valueOf(m, "base", "compression"); v != "zstd" {
+			t.Errorf("expand %v, base.compression = %v, want zstd:\n%s", expand, v, out)
+		}
+		if v := valueOf(m, "defaultcf", "block-cache-size"); v != "1GB" {
+			t.Errorf("expand %v, defaultcf.block-cache-size = %v, want 1GB:\n%s", expand, v, out)
+		}
+	}
+}
+
+func TestDiffAnchors(t *testing.T) {
+	expanded := `base:
+  block-size: 64KB
+  compression: lz4
+defaultcf:
+  block-size: 64KB
+  compression: lz4
+  block-cache-size: 1GB
+writecf:
+  block-size: 64KB
+  compression: lz4
+`
+	dir, files := writeFiles(t, map[string]string{"anchored.yml": anchoredConfig, "expanded.yml": expanded})
+	defer os.RemoveAll(dir)
+
+	// the expanded values are compared
+	entries, err := DiffStructured(files["anchored.yml"], files["expanded.yml"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("diff of the anchored and the expanded config = %v, want none", entries)
+	}
+}
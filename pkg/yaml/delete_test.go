@@ -0,0 +1,94 @@
+package yaml
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const deleteConfig = `a:
+  b:
+    c: 1 # the c
+    d: 2
+  e: 3
+list:
+  - x
+  - y
+  - z
+servers:
+  - key: k0
+    name: s0
+  - key: k1
+    name: s1
+`
+
+func TestDeleteMulti(t *testing.T) {
+	dir, files := writeFiles(t, map[string]string{"tikv.yml": deleteConfig})
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		path string
+		// change changes the origin values to the ones after the delete, nil
+		// if the path is not found
+		change func(m map[string]interface{})
+	}{
+		{"a.b.c", func(m map[string]interface{}) {
+			delete(valueOf(m, "a", "b").(map[string]interface{}), "c")
+		}},
+		{"a.b", func(m map[string]interface{}) {
+			delete(valueOf(m, "a").(map[string]interface{}), "b")
+		}},
+		{"list[1]", func(m map[string]interface{}) {
+			m["list"] = []interface{}{"x", "z"}
+		}},
+		{"servers[0].key", func(m map[string]interface{}) {
+			delete(valueOf(m, "servers").([]interface{})[0].(map[string]interface{}), "key")
+		}},
+		{"list[3]", nil},
+		{"servers[2].key", nil},
+		{"a.b.f", nil},
+		{"a.x.c", nil},
+		{"raftstore.sync-log", nil},
+	}
+
+	for _, c := range cases {
+		out, err := DeleteMulti(files["tikv.yml"], []string{c.path})
+		if err != nil {
+			t.Errorf("delete %s: %v", c.path, err)
+			continue
+		}
+
+		want := decoded(t, deleteConfig)
+		if c.change != nil {
+			c.change(want)
+		}
+		if got := decoded(t, out); !reflect.DeepEqual(got, want) {
+			t.Errorf("delete %s: %v, want %v:\n%s", c.path, got, want, out)
+		}
+		if c.path != "a.b.c" && c.path != "a.b" && !strings.Contains(out, "c: 1 # the c") {
+			t.Errorf("delete %s: the comment of a.b.c is lost:\n%s", c.path, out)
+		}
+
+		missing, err := MissingPaths(files["tikv.yml"], []string{c.path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(missing) > 0) != (c.change == nil) {
+			t.Errorf("missing paths of %s: %v", c.path, missing)
+		}
+	}
+
+	// the paths are deleted in order, the ones not found are skipped
+	out, err := DeleteMulti(files["tikv.yml"], []string{"list[0]", "list[5]", "a.e", "", "servers[1].name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decoded(t, deleteConfig)
+	want["list"] = []interface{}{"y", "z"}
+	delete(want["a"].(map[string]interface{}), "e")
+	delete(want["servers"].([]interface{})[1].(map[string]interface{}), "name")
+	if got := decoded(t, out); !reflect.DeepEqual(got, want) {
+		t.Errorf("delete multi: %v, want %v:\n%s", got, want, out)
+	}
+}
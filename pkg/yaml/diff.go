@@ -1,35 +1,85 @@
 package yaml
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 
-	"github.com/kylelemons/godebug/pretty"
 	"github.com/logrusorgru/aurora"
+	"github.com/tidbops/tim/pkg/metrics"
 	"gopkg.in/yaml.v2"
 )
 
+// DiffKind is the kind of a change between two yaml files.
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+var (
+	diffsTotal = metrics.NewCounterVec("tim_config_diffs_total",
+		"The config diffs computed.")
+	diffChangesTotal = metrics.NewCounterVec("tim_config_diff_changes_total",
+		"The changed keys found by the config diffs, by kind added / removed / changed.", "kind")
+)
+
+// DiffEntry is a changed key, Old is nil for an added key and New is nil for a
+// removed key.
+type DiffEntry struct {
+	Path string      `json:"path"`
+	Kind DiffKind    `json:"kind"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// Diff returns the changes from file1 to file2 as text, a removed value is
+// prefixed with "-" and an added value with "+".
 func Diff(file1, file2 string, color bool) (string, error) {
 	formatter := newFormatter(color)
 
-	if err := stat(file1, file2); err != nil {
+	entries, err := DiffStructured(file1, file2)
+	if err != nil {
 		return "", err
 	}
 
+	diff := computeDiff(formatter, entries)
+
+	return diff, nil
+}
+
+// DiffStructured returns the changes from file1 to file2 sorted by path. Maps
+// are compared key by key, other values including sequences are compared as a
+// whole, so a reordered sequence is a changed value.
+func DiffStructured(file1, file2 string) ([]DiffEntry, error) {
+	if err := stat(file1, file2); err != nil {
+		return nil, err
+	}
+
 	yaml1, err := unmarshal(file1)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	yaml2, err := unmarshal(file2)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	diff := computeDiff(formatter, yaml1, yaml2)
+	entries := make([]DiffEntry, 0)
+	diffValue("", normalizeValue(yaml1), normalizeValue(yaml2), &entries)
 
-	return diff, nil
+	diffsTotal.Inc()
+	for _, e := range entries {
+		diffChangesTotal.Inc(string(e.Kind))
+	}
+
+	return entries, nil
 }
 
 func stat(filenames ...string) error {
@@ -64,19 +114,90 @@ func unmarshal(filename string) (interface{}, error) {
 	return ret, nil
 }
 
-func computeDiff(formatter aurora.Aurora, a interface{}, b interface{}) string {
+func diffValue(path string, a, b interface{}, entries *[]DiffEntry) {
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := make([]string, 0, len(am)+len(bm))
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			childPath := joinPath(path, k)
+			av, aok := am[k]
+			bv, bok := bm[k]
+			switch {
+			case !aok:
+				*entries = append(*entries, DiffEntry{Path: childPath, Kind: DiffAdded, New: bv})
+			case !bok:
+				*entries = append(*entries, DiffEntry{Path: childPath, Kind: DiffRemoved, Old: av})
+			default:
+				diffValue(childPath, av, bv, entries)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*entries = append(*entries, DiffEntry{Path: path, Kind: DiffChanged, Old: a, New: b})
+	}
+}
+
+// normalizeValue converts the maps decoded by yaml to map[string]interface{},
+// so the values can be encoded as json.
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprintf("%v", k)] = normalizeValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			s = append(s, normalizeValue(item))
+		}
+		return s
+	}
+	return value
+}
+
+func computeDiff(formatter aurora.Aurora, entries []DiffEntry) string {
 	diffs := make([]string, 0)
-	for _, s := range strings.Split(pretty.Compare(a, b), "\n") {
-		switch {
-		case strings.HasPrefix(s, "+"):
-			diffs = append(diffs, formatter.Bold(formatter.Green(s)).String())
-		case strings.HasPrefix(s, "-"):
+	for _, e := range entries {
+		if e.Kind != DiffAdded {
+			s := fmt.Sprintf("-%s: %s", e.Path, formatValue(e.Old))
 			diffs = append(diffs, formatter.Bold(formatter.Red(s)).String())
 		}
+		if e.Kind != DiffRemoved {
+			s := fmt.Sprintf("+%s: %s", e.Path, formatValue(e.New))
+			diffs = append(diffs, formatter.Bold(formatter.Green(s)).String())
+		}
 	}
 	return strings.Join(diffs, "\n")
 }
 
+func formatValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(value)
+		if err == nil {
+			return string(data)
+		}
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
 func newFormatter(color bool) aurora.Aurora {
 	if color {
 		return aurora.NewAurora(true)
@@ -1,172 +1,240 @@
 package yaml
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
-	"fmt"
-	"io"
-	"os"
-	"reflect"
 
 	"github.com/ngaut/log"
-	"github.com/tidbops/mergo"
-	yaml "gopkg.in/mikefarah/yaml.v2"
+	yaml "gopkg.in/yaml.v3"
 )
 
-func Merge(overwrite bool, append bool, input string, filesToMerge ...string) (string, error) {
+// MergeOptions tells how Merge merges the files into the input.
+type MergeOptions struct {
+	// Deep merges the maps key by key recursively, otherwise the top level
+	// keys of the merged files replace the values of input wholesale.
+	Deep bool
+	// OverwriteArrays merges a sequence as a single value like a scalar, it
+	// replaces the sequence of input unless PreferLeft keeps it. Otherwise the
+	// items of the sequences of the merged files are appended, both in a deep
+	// and a shallow merge.
+	OverwriteArrays bool
+	// PreferLeft keeps the values of input, only the missing and null ones and
+	// the empty maps and sequences are set. Otherwise the values of the merged
+	// files which are not empty replace the ones of input.
+	PreferLeft bool
+	// ArrayMergeKey merges the sequences of maps by the value of the key of
+	// the maps instead of by OverwriteArrays, e.g. name, the maps of the same
+	// key are merged deeply and the others in either sequence are kept, the new
+	// ones appended. The sequences with an item which is not a map of the key
+	// are merged by OverwriteArrays.
+	ArrayMergeKey string
+	// ExpandAnchors expands the aliases and the merge keys of input and the
+	// merged files, otherwise the anchors are kept.
+	ExpandAnchors bool
+}
+
+// defaultMergeOptions is a deep merge where the values of the merged files win,
+// the sequences included.
+var defaultMergeOptions = &MergeOptions{Deep: true, OverwriteArrays: true}
+
+// Merge is MergeWithOptions of a deep merge, overwrite is the opposite of
+// PreferLeft and appendSlice of OverwriteArrays.
+func Merge(overwrite bool, appendSlice bool, input string, filesToMerge ...string) (string, error) {
+	return MergeWithOptions(input, &MergeOptions{
+		Deep:            true,
+		OverwriteArrays: !appendSlice,
+		PreferLeft:      !overwrite,
+	}, filesToMerge...)
+}
+
+// MergeWithOptions merges filesToMerge into the first document of input in
+// order by opts, nil opts is a deep merge where the values of the merged files
+// replace the ones of input, the sequences included. The comments of input and
+// the merged files are kept, and the anchors unless opts.ExpandAnchors is set.
+func MergeWithOptions(input string, opts *MergeOptions, filesToMerge ...string) (string, error) {
+	if opts == nil {
+		opts = defaultMergeOptions
+	}
 	docIndexIntn := 0
 
 	if input == "" {
 		return "", errors.New("must provide filename")
 	}
 
-	var stream io.Reader
-	if input == "-" {
-		stream = bufio.NewReader(os.Stdin)
-	} else {
-		file, err := os.Open(input) // nolint gosec
+	srcs := make([]*yaml.Node, 0, len(filesToMerge))
+	for _, f := range filesToMerge {
+		node, err := readNode(f, opts.ExpandAnchors)
 		if err != nil {
 			return "", err
 		}
-		defer safelyCloseFile(file)
-		stream = file
+		if node == nil {
+			continue
+		}
+		srcs = append(srcs, node)
+	}
+
+	stream, closeFn, err := openStream(input)
+	if err != nil {
+		return "", err
 	}
+	defer closeFn()
 
-	var updateData = func(dataBucket interface{}, currentIndex int) (interface{}, error) {
+	var updateData = func(node *yaml.Node, currentIndex int) error {
 		log.Debugf("Merging doc %v", currentIndex)
 		if currentIndex == docIndexIntn {
-			var mergedData map[interface{}]interface{}
-			// merge only works for maps, so put everything in a temporary
-			// map
-			var mapDataBucket = make(map[interface{}]interface{})
-			mapDataBucket["root"] = dataBucket
-			if err := merge(&mergedData, mapDataBucket, overwrite, append); err != nil {
-				return nil, err
+			for _, src := range srcs {
+				mergeDocument(node, src, opts)
 			}
-
-			for _, f := range filesToMerge {
-				var fileToMerge interface{}
-				if err := readData(f, 0, &fileToMerge); err != nil {
-					if err == io.EOF {
-						continue
-					}
-					return nil, err
-				}
-				mapDataBucket["root"] = fileToMerge
-				if err := merge(&mergedData, mapDataBucket, overwrite, append); err != nil {
-					return nil, err
-				}
-			}
-			return mergedData["root"], nil
 		}
-		return dataBucket, nil
+		return nil
 	}
-	yaml.DefaultMapType = reflect.TypeOf(map[interface{}]interface{}{})
-
-	defer func() {
-		yaml.DefaultMapType = reflect.TypeOf(yaml.MapSlice{})
-	}()
 
-	return readAndUpdate(stream, updateData)
+	return readAndUpdate(stream, opts.ExpandAnchors, updateData)
 }
 
-type updateDataFn func(dataBucket interface{}, currentIndex int) (interface{}, error)
-
-func readAndUpdate(reader io.Reader, updateData updateDataFn) (string, error) {
-	buf := bytes.NewBuffer(make([]byte, 0))
-	writer := bufio.NewWriter(buf)
-	encoder := yaml.NewEncoder(writer)
-
-	yamDecoder := mapYamlDecoder(updateData, encoder)
-	if err := yamDecoder(yaml.NewDecoder(reader)); err != nil {
-		return "", err
+func mergeDocument(dst, src *yaml.Node, opts *MergeOptions) {
+	srcRoot := contentNode(src)
+	if srcRoot == nil {
+		return
 	}
 
-	if err := writer.Flush(); err != nil {
-		return "", err
+	dstRoot := contentNode(dst)
+	if dstRoot == nil {
+		dst.Kind = yaml.DocumentNode
+		dst.Content = []*yaml.Node{srcRoot}
+		return
 	}
 
-	return buf.String(), nil
+	mergeNode(dstRoot, srcRoot, opts)
 }
 
-func mapYamlDecoder(updateData updateDataFn, encoder *yaml.Encoder) yamlDecoderFn {
-	return func(decoder *yaml.Decoder) error {
-		var (
-			dataBucket   interface{}
-			currentIndex = 0
-			err          error
-		)
-
-		for {
-			log.Debugf("Read doc %v", currentIndex)
-			err = decoder.Decode(&dataBucket)
-
-			if err == io.EOF {
-				return nil
-			} else if err != nil {
-				return fmt.Errorf("faied to read document at index %v, %v", currentIndex, err)
+// mergeNode merges src into dst, the values of a mapping dst are merged by the
+// key, the nested maps only in a deep merge.
+func mergeNode(dst, src *yaml.Node, opts *MergeOptions) {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		if hasMergeKeys(src) {
+			src = copyNode(src)
+			inlineMergeKeys(src)
+		}
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			if value.Kind == yaml.AliasNode {
+				value = copyNode(resolveAlias(value))
 			}
 
-			dataBucket, err = updateData(dataBucket, currentIndex)
-			if err != nil {
-				return fmt.Errorf("failed to update document at index %v, %v", currentIndex, err)
+			// the keys of the merge keys of dst are merged too
+			_, dstValue := lookupKey(dst, key.Value)
+			if dstValue == nil {
+				dst.Content = append(dst.Content, key, value)
+				continue
 			}
 
-			err = encoder.Encode(dataBucket)
-
-			if err != nil {
-				return fmt.Errorf("failed to write document at index %v, %v", currentIndex, err)
+			// a change through a merge key or an alias only changes dst, the
+			// shared node is kept if nothing changes
+			current := resolveAlias(dstValue)
+			switch {
+			case (current.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode && opts.Deep) ||
+				(current.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode &&
+					(!opts.OverwriteArrays || keyedSequences(current, value, opts.ArrayMergeKey))):
+				if idx := mappingIndex(dst, key.Value); idx >= 0 && dstValue == current {
+					mergeNode(current, value, opts)
+					continue
+				}
+				changed := copyNode(current)
+				mergeNode(changed, value, opts)
+				if !nodeEqual(changed, current) {
+					idx := writableIndex(dst, key.Value)
+					dst.Content[idx+1] = changed
+				}
+			case (!opts.PreferLeft && !isEmptyNode(value)) || isEmptyNode(current):
+				idx := writableIndex(dst, key.Value)
+				dst.Content[idx+1] = replaceNode(dst.Content[idx+1], value)
 			}
-			currentIndex = currentIndex + 1
 		}
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && keyedSequences(dst, src, opts.ArrayMergeKey):
+		mergeSequenceByKey(dst, src, opts)
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && !opts.OverwriteArrays:
+		dst.Content = append(dst.Content, src.Content...)
 	}
 }
 
-type yamlDecoderFn func(*yaml.Decoder) error
-
-func safelyCloseFile(file *os.File) {
-	err := file.Close()
-	if err != nil {
-		log.Error(err.Error())
+// keyedSequences returns whether every item of the sequences a and b is a map
+// with a scalar value of key.
+func keyedSequences(a, b *yaml.Node, key string) bool {
+	if key == "" {
+		return false
 	}
+	for _, seq := range []*yaml.Node{a, b} {
+		for _, item := range seq.Content {
+			if _, ok := itemKey(item, key); !ok {
+				return false
+			}
+		}
+	}
+	return true
 }
 
-func merge(dst interface{}, src interface{}, overwrite bool, append bool) error {
-	if overwrite {
-		return mergo.Merge(dst, src, mergo.WithOverride)
-	} else if append {
-		return mergo.Merge(dst, src, mergo.WithAppendSlice)
+// itemKey returns the scalar value of key of the map item.
+func itemKey(item *yaml.Node, key string) (string, bool) {
+	item = resolveAlias(item)
+	if item.Kind != yaml.MappingNode {
+		return "", false
+	}
+	_, value := lookupKey(item, key)
+	if value == nil {
+		return "", false
+	}
+	value = resolveAlias(value)
+	if value.Kind != yaml.ScalarNode {
+		return "", false
 	}
-	return mergo.Merge(dst, src)
+	return value.Value, true
 }
 
-func readData(filename string, indexToRead int, parsedData interface{}) error {
-	return readStream(filename, func(decoder *yaml.Decoder) error {
-		for currentIndex := 0; currentIndex < indexToRead; currentIndex++ {
-			if err := decoder.Decode(parsedData); err != nil {
-				return fmt.Errorf("failed to process document at index %v, %v", currentIndex, err)
+// mergeSequenceByKey deeply merges the maps of src into the maps of dst with
+// the same value of the ArrayMergeKey of opts, the maps of src with a new value
+// are appended in order.
+func mergeSequenceByKey(dst, src *yaml.Node, opts *MergeOptions) {
+	itemOpts := *opts
+	itemOpts.Deep = true
+
+	for _, item := range src.Content {
+		k, _ := itemKey(item, opts.ArrayMergeKey)
+		idx := -1
+		for i, d := range dst.Content {
+			if dk, _ := itemKey(d, opts.ArrayMergeKey); dk == k {
+				idx = i
+				break
 			}
 		}
-		return decoder.Decode(parsedData)
-	})
-}
+		if item.Kind == yaml.AliasNode {
+			item = copyNode(resolveAlias(item))
+		}
+		if idx < 0 {
+			dst.Content = append(dst.Content, item)
+			continue
+		}
 
-func readStream(filename string, yamlDecoder yamlDecoderFn) error {
-	if filename == "" {
-		return errors.New("must provide filename")
+		// an aliased item is copied, the anchored map is not changed
+		if dst.Content[idx].Kind == yaml.AliasNode {
+			dst.Content[idx] = copyNode(resolveAlias(dst.Content[idx]))
+		}
+		mergeNode(dst.Content[idx], item, &itemOpts)
 	}
+}
 
-	var stream io.Reader
-	if filename == "-" {
-		stream = bufio.NewReader(os.Stdin)
-	} else {
-		file, err := os.Open(filename) // nolint gosec
-		if err != nil {
-			return err
-		}
-		defer safelyCloseFile(file)
-		stream = file
+// replaceNode returns src to replace dst, the comments of dst are kept if
+// src has none.
+func replaceNode(dst, src *yaml.Node) *yaml.Node {
+	node := *src
+	if node.HeadComment == "" {
+		node.HeadComment = dst.HeadComment
+	}
+	if node.LineComment == "" {
+		node.LineComment = dst.LineComment
+	}
+	if node.FootComment == "" {
+		node.FootComment = dst.FootComment
 	}
-	return yamlDecoder(yaml.NewDecoder(stream))
+	return &node
 }
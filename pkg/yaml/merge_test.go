@@ -0,0 +1,222 @@
+package yaml
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const columnFamilies = `rocksdb:
+  max-open-files: 40960
+  column-families:
+    - name: default
+      block-size: 64KB
+      compression: lz4
+    - name: write
+      block-size: 64KB
+    - name: lock
+      block-size: 16KB
+`
+
+// cf is an item of the column families decoded.
+type cf map[string]interface{}
+
+func columnFamiliesOf(t *testing.T, output string) []cf {
+	t.Helper()
+	items, ok := valueOf(decoded(t, output), "rocksdb", "column-families").([]interface{})
+	if !ok {
+		t.Fatalf("no column families:\n%s", output)
+	}
+	cfs := make([]cf, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			cfs = append(cfs, cf{"item": item})
+			continue
+		}
+		cfs = append(cfs, cf(m))
+	}
+	return cfs
+}
+
+func TestMergeArraysByKey(t *testing.T) {
+	cases := []struct {
+		name      string
+		merge     string
+		overwrite bool
+		want      []cf
+	}{
+		{
+			// the items are merged by name, in the order of input
+			name: "reordered",
+			merge: `rocksdb:
+  column-families:
+    - name: lock
+      block-size: 32KB
+    - name: write
+      block-cache-size: 1GB
+    - name: default
+      compression: zstd
+`,
+			overwrite: true,
+			want: []cf{
+				{"name": "default", "block-size": "64KB", "compression": "zstd"},
+				{"name": "write", "block-size": "64KB", "block-cache-size": "1GB"},
+				{"name": "lock", "block-size": "32KB"},
+			},
+		},
+		{
+			// the items only in input are kept, the new ones appended
+			name: "partly overlapping",
+			merge: `rocksdb:
+  column-families:
+    - name: raft
+      block-size: 16KB
+    - name: default
+      block-size: 32KB
+    - name: ver
+`,
+			overwrite: true,
+			want: []cf{
+				{"name": "default", "block-size": "32KB", "compression": "lz4"},
+				{"name": "write", "block-size": "64KB"},
+				{"name": "lock", "block-size": "16KB"},
+				{"name": "raft", "block-size": "16KB"},
+				{"name": "ver"},
+			},
+		},
+		{
+			// an item without the key replaces the sequence by OverwriteArrays
+			name: "no key overwrite",
+			merge: `rocksdb:
+  column-families:
+    - name: default
+      block-size: 32KB
+    - block-size: 8KB
+`,
+			overwrite: true,
+			want: []cf{
+				{"name": "default", "block-size": "32KB"},
+				{"block-size": "8KB"},
+			},
+		},
+		{
+			// or appends it without OverwriteArrays
+			name: "no key append",
+			merge: `rocksdb:
+  column-families:
+    - block-size: 8KB
+`,
+			want: []cf{
+				{"name": "default", "block-size": "64KB", "compression": "lz4"},
+				{"name": "write", "block-size": "64KB"},
+				{"name": "lock", "block-size": "16KB"},
+				{"block-size": "8KB"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		dir, files := writeFiles(t, map[string]string{"tikv.yml": columnFamilies, "merge.yml": c.merge})
+		out, err := MergeWithOptions(files["tikv.yml"], &MergeOptions{
+			Deep:            true,
+			OverwriteArrays: c.overwrite,
+			ArrayMergeKey:   "name",
+		}, files["merge.yml"])
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if got := columnFamiliesOf(t, out); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: column families %v, want %v:\n%s", c.name, got, c.want, out)
+		}
+		if v := valueOf(decoded(t, out), "rocksdb", "max-open-files"); v != 40960 {
+			t.Errorf("%s: max-open-files %v, want 40960 kept", c.name, v)
+		}
+	}
+}
+
+func TestMergeComments(t *testing.T) {
+	dir, files := writeFiles(t, map[string]string{
+		"tikv.yml": `# the tikv config of the tidb cluster
+
+# storage tuning
+storage:
+  # the cache of all the column families
+  block-cache:
+    capacity: 8GB # half of the memory
+  scheduler-concurrency: 2048000
+  # the end of storage
+
+raftstore:
+  sync-log: true # keep it on
+# the end of the file
+`,
+		"new.yml": `# the new options of v3.0.5
+storage:
+  block-cache:
+    capacity: 4GB
+    # shared by the column families
+    shared: true
+  reserve-space: 2GB # the new default
+pessimistic-txn:
+  enabled: true # on by default
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	out, err := MergeWithOptions(files["tikv.yml"], nil, files["new.yml"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# the tikv config of the tidb cluster",
+		"# storage tuning\nstorage:",
+		"  # the cache of all the column families\n  block-cache:",
+		// the replaced value keeps the comment of input
+		"    capacity: 4GB # half of the memory",
+		"  scheduler-concurrency: 2048000",
+		"  # the end of storage",
+		"  sync-log: true # keep it on",
+		"# the end of the file",
+		// the comments of the merged keys are added
+		"    # shared by the column families\n    shared: true",
+		"  reserve-space: 2GB # the new default",
+		"  enabled: true # on by default",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("output has no %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestReplaceNodeComments(t *testing.T) {
+	dst := &yaml.Node{
+		Kind:        yaml.ScalarNode,
+		Value:       "8GB",
+		HeadComment: "# the cache",
+		LineComment: "# half of the memory",
+		FootComment: "# the end",
+	}
+
+	// the comments of dst are kept if src has none
+	got := replaceNode(dst, &yaml.Node{Kind: yaml.ScalarNode, Value: "4GB"})
+	if got.Value != "4GB" || got.HeadComment != dst.HeadComment || got.LineComment != dst.LineComment ||
+		got.FootComment != dst.FootComment {
+		t.Errorf("replaced %+v, want 4GB with the comments of %+v", got, dst)
+	}
+
+	// the ones of src win
+	got = replaceNode(dst, &yaml.Node{Kind: yaml.ScalarNode, Value: "4GB", LineComment: "# a quarter"})
+	if got.LineComment != "# a quarter" || got.HeadComment != dst.HeadComment || got.FootComment != dst.FootComment {
+		t.Errorf("replaced %+v, want the line comment of src and the others of dst", got)
+	}
+	if dst.Value != "8GB" || dst.LineComment != "# half of the memory" {
+		t.Errorf("dst is changed to %+v", dst)
+	}
+}
@@ -0,0 +1,190 @@
+package yaml
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/ngaut/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+type updateDataFn func(node *yaml.Node, currentIndex int) error
+
+// readAndUpdate decodes every document in reader as a node tree, updates it by
+// updateData and encodes it again, so the comments and the key order of the
+// documents are kept. A reader without documents is updated as an empty one.
+// The anchors of the documents are expanded first with expand.
+func readAndUpdate(reader io.Reader, expand bool, updateData updateDataFn) (string, error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	decoder := yaml.NewDecoder(reader)
+
+	currentIndex := 0
+	for ; ; currentIndex++ {
+		log.Debugf("Read doc %v", currentIndex)
+		node := &yaml.Node{}
+		err := decoder.Decode(node)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("faied to read document at index %v, %v", currentIndex, err)
+		}
+		if expand {
+			expandNode(node)
+		}
+
+		if err := updateAndEncode(encoder, node, currentIndex, updateData); err != nil {
+			return "", err
+		}
+	}
+
+	if currentIndex == 0 {
+		node := &yaml.Node{Kind: yaml.DocumentNode}
+		if err := updateAndEncode(encoder, node, currentIndex, updateData); err != nil {
+			return "", err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func updateAndEncode(encoder *yaml.Encoder, node *yaml.Node, currentIndex int, updateData updateDataFn) error {
+	if err := updateData(node, currentIndex); err != nil {
+		return fmt.Errorf("failed to update document at index %v, %v", currentIndex, err)
+	}
+
+	if node.Kind == yaml.DocumentNode && len(node.Content) == 0 {
+		return nil
+	}
+
+	fixAliases(node)
+	if err := encoder.Encode(node); err != nil {
+		return fmt.Errorf("failed to write document at index %v, %v", currentIndex, err)
+	}
+
+	return nil
+}
+
+// openStream opens filename for reading, "-" means stdin.
+func openStream(filename string) (io.Reader, func(), error) {
+	if filename == "" {
+		return nil, nil, errors.New("must provide filename")
+	}
+
+	if filename == "-" {
+		return bufio.NewReader(os.Stdin), func() {}, nil
+	}
+
+	file, err := os.Open(filename) // nolint gosec
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, func() { safelyCloseFile(file) }, nil
+}
+
+// readNode reads the first document of filename, it returns nil if there is
+// no document in the file. The anchors are expanded with expand.
+func readNode(filename string, expand bool) (*yaml.Node, error) {
+	stream, closeFn, err := openStream(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	node := &yaml.Node{}
+	if err := yaml.NewDecoder(stream).Decode(node); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if expand {
+		expandNode(node)
+	}
+	return node, nil
+}
+
+func safelyCloseFile(file *os.File) {
+	err := file.Close()
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// contentNode returns the root node of a document node.
+func contentNode(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return node.Content[0]
+	}
+
+	return node
+}
+
+// mappingIndex returns the index of the key node in a mapping node, or -1.
+func mappingIndex(node *yaml.Node, key string) int {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return -1
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isEmptyNode returns whether node is null or an empty collection.
+func isEmptyNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Tag == "!!null"
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	}
+
+	return false
+}
+
+// nodeValue decodes node to a plain value.
+func nodeValue(node *yaml.Node) interface{} {
+	if node == nil {
+		return nil
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return node.Value
+	}
+
+	return value
+}
+
+// nodeEqual compares the values of nodes ignoring comments and styles.
+func nodeEqual(a, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return reflect.DeepEqual(nodeValue(a), nodeValue(b))
+}
@@ -1,5 +1,14 @@
 package yaml
 
+// ParsePath splits a path like raftstore.sync-log or "a.b".c into its keys,
+// it is the format of the paths in rule files and DiffEntry.
+func ParsePath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return parsePath(path)
+}
+
 func parsePath(path string) []string {
 	return parsePathAccum([]string{}, path)
 }
@@ -32,7 +41,11 @@ func search(path string, matchingChars []uint8, skipNext bool) (pathElement stri
 		if contains(matchingChars, char) {
 			var remainingStart = i + 1
 			if skipNext {
-				remainingStart = remainingStart + 1
+				// skip the '.' after the closing char, e.g [0].a, but keep
+				// the '[' of a following index, e.g [0][1]
+				if remainingStart < len(path) && path[remainingStart] == '.' {
+					remainingStart = remainingStart + 1
+				}
 			} else if !skipNext && char != '.' {
 				remainingStart = i
 			}
@@ -0,0 +1,177 @@
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ngaut/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// RenamePath moves the value of From to To, the paths are in the format of
+// DeleteMulti without wildcards.
+type RenamePath struct {
+	From string
+	To   string
+}
+
+// RenameOptions tells how RenameMultiWithOptions renames the paths.
+type RenameOptions struct {
+	// ExpandAnchors expands the aliases and the merge keys of input,
+	// otherwise the anchors are kept.
+	ExpandAnchors bool
+}
+
+// RenameMulti moves the values of the renamed paths in the first document of
+// input to the new paths in order, the missing parents of a new path are
+// created and an existing value of it is replaced. A path not found is skipped
+// with a warning, a new path that can not be set is an error. The anchors are
+// kept.
+func RenameMulti(input string, renames []RenamePath) (string, error) {
+	return RenameMultiWithOptions(input, renames, nil)
+}
+
+// RenameMultiWithOptions is RenameMulti by opts, nil opts keeps the anchors.
+func RenameMultiWithOptions(input string, renames []RenamePath, opts *RenameOptions) (string, error) {
+	if opts == nil {
+		opts = &RenameOptions{}
+	}
+	docIndexInt := 0
+
+	stream, closeFn, err := openStream(input)
+	if err != nil {
+		return "", err
+	}
+	defer closeFn()
+
+	var updateData = func(node *yaml.Node, currentIndex int) error {
+		if currentIndex != docIndexInt {
+			return nil
+		}
+
+		root := contentNode(node)
+		for _, r := range renames {
+			log.Debugf("rename path %s to %s", r.From, r.To)
+
+			if r.From == "" || r.To == "" || r.From == r.To {
+				continue
+			}
+
+			if strings.HasPrefix(r.To, r.From+".") || strings.HasPrefix(r.To, r.From+"[") {
+				return fmt.Errorf("can not rename path %s to its child %s", r.From, r.To)
+			}
+
+			from := parsePath(r.From)
+			key, value := findNode(root, from, false)
+			if value == nil {
+				log.Warnf("rename path %s not found, skip it", r.From)
+				continue
+			}
+
+			if !setNode(root, parsePath(r.To), key, value) {
+				return fmt.Errorf("can not rename path %s to %s, the parent of %s is not a map", r.From, r.To, r.To)
+			}
+			findNode(root, from, true)
+		}
+		return nil
+	}
+
+	return readAndUpdate(stream, opts.ExpandAnchors, updateData)
+}
+
+// findNode returns the key node and the value node of paths in node, the key
+// node is nil for an array item. With remove, they are removed from node.
+func findNode(node *yaml.Node, paths []string, remove bool) (*yaml.Node, *yaml.Node) {
+	if node == nil || len(paths) == 0 {
+		return nil, nil
+	}
+
+	head, tail := paths[0], paths[1:]
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		idx := writableIndex(node, head)
+		if idx < 0 {
+			return nil, nil
+		}
+		if len(tail) > 0 {
+			return findNode(node.Content[idx+1], tail, remove)
+		}
+
+		key, value := node.Content[idx], node.Content[idx+1]
+		if remove {
+			node.Content = append(node.Content[:idx], node.Content[idx+2:]...)
+		}
+		return key, value
+	case yaml.SequenceNode:
+		index, err := strconv.Atoi(head)
+		if err != nil || index < 0 || index >= len(node.Content) {
+			return nil, nil
+		}
+		node.Content[index] = unaliased(node.Content[index])
+		if len(tail) > 0 {
+			return findNode(node.Content[index], tail, remove)
+		}
+
+		value := node.Content[index]
+		if remove {
+			node.Content = append(node.Content[:index], node.Content[index+1:]...)
+		}
+		return nil, value
+	}
+
+	return nil, nil
+}
+
+// setNode sets value to paths of node, it creates the missing maps of the
+// parents. The comments of key are kept on the new key node.
+func setNode(node *yaml.Node, paths []string, key *yaml.Node, value *yaml.Node) bool {
+	if node == nil || len(paths) == 0 {
+		return false
+	}
+
+	head, tail := paths[0], paths[1:]
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		idx := writableIndex(node, head)
+		if len(tail) > 0 {
+			if idx < 0 {
+				node.Content = append(node.Content,
+					&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: head},
+					&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+				idx = len(node.Content) - 2
+			}
+			return setNode(node.Content[idx+1], tail, key, value)
+		}
+
+		newKey := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+		if key != nil {
+			k := *key
+			newKey = &k
+		}
+		newKey.Value = head
+
+		if idx < 0 {
+			node.Content = append(node.Content, newKey, value)
+		} else {
+			node.Content[idx+1] = value
+		}
+		return true
+	case yaml.SequenceNode:
+		index, err := strconv.Atoi(head)
+		if err != nil || index < 0 || index >= len(node.Content) {
+			return false
+		}
+		node.Content[index] = unaliased(node.Content[index])
+		if len(tail) > 0 {
+			return setNode(node.Content[index], tail, key, value)
+		}
+
+		node.Content[index] = value
+		return true
+	}
+
+	return false
+}
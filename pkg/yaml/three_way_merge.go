@@ -0,0 +1,209 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Conflict is a key changed differently in ours and theirs.
+type Conflict struct {
+	Path   string
+	Base   interface{}
+	Ours   interface{}
+	Theirs interface{}
+}
+
+// ConflictError is returned by ThreeWayMerge if there are conflicts.
+type ConflictError struct {
+	Conflicts []*Conflict
+}
+
+func (e *ConflictError) Error() string {
+	paths := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		paths = append(paths, c.Path)
+	}
+	return fmt.Sprintf("%d conflicts found: %s", len(e.Conflicts), strings.Join(paths, ", "))
+}
+
+// ThreeWayMerge merges the changes from base to ours and from base to theirs,
+// e.g. base is the old default config, ours is the customized config and
+// theirs is the new default config. A key changed only on one side takes that
+// change, a key changed on both sides differently is a conflict and a
+// *ConflictError is returned. The comments of the nodes taken are kept, the
+// keys of the merge keys of the maps merged are set explicitly. The anchors
+// are kept.
+func ThreeWayMerge(base, ours, theirs string) (string, error) {
+	return ThreeWayMergeWithOptions(base, ours, theirs, nil)
+}
+
+// ThreeWayMergeOptions tells how ThreeWayMergeWithOptions merges the files.
+type ThreeWayMergeOptions struct {
+	// ExpandAnchors expands the aliases and the merge keys of the files,
+	// otherwise the anchors are kept.
+	ExpandAnchors bool
+}
+
+// ThreeWayMergeWithOptions is ThreeWayMerge by opts, nil opts keeps the
+// anchors.
+func ThreeWayMergeWithOptions(base, ours, theirs string, opts *ThreeWayMergeOptions) (string, error) {
+	if opts == nil {
+		opts = &ThreeWayMergeOptions{}
+	}
+	var docs [3]*yaml.Node
+	for i, f := range []string{base, ours, theirs} {
+		node, err := readNode(f, opts.ExpandAnchors)
+		if err != nil {
+			return "", err
+		}
+		docs[i] = node
+	}
+
+	var conflicts []*Conflict
+	merged := threeWayMergeMap("", mappingNode(docs[0]), mappingNode(docs[1]), mappingNode(docs[2]), &conflicts)
+	if len(conflicts) > 0 {
+		return "", &ConflictError{Conflicts: conflicts}
+	}
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	if docs[1] != nil && docs[1].Kind == yaml.DocumentNode {
+		*doc = *docs[1]
+	}
+	doc.Content = []*yaml.Node{merged}
+	fixAliases(doc)
+
+	buf := bytes.NewBuffer(make([]byte, 0))
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// mappingNode returns the root of doc if it is a mapping node.
+func mappingNode(doc *yaml.Node) *yaml.Node {
+	node := contentNode(doc)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	return node
+}
+
+// mergeValue is a key and its value in a map, both are nil if the key is
+// absent.
+type mergeValue struct {
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+func (v mergeValue) ok() bool {
+	return v.value != nil
+}
+
+func (v mergeValue) equal(o mergeValue) bool {
+	return nodeEqual(v.value, o.value)
+}
+
+func (v mergeValue) isMap() bool {
+	return v.value != nil && resolveAlias(v.value).Kind == yaml.MappingNode
+}
+
+// explicitMap returns the map a node refers to, a copy with the keys of the
+// merge keys set explicitly if it has any.
+func explicitMap(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+
+	if node.Kind == yaml.AliasNode || hasMergeKeys(node) {
+		node = copyNode(resolveAlias(node))
+		inlineMergeKeys(node)
+	}
+	return node
+}
+
+func threeWayMergeMap(path string, base, ours, theirs *yaml.Node, conflicts *[]*Conflict) *yaml.Node {
+	base, ours, theirs = explicitMap(base), explicitMap(ours), explicitMap(theirs)
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if ours != nil {
+		node := *ours
+		merged = &node
+	}
+	merged.Content = nil
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, m := range []*yaml.Node{ours, theirs} {
+		if m == nil {
+			continue
+		}
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			k := m.Content[i].Value
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	for _, k := range keys {
+		b, o, t := lookupValue(base, k), lookupValue(ours, k), lookupValue(theirs, k)
+		childPath := joinPath(path, k)
+
+		if o.isMap() && t.isMap() && (b.isMap() || !b.ok()) {
+			merged.Content = append(merged.Content, o.key,
+				threeWayMergeMap(childPath, b.value, o.value, t.value, conflicts))
+			continue
+		}
+
+		var result mergeValue
+		switch {
+		case o.equal(t), b.equal(t):
+			result = o
+		case b.equal(o):
+			result = t
+		default:
+			*conflicts = append(*conflicts, &Conflict{
+				Path:   childPath,
+				Base:   nodeValue(b.value),
+				Ours:   nodeValue(o.value),
+				Theirs: nodeValue(t.value),
+			})
+			result = o
+		}
+
+		if result.ok() {
+			merged.Content = append(merged.Content, result.key, result.value)
+		}
+	}
+
+	return merged
+}
+
+func lookupValue(m *yaml.Node, key string) mergeValue {
+	idx := mappingIndex(m, key)
+	if idx < 0 {
+		return mergeValue{}
+	}
+	return mergeValue{key: m.Content[idx], value: m.Content[idx+1]}
+}
+
+// joinPath joins the keys in the format parsed by parsePath.
+func joinPath(path string, key string) string {
+	if strings.Contains(key, ".") {
+		key = fmt.Sprintf("%q", key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -10,11 +10,12 @@ import (
 func main() {
 	p := parser.NewParser()
 
-	new, delete, err := p.ParserFile("../../rules/v2.1.17-to-v3.0.4.yml", ".", "tikv")
+	rf, err := p.ParseFileToRuleFiles("../../rules/v2.1.17-to-v3.0.4.yml", ".", "tikv")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Println(new)
-	fmt.Println(delete)
+	fmt.Println(rf.NewRuleFile)
+	fmt.Println(rf.DeleteRuleFile)
+	fmt.Println(rf.RenameRuleFile)
 }